@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
+	"github.com/rs/zerolog/log"
+)
+
+// errChaos is returned by the chaos decorators in place of a real GCP error
+var errChaos = errors.New("simulated failure injected by chaos testing")
+
+// chaosDice rolls against probabilities for the chaos decorators, safe for concurrent use
+type chaosDice struct {
+	mutex  sync.Mutex
+	random *rand.Rand
+}
+
+func newChaosDice() *chaosDice {
+	return &chaosDice{random: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// roll returns true with the given probability between 0 and 1
+func (d *chaosDice) roll(probability float64) bool {
+	if probability <= 0 {
+		return false
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.random.Float64() < probability
+}
+
+// ChaosGCloudContainer injects simulated GCP errors and stuck operations, to rehearse rollback and alerting in staging
+type ChaosGCloudContainer struct {
+	GCloudContainerClient
+	ErrorRate          float64
+	StuckOperationRate float64
+	dice               *chaosDice
+}
+
+// NewChaosGCloudContainer wraps a GCloud container client to fail at the given rates
+func NewChaosGCloudContainer(client GCloudContainerClient, errorRate, stuckOperationRate float64) GCloudContainerClient {
+	return &ChaosGCloudContainer{
+		GCloudContainerClient: client,
+		ErrorRate:             errorRate,
+		StuckOperationRate:    stuckOperationRate,
+		dice:                  newChaosDice(),
+	}
+}
+
+// GetNodePoolLocations returns the zones of a given node pool, or a simulated error
+func (c *ChaosGCloudContainer) GetNodePoolLocations(name string) (locations []string, err error) {
+	if c.dice.roll(c.ErrorRate) {
+		log.Warn().Str("node-pool", name).Msg("Chaos: injecting error getting node pool locations")
+		return nil, errChaos
+	}
+
+	return c.GCloudContainerClient.GetNodePoolLocations(name)
+}
+
+// SetNodePoolSize set the size of a given node pool, or fails or gets stuck
+func (c *ChaosGCloudContainer) SetNodePoolSize(ctx context.Context, name string, size int64) (err error) {
+	if err = c.inject(ctx, name); err != nil {
+		return
+	}
+
+	return c.GCloudContainerClient.SetNodePoolSize(ctx, name, size)
+}
+
+// SetNodePoolZoneSize set the size of a given node pool in a single zone, or fails or gets stuck
+func (c *ChaosGCloudContainer) SetNodePoolZoneSize(ctx context.Context, name, zone string, size int64) (err error) {
+	if err = c.inject(ctx, name); err != nil {
+		return
+	}
+
+	return c.GCloudContainerClient.SetNodePoolZoneSize(ctx, name, zone, size)
+}
+
+// DeleteNodePoolInstances deletes instances of a given node pool, or fails or gets stuck
+func (c *ChaosGCloudContainer) DeleteNodePoolInstances(ctx context.Context, name, zone string, instances []string) (err error) {
+	if err = c.inject(ctx, name); err != nil {
+		return
+	}
+
+	return c.GCloudContainerClient.DeleteNodePoolInstances(ctx, name, zone, instances)
+}
+
+// DeleteNodePool deletes a given node pool, or fails or gets stuck
+func (c *ChaosGCloudContainer) DeleteNodePool(ctx context.Context, name string) (err error) {
+	if err = c.inject(ctx, name); err != nil {
+		return
+	}
+
+	return c.GCloudContainerClient.DeleteNodePool(ctx, name)
+}
+
+// inject fails an operation immediately or blocks it until its context is done, like an operation that never finishes
+func (c *ChaosGCloudContainer) inject(ctx context.Context, name string) error {
+	if c.dice.roll(c.ErrorRate) {
+		log.Warn().Str("node-pool", name).Msg("Chaos: injecting operation error")
+		return errChaos
+	}
+
+	if c.dice.roll(c.StuckOperationRate) {
+		log.Warn().Str("node-pool", name).Msg("Chaos: injecting stuck operation")
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	return nil
+}
+
+// ChaosKubernetes simulates nodes that are NotReady, which then don't count towards the size of their node pool
+type ChaosKubernetes struct {
+	KubernetesClient
+	NotReadyRate float64
+	dice         *chaosDice
+}
+
+// NewChaosKubernetes wraps a Kubernetes client to report NotReady nodes at the given rate
+func NewChaosKubernetes(client KubernetesClient, notReadyRate float64) KubernetesClient {
+	return &ChaosKubernetes{
+		KubernetesClient: client,
+		NotReadyRate:     notReadyRate,
+		dice:             newChaosDice(),
+	}
+}
+
+// GetZones returns the number of nodes per zone of a given node pool, reporting a simulated NotReady node per zone; a
+// NotReady node still counts in the total
+func (c *ChaosKubernetes) GetZones(name string, locations []string, filter shifter.NodeFilter) (zones shifter.ZoneStats, err error) {
+	zones, err = c.KubernetesClient.GetZones(name, locations, filter)
+
+	for zone, stat := range zones {
+		if stat.Ready > 0 && c.dice.roll(c.NotReadyRate) {
+			log.Warn().Str("node-pool", name).Str("zone", zone).Msg("Chaos: injecting NotReady node")
+			stat.Ready--
+			zones[zone] = stat
+		}
+	}
+
+	return
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
+)
+
+// zonesClient is a Kubernetes client reporting fixed zones
+type zonesClient struct {
+	KubernetesClient
+	zones shifter.ZoneStats
+}
+
+func (c zonesClient) GetZones(string, []string, shifter.NodeFilter) (shifter.ZoneStats, error) {
+	zones := shifter.ZoneStats{}
+	for zone, stat := range c.zones {
+		zones[zone] = stat
+	}
+	return zones, nil
+}
+
+func TestChaosKubernetesGetZones(t *testing.T) {
+	client := zonesClient{zones: shifter.ZoneStats{
+		"europe-west1-b": {Ready: 2, Total: 3},
+		"europe-west1-c": {Ready: 0, Total: 1},
+		"europe-west1-d": {},
+	}}
+
+	zones, err := NewChaosKubernetes(client, 1).GetZones("preemptible-pool", nil, shifter.NodeFilter{})
+
+	expected := shifter.ZoneStats{
+		"europe-west1-b": {Ready: 1, Total: 3},
+		"europe-west1-c": {Ready: 0, Total: 1},
+		"europe-west1-d": {},
+	}
+
+	if err != nil || !reflect.DeepEqual(zones, expected) {
+		t.Errorf("GetZones, expected a NotReady node per zone still counting in the total %v got %v %v", expected, zones, err)
+	}
+
+	if zones, _ := NewChaosKubernetes(client, 0).GetZones("preemptible-pool", nil, shifter.NodeFilter{}); !reflect.DeepEqual(zones, client.zones) {
+		t.Errorf("GetZones without chaos, expected %v got %v", client.zones, zones)
+	}
+}
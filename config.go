@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/rs/zerolog/log"
+)
+
+// secretFlagPattern matches the names of flags whose values are never served
+var secretFlagPattern = regexp.MustCompile(`credentials|secret|token|password|key`)
+
+// redactURL masks the userinfo and query of a url, which often carry credentials or tokens; other values are returned
+// as is
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return value
+	}
+
+	if u.User != nil {
+		u.User = url.User("redacted")
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "redacted"
+	}
+
+	return u.String()
+}
+
+// configEntry is the effective value of a flag and where it was set
+type configEntry struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// effectiveConfig returns the effective value of each flag, set either from its environment variable, on the command
+// line or by its default; values of secret flags are redacted, as are the userinfo and query of urls
+func effectiveConfig(flags []*kingpin.FlagModel) map[string]configEntry {
+	config := map[string]configEntry{}
+
+	for _, flag := range flags {
+		// flags built into kingpin aren't configuration
+		if strings.HasPrefix(flag.Name, "help") || strings.HasPrefix(flag.Name, "completion-") || flag.Name == "version" {
+			continue
+		}
+
+		entry := configEntry{
+			Value:  flag.String(),
+			Source: "default",
+		}
+
+		if flag.Envar != "" && os.Getenv(flag.Envar) != "" {
+			entry.Source = "env"
+		} else if entry.Value != strings.Join(flag.Default, ",") {
+			entry.Source = "flag"
+		}
+
+		if entry.Value != "" && secretFlagPattern.MatchString(flag.Name) {
+			entry.Value = "<redacted>"
+		} else {
+			entry.Value = redactURL(entry.Value)
+		}
+
+		config[flag.Name] = entry
+	}
+
+	return config
+}
+
+// handleConfig serves the effective configuration as json
+func handleConfig(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(effectiveConfig(kingpin.CommandLine.Model().Flags))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error writing config response")
+	}
+}
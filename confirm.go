@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
+)
+
+// Confirmer asks the operator yes/no questions; clients prompting on the same input have to share a confirmer, since
+// its reader buffers input beyond the answer it reads
+type Confirmer struct {
+	In  *bufio.Reader
+	Out io.Writer
+
+	mutex sync.Mutex
+}
+
+// NewConfirmer returns a confirmer reading answers from in and writing questions to out
+func NewConfirmer(in io.Reader, out io.Writer) *Confirmer {
+	return &Confirmer{
+		In:  bufio.NewReader(in),
+		Out: out,
+	}
+}
+
+// ConfirmingGCloudContainer prompts the operator for confirmation before each resize
+type ConfirmingGCloudContainer struct {
+	GCloudContainerClient
+	Confirmer *Confirmer
+}
+
+// NewConfirmingGCloudContainer wraps a GCloud container client to prompt before each resize
+func NewConfirmingGCloudContainer(client GCloudContainerClient, confirmer *Confirmer) GCloudContainerClient {
+	return &ConfirmingGCloudContainer{
+		GCloudContainerClient: client,
+		Confirmer:             confirmer,
+	}
+}
+
+// SetNodePoolSize set the size of a given node pool once the operator confirmed it
+func (c *ConfirmingGCloudContainer) SetNodePoolSize(ctx context.Context, name string, size int64) (err error) {
+	if !c.confirm(fmt.Sprintf("Resize node pool %v to %d node(s) per zone?", name, size)) {
+		return shifter.ErrResizeDeclined
+	}
+
+	return c.GCloudContainerClient.SetNodePoolSize(ctx, name, size)
+}
+
+// SetNodePoolZoneSize set the size of a given node pool in a single zone once the operator confirmed it
+func (c *ConfirmingGCloudContainer) SetNodePoolZoneSize(ctx context.Context, name, zone string, size int64) (err error) {
+	if !c.confirm(fmt.Sprintf("Resize node pool %v to %d node(s) in zone %v?", name, size, zone)) {
+		return shifter.ErrResizeDeclined
+	}
+
+	return c.GCloudContainerClient.SetNodePoolZoneSize(ctx, name, zone, size)
+}
+
+// DeleteNodePoolInstances deletes instances of a given node pool once the operator confirmed it
+func (c *ConfirmingGCloudContainer) DeleteNodePoolInstances(ctx context.Context, name, zone string, instances []string) (err error) {
+	if !c.confirm(fmt.Sprintf("Delete instance(s) %v of node pool %v in zone %v?", strings.Join(instances, ", "), name, zone)) {
+		return shifter.ErrResizeDeclined
+	}
+
+	return c.GCloudContainerClient.DeleteNodePoolInstances(ctx, name, zone, instances)
+}
+
+// DeleteNodePool deletes a given node pool once the operator confirmed it
+func (c *ConfirmingGCloudContainer) DeleteNodePool(ctx context.Context, name string) (err error) {
+	if !c.confirm(fmt.Sprintf("Delete node pool %v?", name)) {
+		return shifter.ErrResizeDeclined
+	}
+
+	return c.GCloudContainerClient.DeleteNodePool(ctx, name)
+}
+
+// confirm asks the operator through the confirmer of the client
+func (c *ConfirmingGCloudContainer) confirm(question string) bool {
+	return c.Confirmer.Confirm(question)
+}
+
+// Confirm asks a yes/no question, anything but yes is considered a no
+func (c *Confirmer) Confirm(question string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	fmt.Fprintf(c.Out, "%v [y/N]: ", question)
+
+	answer, err := c.In.ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
+)
+
+// resizeClient is a GCloud container client recording the node pools it resized
+type resizeClient struct {
+	GCloudContainerClient
+	resized *[]string
+}
+
+func (c resizeClient) SetNodePoolSize(ctx context.Context, name string, size int64) error {
+	*c.resized = append(*c.resized, name)
+	return nil
+}
+
+func TestConfirmingGCloudContainerSharedInput(t *testing.T) {
+	resized := []string{}
+	out := &bytes.Buffer{}
+	confirmer := NewConfirmer(strings.NewReader("y\nn\nyes\n"), out)
+
+	from := NewConfirmingGCloudContainer(resizeClient{resized: &resized}, confirmer)
+	to := NewConfirmingGCloudContainer(resizeClient{resized: &resized}, confirmer)
+
+	ctx := context.Background()
+
+	if err := from.SetNodePoolSize(ctx, "default-pool", 2); err != nil {
+		t.Errorf("SetNodePoolSize confirmed, expected no error got %v", err)
+	}
+	if err := to.SetNodePoolSize(ctx, "preemptible-pool", 3); err != shifter.ErrResizeDeclined {
+		t.Errorf("SetNodePoolSize declined, expected ErrResizeDeclined got %v", err)
+	}
+	if err := to.SetNodePoolSize(ctx, "preemptible-pool", 3); err != nil {
+		t.Errorf("SetNodePoolSize confirmed, expected no error got %v", err)
+	}
+
+	if strings.Join(resized, ",") != "default-pool,preemptible-pool" {
+		t.Errorf("expected default-pool and preemptible-pool to be resized got %v", resized)
+	}
+
+	if prompts := strings.Count(out.String(), "[y/N]"); prompts != 3 {
+		t.Errorf("expected 3 prompts got %d: %v", prompts, out.String())
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed standard 5 field cron expression: minute, hour, day of month, month and day of week
+type Schedule struct {
+	minutes     []bool
+	hours       []bool
+	daysOfMonth []bool
+	months      []bool
+	daysOfWeek  []bool
+
+	// restricted day fields are OR'ed like cron does, e.g. "0 0 1 * 1" matches the first of the month and every monday
+	daysOfMonthRestricted bool
+	daysOfWeekRestricted  bool
+}
+
+// ParseSchedule parses a cron expression like "*/10 8-18 * * 1-5"; each field supports *, single values, ranges, lists
+// and steps, day of week 7 is sunday like 0
+func ParseSchedule(spec string) (schedule *Schedule, err error) {
+	fields := strings.Fields(spec)
+
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Error parsing schedule %q: expected 5 fields, got %v", spec, len(fields))
+	}
+
+	schedule = &Schedule{}
+
+	if schedule.minutes, err = parseScheduleField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("Error parsing minute field of schedule %q:\n%v", spec, err)
+	}
+
+	if schedule.hours, err = parseScheduleField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("Error parsing hour field of schedule %q:\n%v", spec, err)
+	}
+
+	if schedule.daysOfMonth, err = parseScheduleField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("Error parsing day of month field of schedule %q:\n%v", spec, err)
+	}
+
+	if schedule.months, err = parseScheduleField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("Error parsing month field of schedule %q:\n%v", spec, err)
+	}
+
+	if schedule.daysOfWeek, err = parseScheduleField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("Error parsing day of week field of schedule %q:\n%v", spec, err)
+	}
+
+	if schedule.daysOfWeek[7] {
+		schedule.daysOfWeek[0] = true
+	}
+
+	schedule.daysOfMonthRestricted = fields[2] != "*"
+	schedule.daysOfWeekRestricted = fields[4] != "*"
+
+	return
+}
+
+// parseScheduleField parses a single comma separated cron field into the set of values it matches
+func parseScheduleField(field string, min, max int) (values []bool, err error) {
+	values = make([]bool, max+1)
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		rangeAndStep := strings.SplitN(part, "/", 2)
+
+		if len(rangeAndStep) == 2 {
+			step, err = strconv.Atoi(rangeAndStep[1])
+			if err != nil || step < 1 {
+				return nil, fmt.Errorf("Invalid step %q", rangeAndStep[1])
+			}
+		}
+
+		start, end := min, max
+
+		if rangeAndStep[0] != "*" {
+			bounds := strings.SplitN(rangeAndStep[0], "-", 2)
+
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("Invalid value %q", bounds[0])
+			}
+
+			end = start
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("Invalid value %q", bounds[1])
+				}
+			} else if len(rangeAndStep) == 2 {
+				// a single value with a step, e.g. 5/15, runs from that value up to the maximum
+				end = max
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return nil, fmt.Errorf("Range %q is outside of %v-%v", part, min, max)
+		}
+
+		for value := start; value <= end; value += step {
+			values[value] = true
+		}
+	}
+
+	return
+}
+
+// Next returns the first time after the given time matching the schedule, or the zero time if nothing matches within
+// the next 5 years, e.g. for "0 0 30 2 *"
+func (s *Schedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if !s.months[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !s.hours[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !s.minutes[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// matchesDay applies cron's day semantics: when both day fields are restricted either of them has to match
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dayOfMonth := s.daysOfMonth[t.Day()]
+	dayOfWeek := s.daysOfWeek[int(t.Weekday())]
+
+	if s.daysOfMonthRestricted && s.daysOfWeekRestricted {
+		return dayOfMonth || dayOfWeek
+	}
+
+	return dayOfMonth && dayOfWeek
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	tests := []struct {
+		spec     string
+		after    string
+		expected string
+	}{
+		{"*/10 8-18 * * 1-5", "2020-06-01T08:05:00Z", "2020-06-01T08:10:00Z"},
+		{"*/10 8-18 * * 1-5", "2020-06-01T18:50:00Z", "2020-06-02T08:00:00Z"},
+		// friday evening skips to monday morning
+		{"*/10 8-18 * * 1-5", "2020-06-05T19:00:00Z", "2020-06-08T08:00:00Z"},
+		{"0 0 1 * 7", "2020-06-01T00:00:00Z", "2020-06-07T00:00:00Z"},
+		{"30 2 * 12 *", "2020-06-01T00:00:00Z", "2020-12-01T02:30:00Z"},
+		{"5/20 * * * *", "2020-06-01T00:45:00Z", "2020-06-01T01:05:00Z"},
+		{"0 12 29 2 *", "2021-01-01T00:00:00Z", "2024-02-29T12:00:00Z"},
+	}
+
+	for _, test := range tests {
+		schedule, err := ParseSchedule(test.spec)
+		if err != nil {
+			t.Fatalf("ParseSchedule %q, unexpected error: %v", test.spec, err)
+		}
+
+		after, _ := time.Parse(time.RFC3339, test.after)
+		got := schedule.Next(after).Format(time.RFC3339)
+
+		if got != test.expected {
+			t.Errorf("Next of %q after %v, expected %v got %v", test.spec, test.after, test.expected, got)
+		}
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, spec := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule %q, expected an error", spec)
+		}
+	}
+}
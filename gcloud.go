@@ -5,10 +5,15 @@ import (
 	"fmt"
 	"golang.org/x/oauth2/google"
 	"net/http"
-	"strings"
+	"time"
 
+	"cloud.google.com/go/compute/metadata"
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
 	"google.golang.org/api/compute/v1"
 	container "google.golang.org/api/container/v1beta1"
+	monitoring "google.golang.org/api/monitoring/v3"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
 )
 
 const (
@@ -20,20 +25,35 @@ const (
 )
 
 type GCloud struct {
-	Client   *http.Client
-	Cluster  string
-	Context  context.Context
-	Project  string
-	Location string
+	Client          *http.Client
+	Jitter          shifter.Jitter
+	Cluster         string
+	Context         context.Context
+	Project         string
+	Location        string
+	CredentialsFile string
+	CredentialsJSON []byte
 }
 
 type GCloudClient interface {
 	GetProjectDetailsFromNode(string) error
+	GetProjectDetailsFromMetadata() error
+	GetProjectDetails() (string, string, string)
+	SetProjectDetails(string, string, string)
+	CountPreemptions([]InstanceGroup, []string, time.Time) (int, error)
+	GetCluster() string
+	GroupInstances([]InstanceGroup, string, []string) (map[InstanceGroup][]string, error)
+	DeleteInstances(context.Context, InstanceGroup, []string) error
+	ResizeInstanceGroup(context.Context, InstanceGroup, int64) error
+	GetInstanceGroupTargetSize(context.Context, InstanceGroup) (int64, error)
+	GetPendingInstanceGroupOperation(InstanceGroup) (string, error)
 	NewGCloudContainerClient() (GCloudContainerClient, error)
+	NewGCloudContainerClientFor(string, string, string, string, []byte) (GCloudContainerClient, error)
+	NewGCloudMonitoringClient(string, string) (GCloudMonitoringClient, error)
 }
 
-// NewGCloudClient return a GCloud client
-func NewGCloudClient() (gcloud GCloudClient, err error) {
+// NewGCloudClient return a GCloud client, spreading its polls with the given jitter
+func NewGCloudClient(jitter shifter.Jitter) (gcloud GCloudClient, err error) {
 	ctx := context.Background()
 	client, err := google.DefaultClient(ctx, container.CloudPlatformScope)
 
@@ -43,16 +63,49 @@ func NewGCloudClient() (gcloud GCloudClient, err error) {
 
 	gcloud = &GCloud{
 		Client:  client,
+		Jitter:  jitter,
 		Context: ctx,
 	}
 
 	return
 }
 
+// clientOptions returns the options authenticating the services of the client with its credentials, the application
+// default credentials when none are set
+func (g *GCloud) clientOptions() (opts []option.ClientOption) {
+	if len(g.CredentialsJSON) > 0 {
+		opts = append(opts, option.WithCredentialsJSON(g.CredentialsJSON))
+	} else if g.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(g.CredentialsFile))
+	}
+
+	return
+}
+
+// computeService returns a GCloud compute client with the credentials of the client
+func (g *GCloud) computeService(ctx context.Context) (*compute.Service, error) {
+	service, err := compute.NewService(ctx, g.clientOptions()...)
+
+	if err != nil {
+		return nil, fmt.Errorf("Error creating GCloud compute client: %v", err)
+	}
+
+	return service, nil
+}
+
 // NewGCloudContainerClient return a GCloud container client
 func (g *GCloud) NewGCloudContainerClient() (gcloud GCloudContainerClient, err error) {
 	ctx := context.Background()
-	service, err := container.NewService(ctx)
+
+	// the http client is kept to request fields the container client doesn't know about yet
+	httpClient, _, err := htransport.NewClient(ctx, append(g.clientOptions(), option.WithScopes(container.CloudPlatformScope))...)
+
+	if err != nil {
+		err = fmt.Errorf("Error creating GCloud container client:\n%v", err)
+		return
+	}
+
+	service, err := container.NewService(ctx, option.WithHTTPClient(httpClient))
 
 	if err != nil {
 		err = fmt.Errorf("Error creating GCloud container client:\n%v", err)
@@ -60,32 +113,83 @@ func (g *GCloud) NewGCloudContainerClient() (gcloud GCloudContainerClient, err e
 	}
 
 	gcloud = &GCloudContainer{
-		Client:  g,
-		Service: service,
+		Client:     g,
+		Service:    service,
+		HTTPClient: httpClient,
+	}
+
+	return
+}
+
+// NewGCloudContainerClientFor return a GCloud container client for a cluster in another project, location or using
+// other credentials, empty values are inherited from the current client
+func (g *GCloud) NewGCloudContainerClientFor(project, location, cluster, credentialsFile string, credentialsJSON []byte) (gcloud GCloudContainerClient, err error) {
+	target := *g
+
+	if project != "" {
+		target.Project = project
+	}
+	if location != "" {
+		target.Location = location
+	}
+	if cluster != "" {
+		target.Cluster = cluster
+	}
+	if credentialsFile != "" {
+		target.CredentialsFile = credentialsFile
+	}
+	if len(credentialsJSON) > 0 {
+		target.CredentialsJSON = credentialsJSON
+	}
+
+	return target.NewGCloudContainerClient()
+}
+
+// NewGCloudMonitoringClient return a GCloud monitoring client labeling its metrics with the node pools shifted from and
+// to
+func (g *GCloud) NewGCloudMonitoringClient(nodePoolFrom, nodePoolTo string) (gcloud GCloudMonitoringClient, err error) {
+	ctx := context.Background()
+	service, err := monitoring.NewService(ctx, g.clientOptions()...)
+
+	if err != nil {
+		err = fmt.Errorf("Error creating GCloud monitoring client:\n%v", err)
+		return
+	}
+
+	gcloud = &GCloudMonitoring{
+		Client:       g,
+		Service:      service,
+		NodePoolFrom: nodePoolFrom,
+		NodePoolTo:   nodePoolTo,
+		Start:        time.Now(),
+		Totals:       map[string]int64{},
 	}
 
 	return
 }
 
+// GetCluster returns the name of the cluster retrieved from the project details
+func (g *GCloud) GetCluster() string {
+	return g.Cluster
+}
+
 // GetProjectDetailsFromNode retrieve project id, zone and cluster id from a given node spec provider id
 func (g *GCloud) GetProjectDetailsFromNode(providerId string) (err error) {
+	project, zone, instance, err := ParseProviderID(providerId)
 
-	if providerId == "" {
-		return fmt.Errorf("Provider ID is empty, doesn't seem to run in Google Cloud")
+	if err != nil {
+		return
 	}
 
-	s := strings.Split(providerId, "/")
-
-	g.Project = s[2]
+	g.Project = project
 	ctx := context.Background()
-	service, err := compute.NewService(ctx)
+	service, err := g.computeService(ctx)
 
 	if err != nil {
-		err = fmt.Errorf("Error creating GCloud compute client: %v", err)
 		return
 	}
 
-	node, err := service.Instances.Get(g.Project, s[3], s[4]).Context(g.Context).Do()
+	node, err := service.Instances.Get(g.Project, zone, instance).Context(g.Context).Do()
 
 	if err != nil {
 		err = fmt.Errorf("error retrieving instance details from GCloud: %v", err)
@@ -107,3 +211,95 @@ func (g *GCloud) GetProjectDetailsFromNode(providerId string) (err error) {
 
 	return
 }
+
+// GetProjectDetailsFromMetadata retrieve project id, location and cluster name from the metadata server of the GKE
+// node the shifter runs on
+func (g *GCloud) GetProjectDetailsFromMetadata() (err error) {
+	if !metadata.OnGCE() {
+		return fmt.Errorf("Metadata server isn't available, doesn't seem to run in Google Cloud")
+	}
+
+	if g.Project, err = metadata.ProjectID(); err != nil {
+		return fmt.Errorf("Error retrieving project id from the metadata server: %v", err)
+	}
+
+	if g.Cluster, err = metadata.InstanceAttributeValue("cluster-name"); err != nil {
+		return fmt.Errorf("Error retrieving cluster name from the metadata server: %v", err)
+	}
+
+	if g.Location, err = metadata.InstanceAttributeValue("cluster-location"); err != nil {
+		return fmt.Errorf("Error retrieving cluster location from the metadata server: %v", err)
+	}
+
+	return
+}
+
+// GetProjectDetails returns the project, location and name of the cluster
+func (g *GCloud) GetProjectDetails() (project, location, cluster string) {
+	return g.Project, g.Location, g.Cluster
+}
+
+// SetProjectDetails overrides the project, location and name of the cluster with the given non empty values
+func (g *GCloud) SetProjectDetails(project, location, cluster string) {
+	if project != "" {
+		g.Project = project
+	}
+	if location != "" {
+		g.Location = location
+	}
+	if cluster != "" {
+		g.Cluster = cluster
+	}
+}
+
+// CountPreemptions counts the instances of the given instance groups preempted in the given zones since the given time
+func (g *GCloud) CountPreemptions(groups []InstanceGroup, zones []string, since time.Time) (count int, err error) {
+	ctx := context.Background()
+	service, err := g.computeService(ctx)
+
+	if err != nil {
+		return
+	}
+
+	inZones := map[string]bool{}
+	for _, zone := range zones {
+		inZones[zone] = true
+	}
+
+	for _, group := range groups {
+		if !inZones[group.Zone] {
+			continue
+		}
+
+		manager, err := service.InstanceGroupManagers.Get(group.Project, group.Zone, group.Name).Context(g.Context).Do()
+
+		if err != nil {
+			return 0, fmt.Errorf("Error getting instance group %v: %v", group.Name, err)
+		}
+
+		err = service.ZoneOperations.List(group.Project, group.Zone).
+			Filter(`operationType="compute.instances.preempted"`).
+			Context(g.Context).
+			Pages(g.Context, func(operations *compute.OperationList) error {
+				for _, operation := range operations.Items {
+					if !isInstanceOfGroup(operation.TargetLink, group, manager.BaseInstanceName) {
+						continue
+					}
+
+					insertTime, err := time.Parse(time.RFC3339, operation.InsertTime)
+					if err != nil || insertTime.Before(since) {
+						continue
+					}
+
+					count++
+				}
+				return nil
+			})
+
+		if err != nil {
+			return 0, fmt.Errorf("Error listing preemptions in zone %v: %v", group.Zone, err)
+		}
+	}
+
+	return
+}
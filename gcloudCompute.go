@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// InstanceGroup identifies a managed instance group backing a node pool, large node pools are backed by several
+// instance groups per zone
+type InstanceGroup struct {
+	Project string
+	Zone    string
+	Name    string
+}
+
+// ParseInstanceGroupURL parses an instance group url as listed in NodePool.instanceGroupUrls e.g.
+// https://www.googleapis.com/compute/v1/projects/my-project/zones/europe-west1-b/instanceGroupManagers/gke-c-pool-1234-grp
+func ParseInstanceGroupURL(url string) (group InstanceGroup, err error) {
+	s := strings.Split(url, "/")
+
+	for i := 0; i+1 < len(s); i++ {
+		switch s[i] {
+		case "projects":
+			group.Project = s[i+1]
+		case "zones":
+			group.Zone = s[i+1]
+		case "instanceGroupManagers", "instanceGroups":
+			group.Name = s[i+1]
+		}
+	}
+
+	if group.Project == "" || group.Zone == "" || group.Name == "" {
+		return group, fmt.Errorf("Instance group url %v is not of the form .../projects/<project>/zones/<zone>/instanceGroupManagers/<name>", url)
+	}
+
+	return
+}
+
+// isInstanceOfGroup returns true if an instance url, such as the target link of an operation, is the one of an instance
+// managed by the given instance group; managed instances are named <base instance name>-<suffix> in the zone of the group
+func isInstanceOfGroup(url string, group InstanceGroup, baseInstanceName string) bool {
+	var project, zone, name string
+
+	s := strings.Split(url, "/")
+	for i := 0; i+1 < len(s); i++ {
+		switch s[i] {
+		case "projects":
+			project = s[i+1]
+		case "zones":
+			zone = s[i+1]
+		case "instances":
+			name = s[i+1]
+		}
+	}
+
+	return baseInstanceName != "" && project == group.Project && zone == group.Zone && strings.HasPrefix(name, baseInstanceName+"-")
+}
+
+// ProviderIDError is returned when a provider id isn't the one of a GKE node, e.g. outside of GKE
+type ProviderIDError struct {
+	ProviderID string
+	Reason     string
+}
+
+func (e *ProviderIDError) Error() string {
+	return fmt.Sprintf("Provider ID %q %v, expected gce://<project>/<zone>/<instance>", e.ProviderID, e.Reason)
+}
+
+// ParseProviderID returns the project, zone and instance name from a node spec provider id e.g.
+// gce://my-project/europe-west1-b/gke-c-pool-1234-abcd
+func ParseProviderID(providerID string) (project, zone, instance string, err error) {
+	if providerID == "" {
+		return "", "", "", &ProviderIDError{ProviderID: providerID, Reason: "is empty, doesn't seem to run in Google Cloud"}
+	}
+
+	s := strings.Split(providerID, "/")
+
+	if s[0] != "gce:" {
+		return "", "", "", &ProviderIDError{ProviderID: providerID, Reason: fmt.Sprintf("has scheme %q instead of gce", strings.TrimSuffix(s[0], ":"))}
+	}
+
+	if len(s) != 5 || s[2] == "" || s[3] == "" || s[4] == "" {
+		return "", "", "", &ProviderIDError{ProviderID: providerID, Reason: "misses the project, zone or instance"}
+	}
+
+	return s[2], s[3], s[4], nil
+}
+
+// GroupInstances returns the given instances of a zone by the instance group managing them, a zone can be backed by
+// several instance groups; the managed instances of each instance group of the zone are listed once
+func (g *GCloud) GroupInstances(groups []InstanceGroup, zone string, instances []string) (grouped map[InstanceGroup][]string, err error) {
+	ctx := context.Background()
+	client, _, err := htransport.NewClient(ctx, append(g.clientOptions(), option.WithScopes(compute.ComputeReadonlyScope))...)
+
+	if err != nil {
+		return nil, fmt.Errorf("Error creating GCloud compute client: %v", err)
+	}
+
+	service, err := compute.NewService(ctx, option.WithHTTPClient(client))
+
+	if err != nil {
+		return nil, fmt.Errorf("Error creating GCloud compute client: %v", err)
+	}
+
+	managed := map[InstanceGroup][]string{}
+
+	for _, group := range groups {
+		if group.Zone != zone {
+			continue
+		}
+
+		urls, err := listManagedInstances(g.Context, client, service.BasePath, group)
+
+		if err != nil {
+			return nil, fmt.Errorf("Error listing instances of instance group %v: %v", group.Name, err)
+		}
+
+		managed[group] = urls
+	}
+
+	grouped, missing := groupManagedInstances(managed, instances)
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("Instance(s) %v are not managed by any of the instance groups in zone %v", strings.Join(missing, ", "), zone)
+	}
+
+	return
+}
+
+// listManagedInstances returns the urls of the instances an instance group manages, over all pages of the listing; the
+// compute client in use predates paging the managed instances, so the pages are requested directly
+func listManagedInstances(ctx context.Context, client *http.Client, basePath string, group InstanceGroup) (urls []string, err error) {
+	endpoint := fmt.Sprintf("%v%v/zones/%v/instanceGroupManagers/%v/listManagedInstances", basePath, group.Project, group.Zone, group.Name)
+	pageToken := ""
+	urls = []string{}
+
+	for {
+		query := url.Values{}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := client.Do(request)
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			ManagedInstances []struct {
+				Instance string `json:"instance"`
+			} `json:"managedInstances"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+
+		if response.StatusCode != http.StatusOK {
+			response.Body.Close()
+			return nil, fmt.Errorf("Error listing managed instances of %v: %v", group.Name, response.Status)
+		}
+
+		err = json.NewDecoder(response.Body).Decode(&page)
+		response.Body.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, managedInstance := range page.ManagedInstances {
+			urls = append(urls, managedInstance.Instance)
+		}
+
+		if page.NextPageToken == "" {
+			return urls, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// splitZoneSize spreads the size of a zone over the instance groups backing it, as evenly as possible with the first
+// instance groups by name taking the remainder
+func splitZoneSize(groups []InstanceGroup, size int64) map[InstanceGroup]int64 {
+	sorted := append([]InstanceGroup{}, groups...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	sizes := map[InstanceGroup]int64{}
+	for i, group := range sorted {
+		sizes[group] = size / int64(len(sorted))
+		if int64(i) < size%int64(len(sorted)) {
+			sizes[group]++
+		}
+	}
+
+	return sizes
+}
+
+// groupManagedInstances returns the given instances by the instance group whose managed instance urls include them, and
+// the instances none of the instance groups manages
+func groupManagedInstances(managed map[InstanceGroup][]string, instances []string) (grouped map[InstanceGroup][]string, missing []string) {
+	grouped = map[InstanceGroup][]string{}
+
+	for _, instance := range instances {
+		found := false
+
+		for group, urls := range managed {
+			for _, url := range urls {
+				if strings.HasSuffix(url, "/instances/"+instance) {
+					grouped[group] = append(grouped[group], instance)
+					found = true
+					break
+				}
+			}
+
+			if found {
+				break
+			}
+		}
+
+		if !found {
+			missing = append(missing, instance)
+		}
+	}
+
+	return
+}
+
+// DeleteInstances deletes instances through the instance group managing them, which reduces the size of the instance
+// group accordingly, and waits for the deletion to finish
+func (g *GCloud) DeleteInstances(ctx context.Context, group InstanceGroup, instances []string) (err error) {
+	service, err := g.computeService(ctx)
+
+	if err != nil {
+		return
+	}
+
+	request := &compute.InstanceGroupManagersDeleteInstancesRequest{}
+	for _, instance := range instances {
+		request.Instances = append(request.Instances, fmt.Sprintf("zones/%v/instances/%v", group.Zone, instance))
+	}
+
+	operation, err := service.InstanceGroupManagers.DeleteInstances(group.Project, group.Zone, group.Name, request).Context(ctx).Do()
+
+	if err != nil {
+		return
+	}
+
+	shifter.RecordOperation(ctx, shifter.Operation{
+		Name:      operation.Name,
+		Kind:      "delete_instances",
+		Target:    group.Name,
+		Zone:      group.Zone,
+		StartedAt: time.Now(),
+	})
+
+	for operation.Status != "DONE" {
+		log.Debug().Msgf("Waiting for operation %v to delete instance(s) %v", operation.Name, strings.Join(instances, ", "))
+
+		// wait returns when the operation is done or after about two minutes
+		operation, err = service.ZoneOperations.Wait(group.Project, group.Zone, operation.Name).Context(ctx).Do()
+
+		if err != nil {
+			return fmt.Errorf("Error waiting for deletion of instance(s) %v: %v", strings.Join(instances, ", "), err)
+		}
+
+		if ctx.Err() != nil {
+			return fmt.Errorf("Gave up waiting for deletion of instance(s) %v: %v", strings.Join(instances, ", "), ctx.Err())
+		}
+	}
+
+	if operation.Error != nil && len(operation.Error.Errors) > 0 {
+		return fmt.Errorf("Error deleting instance(s) %v: %v", strings.Join(instances, ", "), operation.Error.Errors[0].Message)
+	}
+
+	return
+}
+
+// ResizeInstanceGroup sets the target size of an instance group, and waits for the resize to be accepted
+func (g *GCloud) ResizeInstanceGroup(ctx context.Context, group InstanceGroup, size int64) (err error) {
+	service, err := g.computeService(ctx)
+
+	if err != nil {
+		return
+	}
+
+	operation, err := service.InstanceGroupManagers.Resize(group.Project, group.Zone, group.Name, size).Context(ctx).Do()
+
+	if err != nil {
+		return
+	}
+
+	shifter.RecordOperation(ctx, shifter.Operation{
+		Name:      operation.Name,
+		Kind:      "resize_instance_group",
+		Target:    group.Name,
+		Zone:      group.Zone,
+		StartedAt: time.Now(),
+	})
+
+	for operation.Status != "DONE" {
+		log.Debug().Msgf("Waiting for operation %v to resize instance group %v to %d", operation.Name, group.Name, size)
+
+		// wait returns when the operation is done or after about two minutes
+		operation, err = service.ZoneOperations.Wait(group.Project, group.Zone, operation.Name).Context(ctx).Do()
+
+		if err != nil {
+			return fmt.Errorf("Error waiting for resize of instance group %v: %v", group.Name, err)
+		}
+
+		if ctx.Err() != nil {
+			return fmt.Errorf("Gave up waiting for resize of instance group %v: %v", group.Name, ctx.Err())
+		}
+	}
+
+	if operation.Error != nil && len(operation.Error.Errors) > 0 {
+		return fmt.Errorf("Error resizing instance group %v: %v", group.Name, operation.Error.Errors[0].Message)
+	}
+
+	return
+}
+
+// GetPendingInstanceGroupOperation returns the name of a resize or instance deletion that hasn't finished yet on a given
+// instance group, empty if there is none
+func (g *GCloud) GetPendingInstanceGroupOperation(group InstanceGroup) (operationName string, err error) {
+	ctx := context.Background()
+	service, err := g.computeService(ctx)
+
+	if err != nil {
+		return
+	}
+
+	err = service.ZoneOperations.List(group.Project, group.Zone).
+		Filter(`status!="DONE"`).
+		Context(g.Context).
+		Pages(g.Context, func(operations *compute.OperationList) error {
+			for _, operation := range operations.Items {
+				if operationName == "" && isPendingInstanceGroupOperation(operation, group) {
+					operationName = operation.Name
+				}
+			}
+			return nil
+		})
+
+	if err != nil {
+		return "", fmt.Errorf("Error listing operations in zone %v: %v", group.Zone, err)
+	}
+
+	return
+}
+
+// isPendingInstanceGroupOperation returns true if the operation resizes or deletes instances of the given instance group
+// and hasn't finished yet
+func isPendingInstanceGroupOperation(operation *compute.Operation, group InstanceGroup) bool {
+	if operation.Status == "DONE" {
+		return false
+	}
+
+	if operation.OperationType != "compute.instanceGroupManagers.resize" && operation.OperationType != "compute.instanceGroupManagers.deleteInstances" {
+		return false
+	}
+
+	target, err := ParseInstanceGroupURL(operation.TargetLink)
+
+	return err == nil && target == group
+}
+
+// GetInstanceGroupTargetSize returns the number of instances an instance group is meant to run
+func (g *GCloud) GetInstanceGroupTargetSize(ctx context.Context, group InstanceGroup) (size int64, err error) {
+	service, err := g.computeService(ctx)
+
+	if err != nil {
+		return
+	}
+
+	manager, err := service.InstanceGroupManagers.Get(group.Project, group.Zone, group.Name).Context(ctx).Do()
+
+	if err != nil {
+		return
+	}
+
+	return manager.TargetSize, nil
+}
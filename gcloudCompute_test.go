@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+)
+
+func TestParseInstanceGroupURL(t *testing.T) {
+	group, err := ParseInstanceGroupURL("https://www.googleapis.com/compute/v1/projects/my-project/zones/europe-west1-b/instanceGroupManagers/gke-c-pool-1234-grp")
+
+	if err != nil {
+		t.Fatalf("ParseInstanceGroupURL, expected no error got %v", err)
+	}
+
+	if group.Project != "my-project" || group.Zone != "europe-west1-b" || group.Name != "gke-c-pool-1234-grp" {
+		t.Errorf("ParseInstanceGroupURL, expected my-project/europe-west1-b/gke-c-pool-1234-grp got %v/%v/%v", group.Project, group.Zone, group.Name)
+	}
+
+	_, err = ParseInstanceGroupURL("https://www.googleapis.com/compute/v1/projects/my-project")
+	if err == nil {
+		t.Errorf("ParseInstanceGroupURL, expected an error for an url without zone and name")
+	}
+}
+
+func TestIsInstanceOfGroup(t *testing.T) {
+	group := InstanceGroup{Project: "my-project", Zone: "europe-west1-b", Name: "gke-c-pool-1234-grp"}
+
+	tests := []struct {
+		url      string
+		expected bool
+	}{
+		{"https://www.googleapis.com/compute/v1/projects/my-project/zones/europe-west1-b/instances/gke-c-pool-1234-abcd", true},
+		{"https://www.googleapis.com/compute/v1/projects/my-project/zones/europe-west1-c/instances/gke-c-pool-1234-abcd", false},
+		{"https://www.googleapis.com/compute/v1/projects/other-project/zones/europe-west1-b/instances/gke-c-pool-1234-abcd", false},
+		{"https://www.googleapis.com/compute/v1/projects/my-project/zones/europe-west1-b/instances/gke-c-other-pool-5678-abcd", false},
+		{"https://www.googleapis.com/compute/v1/projects/my-project/zones/europe-west1-b/instances/gke-c-pool-12345-abcd", false},
+	}
+
+	for _, test := range tests {
+		if output := isInstanceOfGroup(test.url, group, "gke-c-pool-1234"); output != test.expected {
+			t.Errorf("isInstanceOfGroup(%v), expected %v got %v", test.url, test.expected, output)
+		}
+	}
+}
+
+func TestIsPendingInstanceGroupOperation(t *testing.T) {
+	group := InstanceGroup{Project: "my-project", Zone: "europe-west1-b", Name: "gke-c-pool-1234-grp"}
+	link := "https://www.googleapis.com/compute/v1/projects/my-project/zones/europe-west1-b/instanceGroupManagers/"
+
+	tests := []struct {
+		operation compute.Operation
+		expected  bool
+	}{
+		{compute.Operation{OperationType: "compute.instanceGroupManagers.resize", Status: "RUNNING", TargetLink: link + "gke-c-pool-1234-grp"}, true},
+		{compute.Operation{OperationType: "compute.instanceGroupManagers.deleteInstances", Status: "PENDING", TargetLink: link + "gke-c-pool-1234-grp"}, true},
+		{compute.Operation{OperationType: "compute.instanceGroupManagers.resize", Status: "DONE", TargetLink: link + "gke-c-pool-1234-grp"}, false},
+		{compute.Operation{OperationType: "compute.instanceGroupManagers.resize", Status: "RUNNING", TargetLink: link + "gke-c-other-pool-5678-grp"}, false},
+		{compute.Operation{OperationType: "compute.instances.preempted", Status: "RUNNING", TargetLink: link + "gke-c-pool-1234-grp"}, false},
+	}
+
+	for _, test := range tests {
+		if output := isPendingInstanceGroupOperation(&test.operation, group); output != test.expected {
+			t.Errorf("isPendingInstanceGroupOperation(%v %v %v), expected %v got %v", test.operation.OperationType, test.operation.Status, test.operation.TargetLink, test.expected, output)
+		}
+	}
+}
+
+func TestParseProviderID(t *testing.T) {
+	project, zone, instance, err := ParseProviderID("gce://my-project/europe-west1-b/gke-c-pool-1234-abcd")
+
+	if err != nil {
+		t.Fatalf("ParseProviderID, expected no error got %v", err)
+	}
+
+	if project != "my-project" || zone != "europe-west1-b" || instance != "gke-c-pool-1234-abcd" {
+		t.Errorf("ParseProviderID, expected my-project/europe-west1-b/gke-c-pool-1234-abcd got %v/%v/%v", project, zone, instance)
+	}
+
+	for _, providerID := range []string{"", "kind://docker/kind/kind-control-plane", "gce://my-project/europe-west1-b", "gce:///europe-west1-b/instance"} {
+		_, _, _, err := ParseProviderID(providerID)
+
+		var providerIDErr *ProviderIDError
+		if !errors.As(err, &providerIDErr) || providerIDErr.ProviderID != providerID {
+			t.Errorf("ParseProviderID(%q), expected a ProviderIDError got %v", providerID, err)
+		}
+	}
+}
+
+func TestGroupManagedInstances(t *testing.T) {
+	grp1 := InstanceGroup{Project: "my-project", Zone: "europe-west1-b", Name: "gke-c-pool-1234-grp"}
+	grp2 := InstanceGroup{Project: "my-project", Zone: "europe-west1-b", Name: "gke-c-pool-5678-grp"}
+
+	url := "https://www.googleapis.com/compute/v1/projects/my-project/zones/europe-west1-b/instances/"
+	managed := map[InstanceGroup][]string{
+		grp1: {url + "gke-c-pool-1234-aaaa", url + "gke-c-pool-1234-bbbb"},
+		grp2: {url + "gke-c-pool-5678-cccc"},
+	}
+
+	grouped, missing := groupManagedInstances(managed, []string{"gke-c-pool-1234-bbbb", "gke-c-pool-5678-cccc", "gke-c-pool-1234-aaaa", "gke-c-pool-9999-dddd"})
+
+	expected := map[InstanceGroup][]string{
+		grp1: {"gke-c-pool-1234-bbbb", "gke-c-pool-1234-aaaa"},
+		grp2: {"gke-c-pool-5678-cccc"},
+	}
+
+	if !reflect.DeepEqual(grouped, expected) {
+		t.Errorf("groupManagedInstances, expected %v got %v", expected, grouped)
+	}
+	if !reflect.DeepEqual(missing, []string{"gke-c-pool-9999-dddd"}) {
+		t.Errorf("groupManagedInstances, expected [gke-c-pool-9999-dddd] missing got %v", missing)
+	}
+}
+
+func TestListManagedInstances(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/my-project/zones/europe-west1-b/instanceGroupManagers/gke-grp/listManagedInstances" {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch r.URL.Query().Get("pageToken") {
+		case "":
+			w.Write([]byte(`{"managedInstances": [{"instance": "zones/europe-west1-b/instances/gke-1"}], "nextPageToken": "page-2"}`))
+		case "page-2":
+			w.Write([]byte(`{"managedInstances": [{"instance": "zones/europe-west1-b/instances/gke-2"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	group := InstanceGroup{Project: "my-project", Zone: "europe-west1-b", Name: "gke-grp"}
+	urls, err := listManagedInstances(context.Background(), server.Client(), server.URL+"/", group)
+
+	expected := []string{"zones/europe-west1-b/instances/gke-1", "zones/europe-west1-b/instances/gke-2"}
+
+	if err != nil || !reflect.DeepEqual(urls, expected) {
+		t.Errorf("listManagedInstances, expected %v got %v %v", expected, urls, err)
+	}
+
+	missing := InstanceGroup{Project: "my-project", Zone: "europe-west1-b", Name: "other-grp"}
+	if _, err := listManagedInstances(context.Background(), server.Client(), server.URL+"/", missing); err == nil {
+		t.Errorf("listManagedInstances of an unknown instance group, expected an error")
+	}
+}
+
+func TestSplitZoneSize(t *testing.T) {
+	a := InstanceGroup{Zone: "europe-west1-b", Name: "gke-a-grp"}
+	b := InstanceGroup{Zone: "europe-west1-b", Name: "gke-b-grp"}
+	c := InstanceGroup{Zone: "europe-west1-b", Name: "gke-c-grp"}
+
+	tests := []struct {
+		groups   []InstanceGroup
+		size     int64
+		expected map[InstanceGroup]int64
+	}{
+		{[]InstanceGroup{a}, 3, map[InstanceGroup]int64{a: 3}},
+		{[]InstanceGroup{a, b}, 4, map[InstanceGroup]int64{a: 2, b: 2}},
+		{[]InstanceGroup{c, b, a}, 5, map[InstanceGroup]int64{a: 2, b: 2, c: 1}},
+		{[]InstanceGroup{a, b}, 0, map[InstanceGroup]int64{a: 0, b: 0}},
+	}
+
+	for _, test := range tests {
+		if output := splitZoneSize(test.groups, test.size); !reflect.DeepEqual(output, test.expected) {
+			t.Errorf("splitZoneSize(%v, %d), expected %v got %v", test.groups, test.size, test.expected, output)
+		}
+	}
+}
@@ -1,25 +1,208 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/api/container/v1beta1"
 )
 
 type GCloudContainer struct {
-	Client  *GCloud
-	Service *container.Service
+	Client     *GCloud
+	Service    *container.Service
+	HTTPClient *http.Client
 }
 
 type GCloudContainerClient interface {
-	SetNodePoolSize(string, int64) error
-	waitForOperation(*container.Operation) error
+	shifter.ContainerClient
+	shifter.CloudClient
+	GetNodePoolInstanceGroups(string) ([]InstanceGroup, error)
+	GetClusterID() string
+	IsAutopilot() (bool, error)
+	IsNodeAutoprovisioningEnabled() (bool, error)
+	waitForOperation(context.Context, *container.Operation) error
 }
 
-// SetNodePoolSize set the size of a given node pool
-func (gc *GCloudContainer) SetNodePoolSize(name string, size int64) (err error) {
+// GetClusterID returns the full name of the cluster the client manages node pools of
+func (gc *GCloudContainer) GetClusterID() string {
+	return fmt.Sprintf("projects/%v/locations/%v/clusters/%v", gc.Client.Project, gc.Client.Location, gc.Client.Cluster)
+}
+
+// IsAutopilot returns whether the cluster runs GKE Autopilot, whose node pools are managed by GKE and can't be resized;
+// the container client in use predates Autopilot, so the field is requested directly
+func (gc *GCloudContainer) IsAutopilot() (autopilot bool, err error) {
+	url := fmt.Sprintf("%vv1beta1/%v?fields=autopilot", gc.Service.BasePath, gc.GetClusterID())
+
+	request, err := http.NewRequestWithContext(gc.Client.Context, http.MethodGet, url, nil)
+	if err != nil {
+		return
+	}
+
+	response, err := gc.HTTPClient.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("Error retrieving cluster %v:\n%v", gc.GetClusterID(), response.Status)
+	}
+
+	var cluster struct {
+		Autopilot *struct {
+			Enabled bool `json:"enabled"`
+		} `json:"autopilot"`
+	}
+
+	if err = json.NewDecoder(response.Body).Decode(&cluster); err != nil {
+		return
+	}
+
+	return cluster.Autopilot != nil && cluster.Autopilot.Enabled, nil
+}
+
+// IsNodeAutoprovisioningEnabled returns whether node auto-provisioning may create node pools in the cluster
+func (gc *GCloudContainer) IsNodeAutoprovisioningEnabled() (enabled bool, err error) {
+	cluster, err := gc.Service.Projects.Locations.Clusters.Get(gc.GetClusterID()).Context(gc.Client.Context).Do()
+
+	if err != nil {
+		return
+	}
+
+	return cluster.Autoscaling != nil && cluster.Autoscaling.EnableNodeAutoprovisioning, nil
+}
+
+// GetNodePoolLocations returns the zones the nodes of a given node pool are spread over
+func (gc *GCloudContainer) GetNodePoolLocations(name string) (locations []string, err error) {
+	apiName := fmt.Sprintf("projects/%v/locations/%v/clusters/%v/nodePools/%v", gc.Client.Project, gc.Client.Location, gc.Client.Cluster, name)
+
+	nodePool, err := gc.Service.Projects.Locations.Clusters.NodePools.Get(apiName).Context(gc.Client.Context).Do()
+
+	if err != nil {
+		return
+	}
+
+	locations = nodePool.Locations
+
+	return
+}
+
+// GetNodePoolInstanceGroupURLs returns the urls of the managed instance groups backing a given node pool
+func (gc *GCloudContainer) GetNodePoolInstanceGroupURLs(name string) (urls []string, err error) {
+	apiName := fmt.Sprintf("projects/%v/locations/%v/clusters/%v/nodePools/%v", gc.Client.Project, gc.Client.Location, gc.Client.Cluster, name)
+
+	nodePool, err := gc.Service.Projects.Locations.Clusters.NodePools.Get(apiName).Context(gc.Client.Context).Do()
+
+	if err != nil {
+		return
+	}
+
+	return nodePool.InstanceGroupUrls, nil
+}
+
+// GetNodePoolInstanceGroups returns all the managed instance groups backing a given node pool
+func (gc *GCloudContainer) GetNodePoolInstanceGroups(name string) (groups []InstanceGroup, err error) {
+	urls, err := gc.GetNodePoolInstanceGroupURLs(name)
+
+	if err != nil {
+		return
+	}
+
+	for _, url := range urls {
+		group, err := ParseInstanceGroupURL(url)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return
+}
+
+// CountPreemptions counts the instances of a given node pool preempted in the given zones since the given time, looking
+// up the instances in the project of the node pool with the credentials of the client
+func (gc *GCloudContainer) CountPreemptions(name string, zones []string, since time.Time) (count int, err error) {
+	groups, err := gc.GetNodePoolInstanceGroups(name)
+
+	if err != nil {
+		return
+	}
+
+	return gc.Client.CountPreemptions(groups, zones, since)
+}
+
+// GetMaintenanceExclusions returns the maintenance exclusion windows configured on the cluster
+func (gc *GCloudContainer) GetMaintenanceExclusions() (exclusions []shifter.MaintenanceExclusion, err error) {
+	apiName := fmt.Sprintf("projects/%v/locations/%v/clusters/%v", gc.Client.Project, gc.Client.Location, gc.Client.Cluster)
+
+	cluster, err := gc.Service.Projects.Locations.Clusters.Get(apiName).Context(gc.Client.Context).Do()
+
+	if err != nil {
+		return
+	}
+
+	if cluster.MaintenancePolicy == nil || cluster.MaintenancePolicy.Window == nil {
+		return
+	}
+
+	for name, window := range cluster.MaintenancePolicy.Window.MaintenanceExclusions {
+		exclusion, err := shifter.ParseMaintenanceExclusion(name, window.StartTime, window.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		exclusions = append(exclusions, exclusion)
+	}
+
+	return
+}
+
+// GetPendingResizeOperation returns the name of a resize operation that hasn't finished yet on a given node pool, empty
+// if there is none; besides resizes of the node pool, resizes and instance deletions on its instance groups count too.
+// Since our own resizes are awaited, a pending one was started by someone else
+func (gc *GCloudContainer) GetPendingResizeOperation(name string) (operationName string, err error) {
+	apiName := fmt.Sprintf("projects/%v/locations/%v", gc.Client.Project, gc.Client.Location)
+
+	response, err := gc.Service.Projects.Locations.Operations.List(apiName).Context(gc.Client.Context).Do()
+
+	if err != nil {
+		return
+	}
+
+	for _, operation := range response.Operations {
+		if operation.OperationType != "SET_NODE_POOL_SIZE" || operation.Status == "DONE" {
+			continue
+		}
+
+		if strings.HasSuffix(operation.TargetLink, fmt.Sprintf("/clusters/%v/nodePools/%v", gc.Client.Cluster, name)) {
+			return operation.Name, nil
+		}
+	}
+
+	groups, err := gc.GetNodePoolInstanceGroups(name)
+
+	if err != nil {
+		return
+	}
+
+	for _, group := range groups {
+		operationName, err = gc.Client.GetPendingInstanceGroupOperation(group)
+
+		if err != nil || operationName != "" {
+			return
+		}
+	}
+
+	return
+}
+
+// SetNodePoolSize set the size of a given node pool, giving up when the context is done
+func (gc *GCloudContainer) SetNodePoolSize(ctx context.Context, name string, size int64) (err error) {
 
 	apiName := fmt.Sprintf("projects/%v/locations/%v/clusters/%v/nodePools/%v", gc.Client.Project, gc.Client.Location, gc.Client.Cluster, name)
 
@@ -27,28 +210,141 @@ func (gc *GCloudContainer) SetNodePoolSize(name string, size int64) (err error)
 		NodeCount: size,
 	}
 
-	operation, err := gc.Service.Projects.Locations.Clusters.NodePools.SetSize(apiName, nodePoolSizeRequest).Context(gc.Client.Context).Do()
+	operation, err := gc.Service.Projects.Locations.Clusters.NodePools.SetSize(apiName, nodePoolSizeRequest).Context(ctx).Do()
+
+	if err != nil {
+		return
+	}
+
+	shifter.RecordOperation(ctx, shifter.Operation{
+		Name:      operation.Name,
+		Kind:      "set_node_pool_size",
+		Target:    name,
+		StartedAt: time.Now(),
+	})
+
+	err = gc.waitForOperation(ctx, operation)
+
+	return
+}
+
+// DeleteNodePoolInstances deletes instances of a given node pool in a given zone with a single request per instance
+// group managing some of them, a zone can be backed by several instance groups
+func (gc *GCloudContainer) DeleteNodePoolInstances(ctx context.Context, name, zone string, instances []string) (err error) {
+	if len(instances) == 0 {
+		return
+	}
+
+	groups, err := gc.GetNodePoolInstanceGroups(name)
+
+	if err != nil {
+		return
+	}
+
+	grouped, err := gc.Client.GroupInstances(groups, zone, instances)
+
+	if err != nil {
+		return
+	}
+
+	// instance groups are taken in the order the node pool lists them, so retries delete in the same order
+	for _, group := range groups {
+		if len(grouped[group]) == 0 {
+			continue
+		}
+
+		if err = gc.Client.DeleteInstances(ctx, group, grouped[group]); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// DeleteNodePool deletes a given node pool
+func (gc *GCloudContainer) DeleteNodePool(ctx context.Context, name string) (err error) {
+	apiName := fmt.Sprintf("projects/%v/locations/%v/clusters/%v/nodePools/%v", gc.Client.Project, gc.Client.Location, gc.Client.Cluster, name)
+
+	operation, err := gc.Service.Projects.Locations.Clusters.NodePools.Delete(apiName).Context(ctx).Do()
+
+	if err != nil {
+		return
+	}
+
+	shifter.RecordOperation(ctx, shifter.Operation{
+		Name:      operation.Name,
+		Kind:      "delete_node_pool",
+		Target:    name,
+		StartedAt: time.Now(),
+	})
+
+	err = gc.waitForOperation(ctx, operation)
+
+	return
+}
+
+// GetNodePoolTargetSizes returns the number of nodes GKE targets for a given node pool in each zone, summed over the
+// instance groups of the zone
+func (gc *GCloudContainer) GetNodePoolTargetSizes(name string) (sizes map[string]int, err error) {
+	groups, err := gc.GetNodePoolInstanceGroups(name)
 
 	if err != nil {
 		return
 	}
 
-	err = gc.waitForOperation(operation)
+	sizes = map[string]int{}
+	for _, group := range groups {
+		size, err := gc.Client.GetInstanceGroupTargetSize(gc.Client.Context, group)
+		if err != nil {
+			return nil, err
+		}
+		sizes[group.Zone] += int(size)
+	}
 
 	return
 }
 
-// waitForOperation wait for a GCloud operation to finish
-func (gc *GCloudContainer) waitForOperation(operation *container.Operation) (err error) {
+// SetNodePoolZoneSize sets the number of nodes of a given node pool in a single zone, through the instance groups of the
+// node pool in that zone; a zone backed by several instance groups has the size spread over them
+func (gc *GCloudContainer) SetNodePoolZoneSize(ctx context.Context, name, zone string, size int64) (err error) {
+	groups, err := gc.GetNodePoolInstanceGroups(name)
+
+	if err != nil {
+		return
+	}
+
+	zoneGroups := []InstanceGroup{}
+	for _, group := range groups {
+		if group.Zone == zone {
+			zoneGroups = append(zoneGroups, group)
+		}
+	}
+
+	if len(zoneGroups) == 0 {
+		return fmt.Errorf("Node pool %v has no instance group in zone %v", name, zone)
+	}
+
+	sizes := splitZoneSize(zoneGroups, size)
+
+	for _, group := range zoneGroups {
+		if err = gc.Client.ResizeInstanceGroup(ctx, group, sizes[group]); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// waitForOperation wait for a GCloud operation to finish, giving up when the context is done
+func (gc *GCloudContainer) waitForOperation(ctx context.Context, operation *container.Operation) (err error) {
 	start := time.Now()
 	timeout := operationWaitTimeoutSecond * time.Second
+	apiName := fmt.Sprintf("projects/%v/locations/%v/operations/%v", gc.Client.Project, gc.Client.Location, operation.Name)
 
 	for {
-		apiName := fmt.Sprintf("projects/%v/locations/%v/operations/%v", gc.Client.Project, gc.Client.Location, operation.Name)
-
 		log.Debug().Msgf("Waiting for operation %v", apiName)
 
-		if op, err := gc.Service.Projects.Locations.Operations.Get(apiName).Do(); err == nil {
+		if op, err := gc.Service.Projects.Locations.Operations.Get(apiName).Context(ctx).Do(); err == nil {
 			log.Debug().Msgf("Operation %v status: %s", apiName, op.Status)
 
 			if op.Status == "DONE" {
@@ -59,14 +355,20 @@ func (gc *GCloudContainer) waitForOperation(operation *container.Operation) (err
 		}
 
 		if time.Since(start) > timeout {
-			err = fmt.Errorf("Timeout while waiting for operation %v on %s to complete", apiName, operation.TargetLink)
-			return
+			break
 		}
 
-		sleepTime := ApplyJitter(operationPollIntervalSecond)
+		sleepTime := gc.Client.Jitter.Apply(operationPollIntervalSecond)
 		log.Info().Msgf("Sleeping for %v seconds...", sleepTime)
-		time.Sleep(time.Duration(sleepTime) * time.Second)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Gave up waiting for operation %v on %s: %v", apiName, operation.TargetLink, ctx.Err())
+		case <-time.After(time.Duration(sleepTime) * time.Second):
+		}
 	}
 
+	err = fmt.Errorf("Timeout while waiting for operation %v on %s to complete", apiName, operation.TargetLink)
+
 	return
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	monitoring "google.golang.org/api/monitoring/v3"
+)
+
+const (
+	// cloudMonitoringMetricPrefix is the prefix of the custom metrics written to Cloud Monitoring
+	cloudMonitoringMetricPrefix = "custom.googleapis.com/estafette_gke_node_pool_shifter/"
+)
+
+type GCloudMonitoring struct {
+	Client       *GCloud
+	Service      *monitoring.Service
+	NodePoolFrom string
+	NodePoolTo   string
+	Start        time.Time
+	Totals       map[string]int64
+}
+
+type GCloudMonitoringClient interface {
+	WriteCycle(string, int, int) error
+}
+
+// WriteCycle writes the cumulative shift count per status and the current node pool sizes as custom metrics
+func (gm *GCloudMonitoring) WriteCycle(status string, fromSize, toSize int) (err error) {
+	gm.Totals[status]++
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	start := gm.Start.UTC().Format(time.RFC3339)
+
+	timeSeries := []*monitoring.TimeSeries{}
+
+	statuses := []string{}
+	for s := range gm.Totals {
+		statuses = append(statuses, s)
+	}
+	sort.Strings(statuses)
+
+	for _, s := range statuses {
+		timeSeries = append(timeSeries, gm.newTimeSeries("shift_count", "CUMULATIVE", map[string]string{"status": s}, start, now, gm.Totals[s]))
+	}
+
+	timeSeries = append(timeSeries,
+		gm.newTimeSeries("pool_size", "GAUGE", map[string]string{"node_pool": gm.NodePoolFrom}, "", now, int64(fromSize)),
+		gm.newTimeSeries("pool_size", "GAUGE", map[string]string{"node_pool": gm.NodePoolTo}, "", now, int64(toSize)),
+	)
+
+	request := &monitoring.CreateTimeSeriesRequest{
+		TimeSeries: timeSeries,
+	}
+
+	_, err = gm.Service.Projects.TimeSeries.Create(fmt.Sprintf("projects/%v", gm.Client.Project), request).Context(gm.Client.Context).Do()
+
+	return
+}
+
+// newTimeSeries returns a single point time series for a custom metric on the cluster resource
+func (gm *GCloudMonitoring) newTimeSeries(name, kind string, labels map[string]string, start, end string, value int64) *monitoring.TimeSeries {
+	labels["from_pool"] = gm.NodePoolFrom
+	labels["to_pool"] = gm.NodePoolTo
+
+	return &monitoring.TimeSeries{
+		Metric: &monitoring.Metric{
+			Type:   cloudMonitoringMetricPrefix + name,
+			Labels: labels,
+		},
+		Resource: &monitoring.MonitoredResource{
+			Type: "k8s_cluster",
+			Labels: map[string]string{
+				"project_id":   gm.Client.Project,
+				"location":     gm.Client.Location,
+				"cluster_name": gm.Client.Cluster,
+			},
+		},
+		MetricKind: kind,
+		ValueType:  "INT64",
+		Points: []*monitoring.Point{
+			{
+				Interval: &monitoring.TimeInterval{
+					StartTime: start,
+					EndTime:   end,
+				},
+				Value: &monitoring.TypedValue{
+					Int64Value: &value,
+				},
+			},
+		},
+	}
+}
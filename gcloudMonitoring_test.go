@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	monitoring "google.golang.org/api/monitoring/v3"
+	"google.golang.org/api/option"
+)
+
+func TestGCloudMonitoringWriteCycle(t *testing.T) {
+	var path string
+	var received monitoring.CreateTimeSeriesRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		received = monitoring.CreateTimeSeriesRequest{}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	service, err := monitoring.NewService(context.Background(), option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("NewService, expected no error got %v", err)
+	}
+
+	gm := &GCloudMonitoring{
+		Client:       &GCloud{Project: "my-project", Location: "europe-west1", Cluster: "production", Context: context.Background()},
+		Service:      service,
+		NodePoolFrom: "default-pool",
+		NodePoolTo:   "preemptible-pool",
+		Start:        time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC),
+		Totals:       map[string]int64{},
+	}
+
+	for _, status := range []string{"shifted", "skipped", "shifted"} {
+		if err := gm.WriteCycle(status, 3, 2); err != nil {
+			t.Fatalf("WriteCycle(%v), expected no error got %v", status, err)
+		}
+	}
+
+	if path != "/v3/projects/my-project/timeSeries" {
+		t.Errorf("WriteCycle, expected the time series of my-project to be created got %v", path)
+	}
+
+	expected := []struct {
+		metric string
+		kind   string
+		label  string
+		value  int64
+	}{
+		{cloudMonitoringMetricPrefix + "shift_count", "CUMULATIVE", "shifted", 2},
+		{cloudMonitoringMetricPrefix + "shift_count", "CUMULATIVE", "skipped", 1},
+		{cloudMonitoringMetricPrefix + "pool_size", "GAUGE", "default-pool", 3},
+		{cloudMonitoringMetricPrefix + "pool_size", "GAUGE", "preemptible-pool", 2},
+	}
+
+	if len(received.TimeSeries) != len(expected) {
+		t.Fatalf("WriteCycle, expected %d time series got %d", len(expected), len(received.TimeSeries))
+	}
+
+	for i, e := range expected {
+		series := received.TimeSeries[i]
+		label := series.Metric.Labels["status"] + series.Metric.Labels["node_pool"]
+
+		if series.Metric.Type != e.metric || series.MetricKind != e.kind || label != e.label || *series.Points[0].Value.Int64Value != e.value {
+			t.Errorf("WriteCycle, expected %v %v %v %d got %v %v %v %d", e.metric, e.kind, e.label, e.value, series.Metric.Type, series.MetricKind, label, *series.Points[0].Value.Int64Value)
+		}
+
+		if series.Metric.Labels["from_pool"] != "default-pool" || series.Metric.Labels["to_pool"] != "preemptible-pool" {
+			t.Errorf("WriteCycle, expected the node pools as labels got %v", series.Metric.Labels)
+		}
+
+		if series.Resource.Labels["cluster_name"] != "production" || series.Resource.Labels["location"] != "europe-west1" {
+			t.Errorf("WriteCycle, expected the cluster as resource got %v", series.Resource.Labels)
+		}
+	}
+
+	if start := received.TimeSeries[0].Points[0].Interval.StartTime; start != "2021-09-01T10:00:00Z" {
+		t.Errorf("WriteCycle, expected the shift count to be cumulative since 2021-09-01T10:00:00Z got %v", start)
+	}
+}
@@ -1,37 +1,16 @@
 package main
 
 import (
-	"math/rand"
-	"time"
+	"strings"
 )
 
-// seed random number
-var R = rand.New(rand.NewSource(time.Now().UnixNano()))
-
-// ApplyJitter return a random number
-func ApplyJitter(input int) (output int) {
-	deviation := int(0.25 * float64(input))
-	return input - deviation + rand.Intn(2*deviation)
-}
-
-func FindMinAndMax(a []int) (min int, max int) {
-	min = a[0]
-	max = a[0]
-	for _, value := range a {
-		if value < min {
-			min = value
-		}
-		if value > max {
-			max = value
+// SplitList splits a comma separated list, ignoring empty items and surrounding whitespace
+func SplitList(input string) (output []string) {
+	for _, item := range strings.Split(input, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			output = append(output, item)
 		}
 	}
-	return min, max
-}
-
-func Sum(array []int) int {
-	result := 0
-	for _, v := range array {
-		result += v
-	}
-	return result
+	return
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
+	"github.com/rs/zerolog/log"
+)
+
+// maxHistorySnapshots bounds the memory the history takes whatever its window, e.g. with a very short interval
+const maxHistorySnapshots = 10000
+
+// CycleSnapshot is a point of the cycle history, flat so dashboards can plot each field as a time series
+type CycleSnapshot struct {
+	Time              time.Time              `json:"time"`
+	Status            string                 `json:"status"`
+	SkipReason        string                 `json:"skipReason,omitempty"`
+	Decision          string                 `json:"decision"`
+	NodePoolFromNodes int                    `json:"nodePoolFromNodes"`
+	NodePoolToNodes   int                    `json:"nodePoolToNodes"`
+	ShiftedNodes      int                    `json:"shiftedNodes"`
+	PoolSizes         []shifter.PoolZoneSize `json:"poolSizes,omitempty"`
+}
+
+// History keeps the snapshots of the cycles within a window in memory, oldest first; it's safe for concurrent use
+type History struct {
+	Window time.Duration
+
+	mutex     sync.Mutex
+	snapshots []CycleSnapshot
+}
+
+// NewHistory returns an empty history keeping the cycles of the given window
+func NewHistory(window time.Duration) *History {
+	return &History{Window: window}
+}
+
+// Record adds a snapshot of a cycle ended at the given time, dropping the snapshots that fell out of the window
+func (h *History) Record(at time.Time, status string, state *shifter.CycleState) {
+	snapshot := CycleSnapshot{
+		Time:              at,
+		Status:            status,
+		SkipReason:        state.SkipReason,
+		Decision:          state.Decision,
+		NodePoolFromNodes: state.ZonesFrom.Sum(),
+		NodePoolToNodes:   state.ZonesTo.Sum(),
+		PoolSizes:         state.PoolSizes,
+	}
+
+	if status == "shifted" {
+		snapshot.ShiftedNodes = len(state.Victims)
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.snapshots = append(h.snapshots, snapshot)
+
+	start := 0
+	for start < len(h.snapshots) && h.snapshots[start].Time.Before(at.Add(-h.Window)) {
+		start++
+	}
+	if len(h.snapshots)-start > maxHistorySnapshots {
+		start = len(h.snapshots) - maxHistorySnapshots
+	}
+
+	h.snapshots = h.snapshots[start:]
+}
+
+// List returns the snapshots since the given time, oldest first
+func (h *History) List(since time.Time) []CycleSnapshot {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	snapshots := []CycleSnapshot{}
+	for _, snapshot := range h.snapshots {
+		if !snapshot.Time.Before(since) {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+
+	return snapshots
+}
+
+// ServeHTTP serves the snapshots as json, all of them or those of the last ?range=<duration>, e.g. ?range=6h
+func (h *History) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	since := time.Time{}
+
+	if value := r.URL.Query().Get("range"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			http.Error(w, "Invalid range: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		since = time.Now().Add(-duration)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(h.List(since)); err != nil {
+		log.Error().Err(err).Msg("Error writing history response")
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
+)
+
+func TestHistoryRecord(t *testing.T) {
+	history := NewHistory(time.Hour)
+	start := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	history.Record(start, "skipped", &shifter.CycleState{ZonesFrom: shifter.ZoneStats{"europe-west1-b": {Total: 2}, "europe-west1-c": {Total: 2}}, SkipReason: "cooldown"})
+	history.Record(start.Add(30*time.Minute), "shifted", &shifter.CycleState{
+		ZonesFrom: shifter.ZoneStats{"europe-west1-b": {Total: 1}, "europe-west1-c": {Total: 2}},
+		ZonesTo:   shifter.ZoneStats{"europe-west1-b": {Total: 1}, "europe-west1-c": {Total: 1}},
+		Victims:   []shifter.Victim{{Node: "node-1"}},
+	})
+	history.Record(start.Add(90*time.Minute), "skipped", &shifter.CycleState{ZonesFrom: shifter.ZoneStats{"europe-west1-b": {Total: 1}, "europe-west1-c": {Total: 1}}, SkipReason: "at_minimum"})
+
+	snapshots := history.List(time.Time{})
+
+	if len(snapshots) != 2 {
+		t.Fatalf("Record, expected the snapshot out of the window to be dropped got %d snapshot(s)", len(snapshots))
+	}
+	if snapshots[0].Status != "shifted" || snapshots[0].NodePoolFromNodes != 3 || snapshots[0].ShiftedNodes != 1 {
+		t.Errorf("Record, expected the shift with 3 nodes left and 1 node shifted got %+v", snapshots[0])
+	}
+
+	if recent := history.List(start.Add(time.Hour)); len(recent) != 1 || recent[0].SkipReason != "at_minimum" {
+		t.Errorf("List, expected the last snapshot only got %+v", recent)
+	}
+}
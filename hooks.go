@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
+	"github.com/rs/zerolog/log"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// jobHookPrefix marks a shift hook run as a Job created from a CronJob of the namespace of the shifter, e.g.
+// job://warm-caches, like kubectl create job --from=cronjob/warm-caches
+const jobHookPrefix = "job://"
+
+// jobHookPollIntervalSecond define the interval in second before each status check of a hook Job
+const jobHookPollIntervalSecond = 10
+
+// NewShiftHook returns the shift hook configured by a flag value: a Job for a job://<cronjob> value, a webhook for an
+// http or https url
+func NewShiftHook(value string, k KubernetesClient) (shifter.ShiftHook, error) {
+	switch {
+	case strings.HasPrefix(value, jobHookPrefix) && len(value) > len(jobHookPrefix):
+		return &JobHook{Kubernetes: k, CronJob: strings.TrimPrefix(value, jobHookPrefix)}, nil
+	case strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://"):
+		return &ShiftWebhook{URL: value, Client: &http.Client{}}, nil
+	}
+
+	return nil, fmt.Errorf("Shift hook %v is neither a job://<cronjob> nor an http(s) url", value)
+}
+
+// ShiftWebhook runs a shift hook by posting it to an external endpoint, any 2xx response is a success
+type ShiftWebhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// Run posts the hook and the shift, until the shift deadline
+func (w *ShiftWebhook) Run(ctx context.Context, request shifter.ShiftHookRequest) (err error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	response, err := w.Client.Do(httpRequest)
+	if err != nil {
+		return fmt.Errorf("Error posting to shift hook:\n%v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		responseBody, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("Shift hook responded with %v: %v", response.Status, strings.TrimSpace(string(responseBody)))
+	}
+
+	return
+}
+
+// JobHook runs a shift hook as a Job created from the template of a CronJob, which is usually suspended; the hook and
+// the shift are passed to its containers as environment variables
+type JobHook struct {
+	Kubernetes KubernetesClient
+	CronJob    string
+}
+
+// Run creates the Job and waits for it to succeed, until the shift deadline
+func (j *JobHook) Run(ctx context.Context, request shifter.ShiftHookRequest) error {
+	env := []v1.EnvVar{
+		{Name: "SHIFT_HOOK", Value: request.Hook},
+		{Name: "SHIFT_CLUSTER", Value: request.Cluster},
+		{Name: "SHIFT_NODE_POOL_FROM", Value: request.Shift.NodePoolFrom},
+		{Name: "SHIFT_NODE_POOL_TO", Value: request.Shift.NodePoolTo},
+		{Name: "SHIFT_NODES", Value: strings.Join(request.Shift.Victims, ",")},
+	}
+
+	name, err := j.Kubernetes.CreateJobFromCronJob(j.CronJob, request.Hook, env)
+	if err != nil {
+		return fmt.Errorf("Error creating hook job from cronjob %v:\n%v", j.CronJob, err)
+	}
+
+	log.Info().
+		Str("job", name).
+		Str("hook", request.Hook).
+		Msg("Waiting for hook job to complete...")
+
+	for {
+		job, err := j.Kubernetes.GetJob(name)
+
+		if err == nil {
+			if done, err := jobOutcome(*job); done {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Hook job %v didn't complete before the shift deadline: %v", name, ctx.Err())
+		case <-time.After(jobHookPollIntervalSecond * time.Second):
+		}
+	}
+}
+
+// jobOutcome returns whether a Job is done, with an error if it failed
+func jobOutcome(job batchv1.Job) (done bool, err error) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != v1.ConditionTrue {
+			continue
+		}
+
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return true, nil
+		case batchv1.JobFailed:
+			return true, fmt.Errorf("Hook job %v failed: %v", job.Name, condition.Message)
+		}
+	}
+
+	return false, nil
+}
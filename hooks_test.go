@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestNewShiftHook(t *testing.T) {
+	hook, err := NewShiftHook("job://warm-caches", nil)
+	if jobHook, ok := hook.(*JobHook); err != nil || !ok || jobHook.CronJob != "warm-caches" {
+		t.Errorf("NewShiftHook(job://warm-caches), expected a job hook for cronjob warm-caches got %v %v", hook, err)
+	}
+
+	hook, err = NewShiftHook("https://hooks.example.com/shift", nil)
+	if webhook, ok := hook.(*ShiftWebhook); err != nil || !ok || webhook.URL != "https://hooks.example.com/shift" {
+		t.Errorf("NewShiftHook(https://hooks.example.com/shift), expected a webhook got %v %v", hook, err)
+	}
+
+	for _, value := range []string{"job://", "warm-caches", "ftp://hooks.example.com"} {
+		if _, err := NewShiftHook(value, nil); err == nil {
+			t.Errorf("NewShiftHook(%v), expected an error", value)
+		}
+	}
+}
+
+func TestJobOutcome(t *testing.T) {
+	job := func(conditionType batchv1.JobConditionType, status v1.ConditionStatus) batchv1.Job {
+		return batchv1.Job{Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: conditionType, Status: status}}}}
+	}
+
+	if done, err := jobOutcome(batchv1.Job{}); done || err != nil {
+		t.Errorf("jobOutcome, expected a running job not to be done got %v %v", done, err)
+	}
+	if done, err := jobOutcome(job(batchv1.JobComplete, v1.ConditionTrue)); !done || err != nil {
+		t.Errorf("jobOutcome, expected a complete job to succeed got %v %v", done, err)
+	}
+	if done, err := jobOutcome(job(batchv1.JobFailed, v1.ConditionTrue)); !done || err == nil {
+		t.Errorf("jobOutcome, expected a failed job to fail got %v %v", done, err)
+	}
+	if done, _ := jobOutcome(job(batchv1.JobFailed, v1.ConditionFalse)); done {
+		t.Errorf("jobOutcome, expected a job with a false failed condition not to be done")
+	}
+}
@@ -2,31 +2,61 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
 	"github.com/rs/zerolog/log"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+const (
+	// autoscalerStatusNamespace is the namespace the cluster-autoscaler writes its status ConfigMap to
+	autoscalerStatusNamespace = "kube-system"
+
+	// autoscalerStatusName is the name of the cluster-autoscaler status ConfigMap
+	autoscalerStatusName = "cluster-autoscaler-status"
+)
+
+// productionPattern matches the kubeconfig contexts and cluster server hosts that look like production
+var productionPattern = regexp.MustCompile(`(?i)prod`)
+
 type K8s struct {
-	Client  *kubernetes.Clientset
-	Context context.Context
+	Client       *kubernetes.Clientset
+	Context      context.Context
+	Namespace    string
+	ZonesInclude []string
+	ZonesExclude []string
 }
 
 type KubernetesClient interface {
+	shifter.KubernetesClient
 	GetNode(string) (*v1.Node, error)
-	GetNodeList(string) (*v1.NodeList, error)
-	GetZones(string) ([]int, error)
+	CreateJobFromCronJob(string, string, []v1.EnvVar) (string, error)
+	GetJob(string) (*batchv1.Job, error)
+	ReplaceConfigMap(*v1.ConfigMap) error
 }
 
-// NewKubernetesClient returns a Kubernetes client
-func NewKubernetesClient(host string, port string, namespace string, kubeConfigPath string) (k8s KubernetesClient, err error) {
+// NewKubernetesClient returns a Kubernetes client; out of cluster the given kubeconfig context is used, or the current
+// one when empty, and a production looking context or cluster is refused unless confirmed
+func NewKubernetesClient(host string, port string, namespace string, kubeConfigPath string, kubeContext string, confirmProduction bool, zonesInclude []string, zonesExclude []string) (k8s KubernetesClient, err error) {
 	var client *kubernetes.Clientset
 
 	if len(host) > 0 && len(port) > 0 {
@@ -39,7 +69,7 @@ func NewKubernetesClient(host string, port string, namespace string, kubeConfigP
 		}
 	} else {
 		log.Info().Msg("creating out of cluster client")
-		client, err = loadOutOfClusterK8sClient(kubeConfigPath)
+		client, err = loadOutOfClusterK8sClient(kubeConfigPath, kubeContext, confirmProduction)
 
 		if err != nil {
 			err = fmt.Errorf("Error loading client using kubeconfig:\n%v", err)
@@ -47,9 +77,16 @@ func NewKubernetesClient(host string, port string, namespace string, kubeConfigP
 		}
 	}
 
+	if namespace == "" {
+		namespace = "default"
+	}
+
 	k8s = &K8s{
-		Client:  client,
-		Context: context.Background(),
+		Client:       client,
+		Context:      context.Background(),
+		Namespace:    namespace,
+		ZonesInclude: zonesInclude,
+		ZonesExclude: zonesExclude,
 	}
 
 	return
@@ -77,13 +114,182 @@ func (k *K8s) GetNodeList(name string) (nodes *v1.NodeList, err error) {
 	return
 }
 
-// GetZones returns a list with the count of nodes per zone
-func (k *K8s) GetZones(name string) (zones []int, err error) {
-	zones = []int{}
-	opts := metav1.ListOptions{}
-	availableZones, err := k.determineZones(name)
+// GetPodsOnNode returns the pods scheduled on a given node
+func (k *K8s) GetPodsOnNode(name string) (pods *v1.PodList, err error) {
+	opts := metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", name).String(),
+	}
+
+	pods, err = k.Client.CoreV1().Pods("").List(k.Context, opts)
+	return
+}
+
+// GetPods returns the pods of a given namespace matching a given label selector
+func (k *K8s) GetPods(namespace, selector string) (pods *v1.PodList, err error) {
+	pods, err = k.Client.CoreV1().Pods(namespace).List(k.Context, metav1.ListOptions{LabelSelector: selector})
+	return
+}
+
+// GetHorizontalPodAutoscalers returns the HorizontalPodAutoscalers of a given namespace, all namespaces for *
+func (k *K8s) GetHorizontalPodAutoscalers(namespace string) (hpas *autoscalingv1.HorizontalPodAutoscalerList, err error) {
+	if namespace == "*" {
+		namespace = metav1.NamespaceAll
+	}
+
+	hpas, err = k.Client.AutoscalingV1().HorizontalPodAutoscalers(namespace).List(k.Context, metav1.ListOptions{})
+	return
+}
+
+// SetNodeUnschedulable cordons or uncordons a given node
+func (k *K8s) SetNodeUnschedulable(name string, unschedulable bool) (err error) {
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable)
+
+	_, err = k.Client.CoreV1().Nodes().Patch(k.Context, name, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{})
+	return
+}
+
+// SetNodeLabels adds or updates labels of a given node, leaving its other labels untouched
+func (k *K8s) SetNodeLabels(name string, nodeLabels map[string]string) (err error) {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": nodeLabels,
+		},
+	})
+
 	if err != nil {
-		return nil, err
+		return
+	}
+
+	_, err = k.Client.CoreV1().Nodes().Patch(k.Context, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return
+}
+
+// SetNodeAnnotations adds or updates annotations of a given node, leaving its other annotations untouched; an empty
+// value removes the annotation
+func (k *K8s) SetNodeAnnotations(name string, nodeAnnotations map[string]string) (err error) {
+	annotations := map[string]interface{}{}
+	for key, value := range nodeAnnotations {
+		if value == "" {
+			annotations[key] = nil
+			continue
+		}
+		annotations[key] = value
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+
+	if err != nil {
+		return
+	}
+
+	_, err = k.Client.CoreV1().Nodes().Patch(k.Context, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return
+}
+
+// EvictPod evicts a given pod, respecting its pod disruption budgets
+func (k *K8s) EvictPod(pod v1.Pod) (err error) {
+	eviction := &policyv1beta1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+	}
+
+	err = k.Client.CoreV1().Pods(pod.Namespace).EvictV1beta1(k.Context, eviction)
+	return
+}
+
+// GetPersistentVolumes returns all PersistentVolumes of the cluster
+func (k *K8s) GetPersistentVolumes() (pvs *v1.PersistentVolumeList, err error) {
+	pvs, err = k.Client.CoreV1().PersistentVolumes().List(k.Context, metav1.ListOptions{})
+	return
+}
+
+// CreatePod creates a pod in the namespace the application runs in
+func (k *K8s) CreatePod(pod *v1.Pod) (*v1.Pod, error) {
+	return k.Client.CoreV1().Pods(k.Namespace).Create(k.Context, pod, metav1.CreateOptions{})
+}
+
+// GetPod returns a pod from the namespace the application runs in
+func (k *K8s) GetPod(name string) (*v1.Pod, error) {
+	return k.Client.CoreV1().Pods(k.Namespace).Get(k.Context, name, metav1.GetOptions{})
+}
+
+// DeletePod deletes a pod from the namespace the application runs in right away, a pod already gone isn't an error
+func (k *K8s) DeletePod(name string) (err error) {
+	gracePeriod := int64(0)
+	err = k.Client.CoreV1().Pods(k.Namespace).Delete(k.Context, name, metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod})
+
+	if errors.IsNotFound(err) {
+		return nil
+	}
+
+	return
+}
+
+// CreateJobFromCronJob creates a Job from the template of a CronJob in the namespace the application runs in, adding the
+// given environment variables to its containers, and returns the name of the Job
+func (k *K8s) CreateJobFromCronJob(cronJobName, suffix string, env []v1.EnvVar) (name string, err error) {
+	cronJob, err := k.Client.BatchV1beta1().CronJobs(k.Namespace).Get(k.Context, cronJobName, metav1.GetOptions{})
+	if err != nil {
+		return
+	}
+
+	spec := *cronJob.Spec.JobTemplate.Spec.DeepCopy()
+	for i := range spec.Template.Spec.Containers {
+		spec.Template.Spec.Containers[i].Env = append(spec.Template.Spec.Containers[i].Env, env...)
+	}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        jobName(cronJobName, suffix, time.Now()),
+			Labels:      cronJob.Spec.JobTemplate.Labels,
+			Annotations: map[string]string{"cronjob.kubernetes.io/instantiate": "manual"},
+		},
+		Spec: spec,
+	}
+
+	job, err = k.Client.BatchV1().Jobs(k.Namespace).Create(k.Context, job, metav1.CreateOptions{})
+	if err != nil {
+		return
+	}
+
+	return job.Name, nil
+}
+
+// jobName returns the name of a Job created from a CronJob with the given suffix at a given time, the name of the
+// CronJob is truncated so the Job name fits in the 63 characters of the job-name label of its pods
+func jobName(cronJobName, suffix string, now time.Time) string {
+	tail := fmt.Sprintf("-%v-%d", strings.ReplaceAll(suffix, "_", "-"), now.Unix())
+
+	if len(cronJobName)+len(tail) > validation.DNS1123LabelMaxLength {
+		cronJobName = strings.TrimRight(cronJobName[:validation.DNS1123LabelMaxLength-len(tail)], "-.")
+	}
+
+	return cronJobName + tail
+}
+
+// GetJob returns a Job from the namespace the application runs in
+func (k *K8s) GetJob(name string) (*batchv1.Job, error) {
+	return k.Client.BatchV1().Jobs(k.Namespace).Get(k.Context, name, metav1.GetOptions{})
+}
+
+// GetZones returns the count of nodes per zone, restricted to the zones allowed by the zone filters and leaving out
+// retired nodes and nodes not matching the given node filter; the zones are taken from the given node pool locations, or
+// derived from the nodes when no locations are given
+func (k *K8s) GetZones(name string, locations []string, filter shifter.NodeFilter) (zones shifter.ZoneStats, err error) {
+	zones = shifter.ZoneStats{}
+	opts := metav1.ListOptions{}
+	availableZones := shifter.FilterZones(locations, k.ZonesInclude, k.ZonesExclude)
+	if len(locations) == 0 {
+		availableZones, err = k.determineZones(name)
+		if err != nil {
+			return nil, err
+		}
 	}
 	var nodes *v1.NodeList
 
@@ -93,19 +299,74 @@ func (k *K8s) GetZones(name string) (zones []int, err error) {
 			"failure-domain.beta.kubernetes.io/zone": zone,
 		}
 		ls := labels.SelectorFromSet(selector)
-		opts.LabelSelector = ls.String()
+		opts.LabelSelector = ls.String() + ",!" + shifter.RetiredLabel
 		nodes, err = k.Client.CoreV1().Nodes().List(k.Context, opts)
 		if err != nil {
 			return
 		}
-		zones = append(zones, len(nodes.Items))
+		zones.AddNodes(zone, filter.Filter(nodes.Items))
+	}
+
+	return
+}
+
+// GetAutoscalerStatus returns the status reported by the cluster-autoscaler, empty if the autoscaler doesn't run
+func (k *K8s) GetAutoscalerStatus() (status string, err error) {
+	configMap, err := k.Client.CoreV1().ConfigMaps(autoscalerStatusNamespace).Get(k.Context, autoscalerStatusName, metav1.GetOptions{})
+
+	if errors.IsNotFound(err) {
+		return "", nil
+	}
+
+	if err != nil {
+		return
+	}
+
+	status = configMap.Data["status"]
+	return
+}
+
+// GetConfigMap returns a ConfigMap from the namespace the application runs in, nil if it doesn't exist
+func (k *K8s) GetConfigMap(name string) (configMap *v1.ConfigMap, err error) {
+	configMap, err = k.Client.CoreV1().ConfigMaps(k.Namespace).Get(k.Context, name, metav1.GetOptions{})
 
+	if errors.IsNotFound(err) {
+		return nil, nil
 	}
 
 	return
 }
 
-// determineZones returns a slice with the zones of a node pool e.g.
+// UpsertConfigMap creates or updates a ConfigMap in the namespace the application runs in
+func (k *K8s) UpsertConfigMap(configMap *v1.ConfigMap) (err error) {
+	existing, err := k.GetConfigMap(configMap.Name)
+	if err != nil {
+		return
+	}
+
+	if existing == nil {
+		_, err = k.Client.CoreV1().ConfigMaps(k.Namespace).Create(k.Context, configMap, metav1.CreateOptions{})
+		return
+	}
+
+	configMap.ResourceVersion = existing.ResourceVersion
+	_, err = k.Client.CoreV1().ConfigMaps(k.Namespace).Update(k.Context, configMap, metav1.UpdateOptions{})
+	return
+}
+
+// ReplaceConfigMap creates a ConfigMap in the namespace the application runs in when it has no resource version, and
+// updates it otherwise; it fails with a conflict when the ConfigMap changed since it was read
+func (k *K8s) ReplaceConfigMap(configMap *v1.ConfigMap) (err error) {
+	if configMap.ResourceVersion == "" {
+		_, err = k.Client.CoreV1().ConfigMaps(k.Namespace).Create(k.Context, configMap, metav1.CreateOptions{})
+		return
+	}
+
+	_, err = k.Client.CoreV1().ConfigMaps(k.Namespace).Update(k.Context, configMap, metav1.UpdateOptions{})
+	return
+}
+
+// determineZones returns a slice with the allowed zones of a node pool e.g.
 // ["europe-west1-d", "europe-west1-c", "europe-west1-a"]
 func (k *K8s) determineZones(name string) (zones []string, err error) {
 	opts := metav1.ListOptions{}
@@ -124,7 +385,7 @@ func (k *K8s) determineZones(name string) (zones []string, err error) {
 		zone := node.Labels["failure-domain.beta.kubernetes.io/zone"]
 		zoneMap[zone] = true
 	}
-	return mapKeysToArray(zoneMap), nil
+	return shifter.FilterZones(mapKeysToArray(zoneMap), k.ZonesInclude, k.ZonesExclude), nil
 }
 
 func mapKeysToArray(zoneMap map[string]bool) (availableZones []string) {
@@ -149,13 +410,41 @@ func inClusterConfig() (*kubernetes.Clientset, error) {
 	return clientset, nil
 }
 
-// loadOutOfClusterK8sClient parses a kubeconfig from a file and returns a Kubernetes
-// client. It does not support extensions or client auth providers.
-func loadOutOfClusterK8sClient(kubeconfigPath string) (*kubernetes.Clientset, error) {
-	// use the current context in kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeConfigPath)
+// loadOutOfClusterK8sClient parses a kubeconfig from a file and returns a Kubernetes client for the given context, or
+// the current one when empty. It does not support extensions or client auth providers.
+func loadOutOfClusterK8sClient(kubeconfigPath, kubeContext string, confirmProduction bool) (*kubernetes.Clientset, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfigPath
+
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{
+		CurrentContext: kubeContext,
+	})
+
+	rawConfig, err := clientConfig.RawConfig()
 	if err != nil {
-		panic(err.Error())
+		return nil, err
+	}
+
+	if kubeContext == "" {
+		kubeContext = rawConfig.CurrentContext
+	}
+
+	if _, ok := rawConfig.Contexts[kubeContext]; !ok {
+		return nil, fmt.Errorf("Context %v not found in kubeconfig", kubeContext)
+	}
+
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("context", kubeContext).
+		Str("server", config.Host).
+		Msg("Using kubeconfig context")
+
+	if looksLikeProduction(kubeContext, config.Host) && !confirmProduction {
+		return nil, fmt.Errorf("Context %v with server %v looks like production, set --confirm-production to use it", kubeContext, config.Host)
 	}
 
 	// create the clientset
@@ -167,3 +456,13 @@ func loadOutOfClusterK8sClient(kubeconfigPath string) (*kubernetes.Clientset, er
 	// fmt.Printf("%#v", config)
 	return clientset, nil
 }
+
+// looksLikeProduction returns true if the name of the kubeconfig context or the host of the cluster server looks like
+// production
+func looksLikeProduction(kubeContext, server string) bool {
+	if u, err := url.Parse(server); err == nil && u.Host != "" {
+		server = u.Host
+	}
+
+	return productionPattern.MatchString(kubeContext) || productionPattern.MatchString(server)
+}
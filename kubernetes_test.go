@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestLooksLikeProduction(t *testing.T) {
+	cases := []struct {
+		context    string
+		server     string
+		production bool
+	}{
+		{"gke_project_europe-west1_staging", "https://35.1.2.3", false},
+		{"gke_project_europe-west1_production", "https://35.1.2.3", true},
+		{"minikube", "https://prod-api.example.com:6443", true},
+		{"dev", "https://dev-api.example.com/prod", false},
+	}
+
+	for _, c := range cases {
+		if got := looksLikeProduction(c.context, c.server); got != c.production {
+			t.Errorf("looksLikeProduction(%v, %v) = %v, expected %v", c.context, c.server, got, c.production)
+		}
+	}
+}
+
+func TestJobName(t *testing.T) {
+	now := time.Unix(1630490400, 0)
+
+	if got := jobName("snapshot", "pre_shift", now); got != "snapshot-pre-shift-1630490400" {
+		t.Errorf("jobName, expected snapshot-pre-shift-1630490400 got %v", got)
+	}
+
+	cronJobName := "snapshot-the-persistent-volumes-of-the-nodes-before-shifting-them"
+	got := jobName(cronJobName, "pre_shift", now)
+
+	if len(got) > 63 || !strings.HasSuffix(got, "-pre-shift-1630490400") || !strings.HasPrefix(cronJobName, strings.TrimSuffix(got, "-pre-shift-1630490400")) {
+		t.Errorf("jobName of a long CronJob name, expected a truncated name of at most 63 characters got %v (%d)", got, len(got))
+	}
+
+	if errs := validation.IsDNS1123Label(got); len(errs) > 0 {
+		t.Errorf("jobName of a long CronJob name, expected a valid label got %v: %v", got, errs)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+// adminMux holds the admin endpoints, served on the admin listen address
+var adminMux = http.NewServeMux()
+
+// startListener serves the handler on the given address in the background, an empty address disables the listener;
+// ipv6 addresses are given in brackets, e.g. [::1]:9001
+func startListener(name, address string, handler http.Handler) {
+	if address == "" {
+		log.Info().Msgf("The %v listener is disabled", name)
+		return
+	}
+
+	go func() {
+		log.Debug().
+			Str("address", address).
+			Msgf("Serving %v endpoints...", name)
+
+		if err := http.ListenAndServe(address, handler); err != nil {
+			log.Fatal().Err(err).Msgf("Starting %v listener failed", name)
+		}
+	}()
+}
+
+// initMetrics serves the prometheus metrics on the given address and path
+func initMetrics(address, path string) {
+	mux := http.NewServeMux()
+	mux.Handle(path, promhttp.Handler())
+
+	startListener("metrics", address, mux)
+}
+
+// initLiveness serves the /liveness endpoint on the given address
+func initLiveness(address string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/liveness", func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, "I'm alive!\n")
+	})
+
+	startListener("liveness", address, mux)
+}
+
+// initAdmin serves the admin endpoints on the given address
+func initAdmin(address string) {
+	adminMux.HandleFunc("/version", handleVersion)
+	adminMux.HandleFunc("/config", handleConfig)
+
+	startListener("admin", address, adminMux)
+}
+
+// initHistory serves the history of the recent cycles as json on the admin endpoints
+func initHistory(history *History) {
+	adminMux.Handle("/history", history)
+}
+
+// initOperations serves the GCP operations recently started by the shifter as json on the admin endpoints
+func initOperations(s *shifter.Shifter) {
+	adminMux.HandleFunc("/operations", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(s.Operations()); err != nil {
+			log.Error().Err(err).Msg("Error writing operations response")
+		}
+	})
+}
@@ -3,13 +3,17 @@ package main
 import (
 	"os"
 	"runtime"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kingpin"
 	foundation "github.com/estafette/estafette-foundation"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -20,6 +24,20 @@ var (
 			Default("300").
 			Short('i').
 			Int()
+	schedule = kingpin.Flag("schedule", "Cron expression of the times to check for a shift, e.g. \"*/10 8-18 * * 1-5\"; replaces --interval when set.").
+			Envar("SCHEDULE").
+			String()
+	adaptiveInterval = kingpin.Flag("adaptive-interval", "Check more often while the node pool to shift from is far above its minimum, stretching the interval up to --interval as it approaches the minimum.").
+				Envar("ADAPTIVE_INTERVAL").
+				Bool()
+	adaptiveMinInterval = kingpin.Flag("adaptive-min-interval", "The shortest time in second to wait between each node pool check with an adaptive interval.").
+				Envar("ADAPTIVE_MIN_INTERVAL").
+				Default("60").
+				Int()
+	adaptiveDistance = kingpin.Flag("adaptive-distance", "Number of nodes per zone above its minimum from which the node pool to shift from is checked at the shortest interval.").
+				Envar("ADAPTIVE_DISTANCE").
+				Default("5").
+				Int()
 	cycleTime = kingpin.Flag("cycle-time", "Time between node pool operations").
 			Envar("CYCLE_TIME").
 			Default("10").Short('c').
@@ -27,35 +45,316 @@ var (
 	kubeConfigPath = kingpin.Flag("kubeconfig", "Provide the path to the kube config path, usually located in ~/.kube/config. For out of cluster execution").
 			Envar("KUBECONFIG").
 			String()
+	jitterPercent = kingpin.Flag("jitter-percent", "Maximum deviation in percent either way applied to the interval, cycle time and retry waits, 0 for deterministic scheduling.").
+			Envar("JITTER_PERCENT").
+			Default("25").
+			Int()
+	jitterSeed = kingpin.Flag("jitter-seed", "Seed of the jitter to reproduce its deviations, 0 to seed from the current time.").
+			Envar("JITTER_SEED").
+			Default("0").
+			Int64()
+	kubeContext = kingpin.Flag("kube-context", "The kubeconfig context to use out of cluster, defaults to the current context.").
+			Envar("KUBE_CONTEXT").
+			String()
+	confirmProduction = kingpin.Flag("confirm-production", "Confirm using a kubeconfig context or cluster that looks like production out of cluster.").
+				Envar("CONFIRM_PRODUCTION").
+				Bool()
 	nodePoolFrom = kingpin.Flag("node-pool-from", "The name of the node pool to shift from.").
-			Required().
 			Envar("NODE_POOL_FROM").
 			String()
 	nodePoolTo = kingpin.Flag("node-pool-to", "The name of the node pool to shift to.").
-			Required().
 			Envar("NODE_POOL_TO").
 			String()
+	from = kingpin.Flag("from", "Shorthand for --node-pool-from.").
+		String()
+	to = kingpin.Flag("to", "Shorthand for --node-pool-to.").
+		String()
+	confirm = kingpin.Flag("confirm", "Print the plan and prompt for confirmation before each resize, for interactive out of cluster use.").
+		Envar("CONFIRM").
+		Bool()
+	clusterProject = kingpin.Flag("cluster-project", "The GCloud project of the cluster, derived from the nodes or the metadata server when empty.").
+			Envar("CLUSTER_PROJECT").
+			String()
+	clusterLocation = kingpin.Flag("cluster-location", "The GCloud location of the cluster, derived from the nodes or the metadata server when empty.").
+			Envar("CLUSTER_LOCATION").
+			String()
+	clusterNameFlag = kingpin.Flag("cluster-name", "The name of the cluster, derived from the nodes or the metadata server when empty.").
+			Envar("CLUSTER_NAME").
+			String()
+	nodePoolToProject = kingpin.Flag("node-pool-to-project", "The GCloud project of the node pool to shift to, defaults to the project of the cluster.").
+				Envar("NODE_POOL_TO_PROJECT").
+				String()
+	nodePoolToLocation = kingpin.Flag("node-pool-to-location", "The GCloud location of the cluster of the node pool to shift to, defaults to the location of the cluster.").
+				Envar("NODE_POOL_TO_LOCATION").
+				String()
+	nodePoolToCluster = kingpin.Flag("node-pool-to-cluster", "The name of the cluster of the node pool to shift to, defaults to the cluster name.").
+				Envar("NODE_POOL_TO_CLUSTER").
+				String()
+	nodePoolToCredentials = kingpin.Flag("node-pool-to-credentials", "Path to a service account key file to resize the node pool to shift to, or a sm://<project>/<secret>[/<version>] Secret Manager reference to the key, defaults to the application default credentials.").
+				Envar("NODE_POOL_TO_CREDENTIALS").
+				String()
 	nodePoolFromMinNode = kingpin.Flag("node-pool-from-min-node", "The minimum number of node to keep for the node pool to shift.").
 				Envar("NODE_POOL_FROM_MIN_NODE").
 				Default("0").
 				Int()
-	prometheusAddress = kingpin.Flag("metrics-listen-address", "The address to listen on for Prometheus metrics requests.").
+	minOnDemandFraction = kingpin.Flag("min-ondemand-fraction", "The minimum fraction of the nodes of the cluster to keep on the from node pool, e.g. 0.2; the larger of this and the minimum number of node applies, 0 disables it.").
+				Envar("MIN_ONDEMAND_FRACTION").
+				Default("0").
+				Float64()
+	minClusterCPU = kingpin.Flag("min-cluster-cpu", "The Ready allocatable cpu of the cluster no removal takes it below, e.g. 64, whatever the minimum of the node pools; empty disables it.").
+			Envar("MIN_CLUSTER_CPU").
+			String()
+	minClusterMemory = kingpin.Flag("min-cluster-memory", "The Ready allocatable memory of the cluster no removal takes it below, e.g. 256Gi, whatever the minimum of the node pools; empty disables it.").
+				Envar("MIN_CLUSTER_MEMORY").
+				String()
+	zonesInclude = kingpin.Flag("zones-include", "Comma separated list of zones to restrict shifting to, all zones are used when empty.").
+			Envar("ZONES_INCLUDE").
+			String()
+	zonesExclude = kingpin.Flag("zones-exclude", "Comma separated list of zones to exclude from shifting.").
+			Envar("ZONES_EXCLUDE").
+			String()
+	nodeFilterSelector = kingpin.Flag("node-filter-selector", "Label selector restricting the nodes of the node pool to shift from counted and selected for removal, e.g. dedicated!=batch; all nodes take part when empty.").
+				Envar("NODE_FILTER_SELECTOR").
+				String()
+	nodeFilterExcludeTaints = kingpin.Flag("node-filter-exclude-taints", "Comma separated list of taint keys whose nodes aren't counted nor selected for removal, e.g. nodes reserved for dedicated workloads.").
+				Envar("NODE_FILTER_EXCLUDE_TAINTS").
+				String()
+	respectAutoscalerStatus = kingpin.Flag("respect-autoscaler-status", "Skip shifting while the cluster-autoscaler is scaling either node pool.").
+				Envar("RESPECT_AUTOSCALER_STATUS").
+				Default("true").
+				Bool()
+	respectMaintenanceExclusions = kingpin.Flag("respect-maintenance-exclusions", "Skip shifting during the maintenance exclusion windows configured on the cluster of either node pool.").
+					Envar("RESPECT_MAINTENANCE_EXCLUSIONS").
+					Default("true").
+					Bool()
+	preemptionRateThreshold = kingpin.Flag("preemption-rate-threshold", "Pause shifting while the node pool to shift to had this many preemptions within the preemption rate window, 0 disables the check.").
+				Envar("PREEMPTION_RATE_THRESHOLD").
+				Default("0").
+				Int()
+	preemptionRateWindow = kingpin.Flag("preemption-rate-window", "Time in second of the sliding window in which preemptions are counted.").
+				Envar("PREEMPTION_RATE_WINDOW").
+				Default("3600").
+				Int()
+	hpaNamespaces = kingpin.Flag("hpa-namespaces", "Comma separated list of namespaces whose HorizontalPodAutoscalers delay shifting while scaling up, * for all namespaces.").
+			Envar("HPA_NAMESPACES").
+			String()
+	preemptibleKillerCoordination = kingpin.Flag("preemptible-killer-coordination", "Coordinate with estafette-gke-preemptible-killer: skip shifting while it is about to delete nodes of the pool to shift to, and lease those nodes for the duration of a shift.").
+					Envar("PREEMPTIBLE_KILLER_COORDINATION").
+					Bool()
+	preemptibleKillerWindow = kingpin.Flag("preemptible-killer-window", "Time in second ahead of a deletion by estafette-gke-preemptible-killer in which shifting is skipped.").
+				Envar("PREEMPTIBLE_KILLER_WINDOW").
+				Default("900").
+				Int()
+	reconcileTargetSize = kingpin.Flag("reconcile-target-size", "Top the node pool to shift to back up each cycle when preemptions shrank it below the size the last shift left it at.").
+				Envar("RECONCILE_TARGET_SIZE").
+				Bool()
+	requireApproval = kingpin.Flag("require-approval", "Publish each planned shift to the approval ConfigMap and only execute it once its estafette.io/plan-approved annotation matches the plan hash.").
+			Envar("REQUIRE_APPROVAL").
+			Bool()
+	approvalConfigMap = kingpin.Flag("approval-configmap", "The name of the ConfigMap the planned shift is published to when approval is required.").
+				Envar("APPROVAL_CONFIGMAP").
+				Default("estafette-gke-node-pool-shifter-plan").
+				String()
+	policyHookURL = kingpin.Flag("policy-hook-url", "URL to post each planned shift and the cycle state to, the shift only proceeds on a 200 response that doesn't deny it.").
+			Envar("POLICY_HOOK_URL").
+			String()
+	preShiftHook = kingpin.Flag("pre-shift-hook", "Hook to run before the node pool to shift to is scaled up: an http(s) url to post the shift to, or job://<cronjob> to run a Job from a CronJob of the namespace of the shifter.").
+			Envar("PRE_SHIFT_HOOK").
+			String()
+	preShiftHookFailure = kingpin.Flag("pre-shift-hook-failure", "What a failing pre-shift hook does: abort or continue the shift.").
+				Envar("PRE_SHIFT_HOOK_FAILURE").
+				Default(string(shifter.HookAbort)).
+				Enum(string(shifter.HookAbort), string(shifter.HookContinue))
+	postShiftHook = kingpin.Flag("post-shift-hook", "Hook to run after the node pool to shift from is scaled down: an http(s) url to post the shift to, or job://<cronjob> to run a Job from a CronJob of the namespace of the shifter.").
+			Envar("POST_SHIFT_HOOK").
+			String()
+	postShiftHookFailure = kingpin.Flag("post-shift-hook-failure", "What a failing post-shift hook does: abort, i.e. fail the shift without rolling it back, or continue.").
+				Envar("POST_SHIFT_HOOK_FAILURE").
+				Default(string(shifter.HookContinue)).
+				Enum(string(shifter.HookAbort), string(shifter.HookContinue))
+	exitOnConverged = kingpin.Flag("exit-on-converged", "Exit once a cycle finds the node pool to shift from at its minimum and the node pool to shift to healthy, e.g. to run as a convergence step in a pipeline.").
+			Envar("EXIT_ON_CONVERGED").
+			Bool()
+	shutdownSummaryWebhook = kingpin.Flag("shutdown-summary-webhook", "Post the shutdown summary to the webhook as well.").
+				Envar("SHUTDOWN_SUMMARY_WEBHOOK").
+				Bool()
+	webhookURL = kingpin.Flag("webhook-url", "URL to post a json event to for each shift lifecycle event: planned, scaled_up, drained, scaled_down, or completed in cordon only mode, and failed.").
+			Envar("WEBHOOK_URL").
+			String()
+	webhookSecret = kingpin.Flag("webhook-secret", "Secret to sign the webhook body with, sent as HMAC-SHA256 in the X-Shifter-Signature header, or a sm://<project>/<secret>[/<version>] Secret Manager reference to it.").
+			Envar("WEBHOOK_SECRET").
+			String()
+	secretRefreshInterval = kingpin.Flag("secret-refresh-interval", "Time in second between refreshes of the flags referencing Secret Manager secrets to pick up rotations, 0 disables refreshing.").
+				Envar("SECRET_REFRESH_INTERVAL").
+				Default("300").
+				Int()
+	stateConfigMap = kingpin.Flag("state-configmap", "The name of the ConfigMap the phase of the current or last shift is persisted to, empty to disable.").
+			Envar("STATE_CONFIGMAP").
+			Default("estafette-gke-node-pool-shifter-state").
+			String()
+	bounceWindow = kingpin.Flag("bounce-window", "Time in second after a shift in which growth of the node pool shifted from is counted as a bounce, i.e. the autoscaler undoing the shift.").
+			Envar("BOUNCE_WINDOW").
+			Default("1800").
+			Int()
+	bounceCooldown = kingpin.Flag("bounce-cooldown", "Time in second to pause shifting after a bounce, 0 disables the cooldown.").
+			Envar("BOUNCE_COOLDOWN").
+			Default("0").
+			Int()
+	shiftDeadline = kingpin.Flag("shift-deadline", "Time in second a single shift may take before it is aborted and rolled back.").
+			Envar("SHIFT_DEADLINE").
+			Default("900").
+			Int()
+	shiftRetries = kingpin.Flag("shift-retries", "Number of retries a single shift may spend on failing resize steps before it is aborted and rolled back.").
+			Envar("SHIFT_RETRIES").
+			Default("3").
+			Int()
+	warmUpPeriod = kingpin.Flag("warm-up-period", "Time in second to let added nodes settle once they and their DaemonSet pods are ready, before draining nodes; 0 disables waiting for them.").
+			Envar("WARM_UP_PERIOD").
+			Default("0").
+			Int()
+	canaryProbe = kingpin.Flag("canary-probe", "Run a canary pod on the node pool to shift to after each shift and check it's running within the canary timeout.").
+			Envar("CANARY_PROBE").
+			Bool()
+	canaryImage = kingpin.Flag("canary-image", "The image of the canary pod.").
+			Envar("CANARY_IMAGE").
+			Default(shifter.DefaultCanaryImage).
+			String()
+	canaryTimeout = kingpin.Flag("canary-timeout", "Time in second the canary pod has to be running in.").
+			Envar("CANARY_TIMEOUT").
+			Default("120").
+			Int()
+	canaryBreaker = kingpin.Flag("canary-breaker", "Pause shifting after a failing canary probe, until a canary pod runs on the node pool to shift to again.").
+			Envar("CANARY_BREAKER").
+			Bool()
+	provisioningTimeout = kingpin.Flag("provisioning-timeout", "Time in second a zone of the pool to shift to has to provision the added nodes Ready in, before they are requested in another zone; 0 disables the zone failover.").
+				Envar("PROVISIONING_TIMEOUT").
+				Default("0").
+				Int()
+	affinityAwareDrain = kingpin.Flag("affinity-aware-drain", "Evict members of the same pod anti-affinity group one at a time, waiting for each to be rescheduled; disable for faster drains.").
+				Envar("AFFINITY_AWARE_DRAIN").
+				Default("true").
+				Bool()
+	batchSize = kingpin.Flag("batch-size", "Maximum number of nodes per zone to shift in a single cycle, with a single resize per node pool.").
+			Envar("BATCH_SIZE").
+			Default("1").
+			Int()
+	targetLabels = kingpin.Flag("target-labels", "Comma separated list of key=value labels the nodes of the pool to shift to are expected to carry.").
+			Envar("TARGET_LABELS").
+			String()
+	targetTaints = kingpin.Flag("target-taints", "Comma separated list of key=value:Effect taints the nodes of the pool to shift to are expected to carry.").
+			Envar("TARGET_TAINTS").
+			String()
+	configuredPoolsOnly = kingpin.Flag("configured-pools-only", "Only count the nodes of the node pools shifted from and to as capacity of the cluster, ignoring pools created by node auto-provisioning.").
+				Envar("CONFIGURED_POOLS_ONLY").
+				Bool()
+	migrate = kingpin.Flag("migrate", "Migrate all nodes off the node pool shifted from, e.g. to change machine type or image, cordoning it as a whole and waiting for all pods to be scheduled between steps.").
+		Envar("MIGRATE").
+		Bool()
+	migrateDeletePool = kingpin.Flag("migrate-delete-pool", "Delete the node pool migrated from once it's empty.").
+				Envar("MIGRATE_DELETE_POOL").
+				Bool()
+	namespaceEvictionLimit = kingpin.Flag("namespace-eviction-limit", "Maximum number of pods of a single namespace evicted at once while draining a node, 0 for no limit.").
+				Envar("NAMESPACE_EVICTION_LIMIT").
+				Default("0").
+				Int()
+	maxPodsDisrupted = kingpin.Flag("max-pods-disrupted", "Maximum number of pods a shift evicts, nodes with less impact are removed instead or the shift is deferred to a later cycle; 0 for no limit.").
+				Envar("MAX_PODS_DISRUPTED").
+				Default("0").
+				Int()
+	workloadAffinityAnalysis = kingpin.Flag("workload-affinity-analysis", "Limit shifts to the share of the workload whose node selectors, affinities and tolerations fit the node pool to shift to.").
+					Envar("WORKLOAD_AFFINITY_ANALYSIS").
+					Bool()
+	cordonOnly = kingpin.Flag("cordon-only", "Only cordon and drain the nodes shifted away, leaving their removal to the cluster-autoscaler.").
+			Envar("CORDON_ONLY").
+			Bool()
+	localVolumes = kingpin.Flag("local-volumes", "What to do with nodes whose pods use local or host path PersistentVolumes: skip them, force draining them or call the pre-drain hook first.").
+			Envar("LOCAL_VOLUMES").
+			Default(string(shifter.LocalVolumesSkip)).
+			Enum(string(shifter.LocalVolumesSkip), string(shifter.LocalVolumesForce), string(shifter.LocalVolumesHook))
+	preDrainHookURL = kingpin.Flag("pre-drain-hook-url", "URL to post a node and its local volumes to before draining it with --local-volumes=hook, e.g. to snapshot them; the drain only proceeds on a 2xx response.").
+			Envar("PRE_DRAIN_HOOK_URL").
+			String()
+	preDrainHookTimeout = kingpin.Flag("pre-drain-hook-timeout", "Time in second the pre-drain hook may take to respond.").
+				Envar("PRE_DRAIN_HOOK_TIMEOUT").
+				Default("600").
+				Int()
+	forceBarePods = kingpin.Flag("force-bare-pods", "Allow removing nodes running pods without a controller, those pods are lost when evicted.").
+			Envar("FORCE_BARE_PODS").
+			Bool()
+	maxConcurrentOperations = kingpin.Flag("max-concurrent-operations", "Maximum number of resize and deletion operations in flight per cluster over all shifters of the namespace, further operations wait for a free slot.").
+				Envar("MAX_CONCURRENT_OPERATIONS").
+				Default("2").
+				Int()
+	cloudMonitoring = kingpin.Flag("cloud-monitoring", "Write shift counts and node pool sizes as Cloud Monitoring custom metrics in addition to Prometheus.").
+			Envar("CLOUD_MONITORING").
+			Bool()
+	chaosErrorRate = kingpin.Flag("chaos-error-rate", "Probability between 0 and 1 to inject a simulated GCP error, for testing only.").
+			Envar("CHAOS_ERROR_RATE").
+			Default("0").
+			Hidden().
+			Float64()
+	chaosStuckOperationRate = kingpin.Flag("chaos-stuck-operation-rate", "Probability between 0 and 1 to inject a resize operation that never finishes, for testing only.").
+				Envar("CHAOS_STUCK_OPERATION_RATE").
+				Default("0").
+				Hidden().
+				Float64()
+	chaosNotReadyRate = kingpin.Flag("chaos-not-ready-rate", "Probability between 0 and 1 per zone to inject a NotReady node, for testing only.").
+				Envar("CHAOS_NOT_READY_RATE").
+				Default("0").
+				Hidden().
+				Float64()
+	logLevel = kingpin.Flag("log-level", "The minimum level of log messages to output, set to debug to log the computed state of every cycle.").
+			Envar("LOG_LEVEL").
+			Default("info").
+			Enum("trace", "debug", "info", "warn", "error")
+	prometheusAddress = kingpin.Flag("metrics-listen-address", "The address to listen on for Prometheus metrics requests, empty to disable.").
 				Envar("METRICS_LISTEN_ADDRESS").
 				Default(":9001").
 				String()
+	prometheusMetricsPrefix = kingpin.Flag("metrics-prefix", "The prefix of the names of all Prometheus metrics, e.g. to avoid collisions with another deployment.").
+				Envar("METRICS_PREFIX").
+				Default("estafette_gke_node_pool_shifter").
+				String()
 	prometheusMetricsPath = kingpin.Flag("metrics-path", "The path to listen for Prometheus metrics requests.").
 				Envar("METRICS_PATH").
 				Default("/metrics").
 				String()
+	livenessAddress = kingpin.Flag("liveness-listen-address", "The address to listen on for /liveness requests, empty to disable.").
+			Envar("LIVENESS_LISTEN_ADDRESS").
+			Default(":5000").
+			String()
+	historyWindow = kingpin.Flag("history-window", "Time in second the snapshots of past cycles are kept in memory for, served on /history on the admin listener; 0 disables the history.").
+			Envar("HISTORY_WINDOW").
+			Default("86400").
+			Int()
+	adminAddress = kingpin.Flag("admin-listen-address", "The address to listen on for admin requests like /version and /config, empty to disable.").
+			Envar("ADMIN_LISTEN_ADDRESS").
+			Default(":9002").
+			String()
 
-	// define prometheus counter
-	nodeTotals = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "estafette_gke_node_pool_shifter_node_totals",
-			Help: "Number of processed nodes.",
-		},
-		[]string{"status"},
-	)
+	// prometheus collectors, created once the metric prefix is known
+	nodeTotals         *prometheus.CounterVec
+	buildInfo          *prometheus.GaugeVec
+	bounceTotals       *prometheus.CounterVec
+	skipTotals         *prometheus.CounterVec
+	transitionTotals   *prometheus.CounterVec
+	reconcileTotals    *prometheus.CounterVec
+	blockedNodes       *prometheus.GaugeVec
+	targetSize         *prometheus.GaugeVec
+	movableRatio       *prometheus.GaugeVec
+	lastOperation      *prometheus.GaugeVec
+	canaryHealthy      *prometheus.GaugeVec
+	intervalSeconds    *prometheus.GaugeVec
+	disruptedPods      *prometheus.GaugeVec
+	disruptedWorkloads *prometheus.GaugeVec
+	drainRemaining     *prometheus.GaugeVec
+	evictionSeconds    *prometheus.HistogramVec
+	affectedPods       *prometheus.GaugeVec
+	affectedNS         *prometheus.GaugeVec
+	readyNodes         *prometheus.GaugeVec
+
+	// cluster name used to label all exported series, known once the project details are retrieved
+	clusterName string
 
 	// application version
 	appgroup  string
@@ -67,9 +366,200 @@ var (
 	goVersion = runtime.Version()
 )
 
-func init() {
-	// Metrics have to be registered to be exposed:
+// initMetricCollectors creates the metrics with the given prefix, they have to be registered to be exposed
+func initMetricCollectors(prefix string) {
+	nodeTotals = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "node_totals",
+			Help:      "Number of processed nodes.",
+		},
+		[]string{"cluster", "from_pool", "to_pool", "status"},
+	)
+
+	// the process and go collectors are registered on the default registry by the prometheus client
+	buildInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "build_info",
+			Help:      "Build information of the running node pool shifter, always 1.",
+		},
+		[]string{"cluster", "from_pool", "to_pool", "version", "revision", "branch", "goversion"},
+	)
+
+	bounceTotals = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "bounce_totals",
+			Help:      "Number of shifts undone by the node pool shifted from growing again within the bounce window.",
+		},
+		[]string{"cluster", "from_pool", "to_pool"},
+	)
+
+	skipTotals = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "skip_totals",
+			Help:      "Number of cycles that didn't shift, by reason.",
+		},
+		[]string{"cluster", "from_pool", "to_pool", "reason"},
+	)
+
+	transitionTotals = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "shift_transition_totals",
+			Help:      "Number of transitions of shifts from one phase to the next.",
+		},
+		[]string{"cluster", "from_pool", "to_pool", "from_phase", "to_phase"},
+	)
+
+	reconcileTotals = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "reconciled_node_totals",
+			Help:      "Number of nodes added back to the node pool shifted to after preemptions shrank it.",
+		},
+		[]string{"cluster", "from_pool", "to_pool"},
+	)
+
+	blockedNodes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "blocked_nodes",
+			Help:      "Number of nodes of the node pool shifted from that can't be drained, by reason.",
+		},
+		[]string{"cluster", "from_pool", "to_pool", "reason"},
+	)
+
+	targetSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "node_pool_target_size",
+			Help:      "Number of nodes GKE targets for a node pool in a zone.",
+		},
+		[]string{"cluster", "from_pool", "to_pool", "pool", "zone"},
+	)
+
+	readyNodes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "node_pool_ready_nodes",
+			Help:      "Number of Ready nodes Kubernetes observes for a node pool in a zone.",
+		},
+		[]string{"cluster", "from_pool", "to_pool", "pool", "zone"},
+	)
+
+	affectedPods = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "last_shift_affected_pods",
+			Help:      "Number of pods evicted by the last shift.",
+		},
+		[]string{"cluster", "from_pool", "to_pool"},
+	)
+
+	affectedNS = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "last_shift_affected_namespaces",
+			Help:      "Number of namespaces pods were evicted from by the last shift.",
+		},
+		[]string{"cluster", "from_pool", "to_pool"},
+	)
+
+	disruptedPods = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "planned_disruption_pods",
+			Help:      "Number of pods the removal planned by the last cycle would evict.",
+		},
+		[]string{"cluster", "from_pool", "to_pool"},
+	)
+
+	disruptedWorkloads = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "planned_disruption_workloads",
+			Help:      "Number of distinct workloads the removal planned by the last cycle would evict pods of.",
+		},
+		[]string{"cluster", "from_pool", "to_pool"},
+	)
+
+	drainRemaining = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "drain_pods_remaining",
+			Help:      "Number of pods left to evict from the node being drained, 0 once drained.",
+		},
+		[]string{"cluster", "from_pool", "to_pool"},
+	)
+
+	evictionSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: prefix,
+			Name:      "pod_eviction_duration_seconds",
+			Help:      "Time in second from the eviction of a pod until it's gone from the node being drained.",
+			Buckets:   prometheus.ExponentialBuckets(5, 2, 9),
+		},
+		[]string{"cluster", "from_pool", "to_pool"},
+	)
+
+	intervalSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "effective_interval_seconds",
+			Help:      "Time in second to wait between node pool checks the last cycle settled on, before jitter.",
+		},
+		[]string{"cluster", "from_pool", "to_pool"},
+	)
+
+	canaryHealthy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "canary_healthy",
+			Help:      "Whether the last canary pod ran on the node pool shifted to, 1 if it did.",
+		},
+		[]string{"cluster", "from_pool", "to_pool"},
+	)
+
+	lastOperation = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "last_operation_timestamp_seconds",
+			Help:      "Start time of the last GCP operation started by the shifter, labelled with its name.",
+		},
+		[]string{"cluster", "from_pool", "to_pool", "kind", "target", "operation"},
+	)
+
+	movableRatio = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "movable_workload_ratio",
+			Help:      "Share of the workload of the node pool to shift from that can run on the node pool to shift to.",
+		},
+		[]string{"cluster", "from_pool", "to_pool"},
+	)
+
 	prometheus.MustRegister(nodeTotals)
+	prometheus.MustRegister(buildInfo)
+	prometheus.MustRegister(bounceTotals)
+	prometheus.MustRegister(skipTotals)
+	prometheus.MustRegister(transitionTotals)
+	prometheus.MustRegister(reconcileTotals)
+	prometheus.MustRegister(blockedNodes)
+	prometheus.MustRegister(targetSize)
+	prometheus.MustRegister(movableRatio)
+	prometheus.MustRegister(lastOperation)
+	prometheus.MustRegister(canaryHealthy)
+	prometheus.MustRegister(intervalSeconds)
+	prometheus.MustRegister(drainRemaining)
+	prometheus.MustRegister(evictionSeconds)
+	prometheus.MustRegister(affectedPods)
+	prometheus.MustRegister(affectedNS)
+	prometheus.MustRegister(disruptedPods)
+	prometheus.MustRegister(disruptedWorkloads)
+	prometheus.MustRegister(readyNodes)
 }
 
 func main() {
@@ -77,44 +567,113 @@ func main() {
 	// parse command line parameters
 	kingpin.Parse()
 
+	// the shorthands allow running as kubectl plugin, e.g. kubectl node-pool-shift --from X --to Y --confirm
+	if *nodePoolFrom == "" {
+		*nodePoolFrom = *from
+	}
+	if *nodePoolTo == "" {
+		*nodePoolTo = *to
+	}
+	if *nodePoolFrom == "" || *nodePoolTo == "" {
+		kingpin.Fatalf("required flags --node-pool-from and --node-pool-to not provided")
+	}
+
 	// init log format from envvar ESTAFETTE_LOG_FORMAT
 	foundation.InitLoggingFromEnv(foundation.NewApplicationInfo(appgroup, app, version, branch, revision, buildDate))
 
+	level, err := zerolog.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error parsing log level")
+	}
+	zerolog.SetGlobalLevel(level)
+
 	// init /liveness endpoint
-	foundation.InitLiveness()
+	initLiveness(*livenessAddress)
+
+	nodeFilter, err := shifter.ParseNodeFilter(*nodeFilterSelector, SplitList(*nodeFilterExcludeTaints))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error parsing the node filter")
+	}
+
+	capacityFloor, err := shifter.ParseCapacityFloor(*minClusterCPU, *minClusterMemory)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error parsing the capacity floor")
+	}
 
 	kubernetes, err := NewKubernetesClient(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"),
-		os.Getenv("KUBERNETES_NAMESPACE"), *kubeConfigPath)
+		os.Getenv("KUBERNETES_NAMESPACE"), *kubeConfigPath, *kubeContext, *confirmProduction, SplitList(*zonesInclude), SplitList(*zonesExclude))
 
 	if err != nil {
 		log.Fatal().Err(err).Msg("Error initializing Kubernetes client")
 	}
 
-	foundation.InitMetrics()
+	initMetricCollectors(*prometheusMetricsPrefix)
+	initMetrics(*prometheusAddress, *prometheusMetricsPath)
+	initAdmin(*adminAddress)
 
-	// create GCloud Client
-	gcloud, err := NewGCloudClient()
-	if err != nil {
-		log.Fatal().Err(err).Msg("Error creating GCloud client")
+	// sensitive flags can reference Secret Manager secrets instead of holding their values
+	webhookSigningSecret := NewSecret(*webhookSecret)
+	credentialsTo := NewSecret(*nodePoolToCredentials)
+
+	if webhookSigningSecret.IsReference() || credentialsTo.IsReference() {
+		secretManager, err := NewSecretManager()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error creating Secret Manager client")
+		}
+
+		if err := secretManager.Resolve(webhookSigningSecret, credentialsTo); err != nil {
+			log.Fatal().Err(err).Msg("Error resolving secrets")
+		}
+
+		if *secretRefreshInterval > 0 {
+			go secretManager.Refresh(time.Duration(*secretRefreshInterval)*time.Second, webhookSigningSecret, credentialsTo)
+		}
 	}
 
-	// get project information (gcloud project, zone and cluster id) from one of the node
-	nodes, err := kubernetes.GetNodeList("")
+	if *adaptiveInterval && (*adaptiveMinInterval < 1 || *adaptiveMinInterval > *interval) {
+		log.Fatal().Int("adaptive-min-interval", *adaptiveMinInterval).Msg("Adaptive min interval has to be between 1 and the interval")
+	}
 
-	if err != nil {
-		log.Fatal().Err(err).Msg("Error while getting the list of nodes")
+	if *minOnDemandFraction < 0 || *minOnDemandFraction > 1 {
+		log.Fatal().Float64("min-ondemand-fraction", *minOnDemandFraction).Msg("Min on-demand fraction has to be between 0 and 1")
+	}
+
+	if *maxConcurrentOperations < 1 {
+		log.Fatal().Int("max-concurrent-operations", *maxConcurrentOperations).Msg("Max concurrent operations has to be at least 1")
+	}
+
+	// create GCloud Client
+	if *jitterPercent < 0 || *jitterPercent > 100 {
+		log.Fatal().Int("jitter-percent", *jitterPercent).Msg("Jitter percent has to be between 0 and 100")
 	}
 
-	if len(nodes.Items) == 0 {
-		log.Fatal().Msg("Error there is no node in the cluster")
+	seed := *jitterSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
 	}
+	jitter := shifter.NewPercentJitter(*jitterPercent, seed)
 
-	err = gcloud.GetProjectDetailsFromNode(nodes.Items[0].Spec.ProviderID)
+	gcloud, err := NewGCloudClient(jitter)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error creating GCloud client")
+	}
+
+	// get project information (gcloud project, zone and cluster id) from the flags, one of the nodes or the metadata server
+	err = resolveProjectDetails(kubernetes, gcloud, *clusterProject, *clusterLocation, *clusterNameFlag)
 
 	if err != nil {
-		log.Fatal().Err(err).Msg("Error getting project details from node; are you running this in GKE?")
+		log.Fatal().Err(err).Msg("Error getting project details")
 	}
 
+	clusterName = gcloud.GetCluster()
+
+	buildInfo.With(metricLabels(prometheus.Labels{
+		"version":   version,
+		"revision":  revision,
+		"branch":    branch,
+		"goversion": goVersion,
+	})).Set(1)
+
 	// now that we have the cluster id, create GCloud container client
 	gcloudContainerClient, err := gcloud.NewGCloudContainerClient()
 
@@ -122,144 +681,438 @@ func main() {
 		log.Fatal().Err(err).Msg("Error creating GCloud container client")
 	}
 
+	// the node pool to shift to can be managed from another project, e.g. in shared vpc setups
+	gcloudContainerClientTo := gcloudContainerClient
+
+	if *nodePoolToProject != "" || *nodePoolToLocation != "" || *nodePoolToCluster != "" || *nodePoolToCredentials != "" {
+		credentialsFile, credentialsJSON := *nodePoolToCredentials, []byte(nil)
+		if credentialsTo.IsReference() {
+			credentialsFile, credentialsJSON = "", []byte(credentialsTo.Value())
+		}
+
+		gcloudContainerClientTo, err = gcloud.NewGCloudContainerClientFor(*nodePoolToProject, *nodePoolToLocation, *nodePoolToCluster, credentialsFile, credentialsJSON)
+
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error creating GCloud container client for the node pool to shift to")
+		}
+
+		// the credentials are only read when creating the client, so a rotated key gets a new client
+		if credentialsTo.IsReference() {
+			rotating := NewRotatingGCloudContainer(gcloudContainerClientTo)
+
+			credentialsTo.OnRotate(func(value string) {
+				client, err := gcloud.NewGCloudContainerClientFor(*nodePoolToProject, *nodePoolToLocation, *nodePoolToCluster, "", []byte(value))
+
+				if err != nil {
+					log.Error().
+						Err(err).
+						Str("secret", credentialsTo.Reference).
+						Msg("Error creating GCloud container client with the rotated credentials, keeping the current client")
+					return
+				}
+
+				rotating.Set(client)
+			})
+
+			gcloudContainerClientTo = rotating
+		}
+	}
+
+	// node pools of Autopilot clusters are managed by GKE, shifting them would fail every cycle
+	autopilot := false
+	for _, client := range []GCloudContainerClient{gcloudContainerClient, gcloudContainerClientTo} {
+		isAutopilot, err := client.IsAutopilot()
+
+		if err != nil {
+			log.Warn().Err(err).Str("cluster", client.GetClusterID()).Msg("Error detecting GKE Autopilot, assuming a standard cluster")
+			continue
+		}
+
+		if isAutopilot {
+			log.Error().Str("cluster", client.GetClusterID()).Msg("The cluster runs GKE Autopilot, its node pools can't be resized and won't be shifted")
+			autopilot = true
+		}
+	}
+
+	// pools created by node auto-provisioning compete with the node pool shifted to for evicted pods
+	nodeAutoprovisioning, err := gcloudContainerClient.IsNodeAutoprovisioningEnabled()
+
+	if err != nil {
+		log.Warn().Err(err).Msg("Error detecting node auto-provisioning, assuming it is disabled")
+	}
+
+	if nodeAutoprovisioning {
+		log.Warn().
+			Bool("configured-pools-only", *configuredPoolsOnly).
+			Msgf("Node auto-provisioning is enabled, evicted pods may land on auto-provisioned node pools instead of %v", *nodePoolTo)
+	}
+
+	// respect the operational limits of GKE, also when both node pools are in the same cluster; the slots are leased in
+	// a ConfigMap, so all shifters of the namespace share them
+	holder := os.Getenv("POD_NAME")
+	if holder == "" {
+		holder, _ = os.Hostname()
+	}
+
+	operationLimiter := NewOperationLimiter(kubernetes, holder, *maxConcurrentOperations)
+	gcloudContainerClient = NewThrottledGCloudContainer(gcloudContainerClient, operationLimiter)
+	gcloudContainerClientTo = NewThrottledGCloudContainer(gcloudContainerClientTo, operationLimiter)
+
+	var gcloudMonitoringClient GCloudMonitoringClient
+
+	if *cloudMonitoring {
+		gcloudMonitoringClient, err = gcloud.NewGCloudMonitoringClient(*nodePoolFrom, *nodePoolTo)
+
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error creating GCloud monitoring client")
+		}
+	}
+
+	if *confirm {
+		// a single reader of stdin, so no answer is buffered by the client not asking for it
+		confirmer := NewConfirmer(os.Stdin, os.Stdout)
+
+		gcloudContainerClient = NewConfirmingGCloudContainer(gcloudContainerClient, confirmer)
+		gcloudContainerClientTo = NewConfirmingGCloudContainer(gcloudContainerClientTo, confirmer)
+	}
+
+	// rehearse failure handling end-to-end, never to be enabled in production
+	if *chaosErrorRate > 0 || *chaosStuckOperationRate > 0 {
+		log.Warn().Msg("Chaos testing is enabled, simulated GCP errors and stuck operations will be injected")
+		gcloudContainerClient = NewChaosGCloudContainer(gcloudContainerClient, *chaosErrorRate, *chaosStuckOperationRate)
+		gcloudContainerClientTo = NewChaosGCloudContainer(gcloudContainerClientTo, *chaosErrorRate, *chaosStuckOperationRate)
+	}
+
+	if *chaosNotReadyRate > 0 {
+		log.Warn().Msg("Chaos testing is enabled, simulated NotReady nodes will be injected")
+		kubernetes = NewChaosKubernetes(kubernetes, *chaosNotReadyRate)
+	}
+
+	targetProfile := shifter.NodeProfile{
+		Labels: map[string]string{},
+	}
+
+	for _, label := range SplitList(*targetLabels) {
+		keyValue := strings.SplitN(label, "=", 2)
+		if len(keyValue) != 2 {
+			log.Fatal().Str("label", label).Msg("Error parsing target label, expected key=value")
+		}
+		targetProfile.Labels[keyValue[0]] = keyValue[1]
+	}
+
+	for _, input := range SplitList(*targetTaints) {
+		taint, err := shifter.ParseTaint(input)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error parsing target taint")
+		}
+		targetProfile.Taints = append(targetProfile.Taints, taint)
+	}
+
+	options := shifter.Options{
+		Cluster:                       clusterName,
+		NodePoolFrom:                  *nodePoolFrom,
+		NodePoolTo:                    *nodePoolTo,
+		NodePoolFromMinNode:           *nodePoolFromMinNode,
+		MinOnDemandFraction:           *minOnDemandFraction,
+		CapacityFloor:                 capacityFloor,
+		ZonesInclude:                  SplitList(*zonesInclude),
+		ZonesExclude:                  SplitList(*zonesExclude),
+		NodeFilter:                    nodeFilter,
+		Interval:                      *interval,
+		CycleTime:                     *cycleTime,
+		AdaptiveInterval:              *adaptiveInterval,
+		AdaptiveMinInterval:           *adaptiveMinInterval,
+		AdaptiveDistance:              *adaptiveDistance,
+		RespectAutoscalerStatus:       *respectAutoscalerStatus,
+		RespectMaintenanceExclusions:  *respectMaintenanceExclusions,
+		HPANamespaces:                 SplitList(*hpaNamespaces),
+		NodeAutoprovisioning:          nodeAutoprovisioning,
+		ConfiguredPoolsOnly:           *configuredPoolsOnly,
+		PreemptionRateThreshold:       *preemptionRateThreshold,
+		PreemptionRateWindow:          *preemptionRateWindow,
+		BounceWindow:                  *bounceWindow,
+		BounceCooldown:                *bounceCooldown,
+		ShiftDeadline:                 *shiftDeadline,
+		ShiftRetries:                  *shiftRetries,
+		BatchSize:                     *batchSize,
+		WarmUpPeriod:                  *warmUpPeriod,
+		CanaryProbe:                   *canaryProbe,
+		CanaryImage:                   *canaryImage,
+		CanaryTimeout:                 *canaryTimeout,
+		CanaryBreaker:                 *canaryBreaker,
+		ProvisioningTimeout:           *provisioningTimeout,
+		ReconcileTargetSize:           *reconcileTargetSize,
+		AffinityAwareDrain:            *affinityAwareDrain,
+		Migrate:                       *migrate,
+		DeleteMigratedPool:            *migrateDeletePool,
+		DrainObserver:                 drainMetrics{},
+		NamespaceEvictionLimit:        *namespaceEvictionLimit,
+		MaxPodsDisrupted:              *maxPodsDisrupted,
+		WorkloadAffinityAnalysis:      *workloadAffinityAnalysis,
+		CordonOnly:                    *cordonOnly,
+		ForceBarePods:                 *forceBarePods,
+		LocalVolumes:                  shifter.LocalVolumeHandling(*localVolumes),
+		PreemptibleKillerCoordination: *preemptibleKillerCoordination,
+		PreemptibleKillerWindow:       *preemptibleKillerWindow,
+		TargetProfile:                 targetProfile,
+		RequireApproval:               *requireApproval,
+		ApprovalConfigMap:             *approvalConfigMap,
+		StateConfigMap:                *stateConfigMap,
+		NodeName:                      os.Getenv("NODE_NAME"),
+		PodName:                       os.Getenv("POD_NAME"),
+		PodNamespace:                  os.Getenv("KUBERNETES_NAMESPACE"),
+		Jitter:                        jitter,
+	}
+
+	if *confirm {
+		options.PlanOutput = os.Stdout
+	}
+
+	if *policyHookURL != "" {
+		options.Policy = NewPolicyWebhook(*policyHookURL)
+	}
+
+	if *preShiftHook != "" {
+		options.PreShiftHook, err = NewShiftHook(*preShiftHook, kubernetes)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error configuring the pre-shift hook")
+		}
+		options.PreShiftHookFailure = shifter.HookFailurePolicy(*preShiftHookFailure)
+	}
+
+	if *postShiftHook != "" {
+		options.PostShiftHook, err = NewShiftHook(*postShiftHook, kubernetes)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error configuring the post-shift hook")
+		}
+		options.PostShiftHookFailure = shifter.HookFailurePolicy(*postShiftHookFailure)
+	}
+
+	if *preDrainHookURL != "" {
+		options.PreDrainHook = NewPreDrainWebhook(*preDrainHookURL, time.Duration(*preDrainHookTimeout)*time.Second)
+	} else if options.LocalVolumes == shifter.LocalVolumesHook {
+		log.Fatal().Msg("Handling local volumes with a hook requires --pre-drain-hook-url")
+	}
+
+	var webhook *Webhook
+	if *webhookURL != "" {
+		webhook = NewWebhook(*webhookURL, webhookSigningSecret)
+		options.Events = webhook
+	}
+
+	nodePoolShifter := shifter.New(options, gcloudContainerClientTo, gcloudContainerClient, gcloudContainerClientTo, kubernetes)
+
+	initOperations(nodePoolShifter)
+
+	var cycleSchedule *Schedule
+	if *schedule != "" {
+		cycleSchedule, err = ParseSchedule(*schedule)
+
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error parsing the schedule")
+		}
+	}
+
 	// define channel and wait group to gracefully shutdown the application
 	gracefulShutdown, waitGroup := foundation.InitGracefulShutdownHandling()
 
+	signalControl := NewSignalControl()
+
+	summary := NewSummaryRecorder(clusterName, *nodePoolFrom, *nodePoolTo)
+
+	var history *History
+	if *historyWindow > 0 {
+		history = NewHistory(time.Duration(*historyWindow) * time.Second)
+		initHistory(history)
+	}
+
 	// process node pool
 	go func(waitGroup *sync.WaitGroup) {
 		for {
-			log.Info().Msg("Checking node pool to shift...")
+			// with a schedule, cycles only run at the scheduled times instead of after each interval
+			if cycleSchedule != nil {
+				next := cycleSchedule.Next(time.Now())
 
-			// interval between each process
-			sleepTime := time.Duration(ApplyJitter(*interval)) * time.Second
+				if next.IsZero() {
+					log.Fatal().Str("schedule", *schedule).Msg("The schedule never matches")
+				}
 
-			nodesFrom, err := kubernetes.GetNodeList(*nodePoolFrom)
+				log.Info().Msgf("Waiting for the next scheduled cycle at %v...", next)
+				signalControl.Wait(time.Until(next))
+			}
 
-			if err != nil {
-				log.Error().
-					Err(err).
-					Str("node-pool", *nodePoolFrom).
-					Msg("Error while getting the list of nodes")
+			if signalControl.Paused() {
+				log.Info().Msg("Shifting is paused, send SIGUSR2 to resume")
 
-				nodeTotals.With(prometheus.Labels{"status": "failed"}).Inc()
+				skipTotals.With(metricLabels(prometheus.Labels{"reason": "paused"})).Inc()
 
-				log.Info().Msgf("Sleeping for %v seconds...", sleepTime)
-				time.Sleep(sleepTime)
+				if cycleSchedule == nil {
+					signalControl.Wait(time.Duration(*interval) * time.Second)
+				}
 				continue
 			}
 
-			zoneInfo, err := kubernetes.GetZones(*nodePoolTo)
+			if autopilot {
+				log.Warn().Msg("Node pools of GKE Autopilot clusters can't be shifted, skipping")
+
+				skipTotals.With(metricLabels(prometheus.Labels{"reason": "autopilot"})).Inc()
 
-			if err != nil {
-				log.Error().
-					Err(err).
-					Str("node-pool", *nodePoolTo).
-					Msg("error while determining zones")
+				if cycleSchedule == nil {
+					signalControl.Wait(time.Duration(*interval) * time.Second)
+				}
+				continue
+			}
 
-				log.Info().Msgf("Sleeping for %v seconds...", sleepTime)
+			log.Info().Msg("Checking node pool to shift...")
 
-				nodeTotals.With(prometheus.Labels{"status": "failed"}).Inc()
+			// wait for a cycle in progress, which might be shifting, before shutting down
+			waitGroup.Add(1)
+			status, sleepTime, state := nodePoolShifter.RunCycle()
+			summary.Record(status, state)
+			waitGroup.Done()
 
-				time.Sleep(sleepTime)
-				continue
+			if history != nil {
+				history.Record(time.Now(), status, state)
 			}
 
-			nodePoolFromSize := len(nodesFrom.Items) / len(zoneInfo)
+			log.Debug().
+				Interface("state", state).
+				Str("status", status).
+				Msg("Cycle state")
 
-			log.Info().
-				Str("node-pool", *nodePoolFrom).
-				Msgf("Node pool has %d node(s) per region, minimun wanted: %d node(s)", nodePoolFromSize, *nodePoolFromMinNode)
+			nodeTotals.With(metricLabels(prometheus.Labels{"status": status})).Inc()
 
-			// prometheus status
-			status := "skipped"
+			if state.SkipReason != "" {
+				skipTotals.With(metricLabels(prometheus.Labels{"reason": state.SkipReason})).Inc()
+			}
 
-			// TODO remove nodePoolFromMinNode, use value from node pool autoscaling setting (min node) instead
-			if nodePoolFromSize > *nodePoolFromMinNode && len(nodesFrom.Items) > 0 {
-				log.Info().
-					Str("node-pool", *nodePoolTo).
-					Msg("Attempting to shift one node per region...")
+			if state.Bounced {
+				bounceTotals.With(metricLabels(prometheus.Labels{})).Inc()
+			}
 
-				status = "shifted"
+			intervalSeconds.With(metricLabels(prometheus.Labels{})).Set(float64(state.Interval))
 
-				waitGroup.Add(1)
+			if state.CanaryHealthy != nil {
+				healthy := 0.0
+				if *state.CanaryHealthy {
+					healthy = 1
+				}
 
-				// This computes the maximum number of the preemptible node pool to scale
-				nodesTo, _ := kubernetes.GetZones(*nodePoolTo)
-				_, maxTo := FindMinAndMax(nodesTo)
+				canaryHealthy.With(metricLabels(prometheus.Labels{})).Set(healthy)
+			}
 
-				// This computes the maximum number of the vm node pool to scale
-				nodesFrom, _ := kubernetes.GetZones(*nodePoolFrom)
-				_, maxFrom := FindMinAndMax(nodesFrom)
+			if state.WorkloadFit != nil {
+				movableRatio.With(metricLabels(prometheus.Labels{})).Set(state.WorkloadFit.Ratio())
+			}
 
-				if err := shiftNode(gcloudContainerClient, kubernetes, *nodePoolFrom, *nodePoolTo, maxFrom, maxTo); err != nil {
-					status = "failed"
+			// only cycles that got to select nodes planned a removal
+			if state.Disruption != nil {
+				disruptedPods.With(metricLabels(prometheus.Labels{})).Set(float64(state.Disruption.Pods))
+				disruptedWorkloads.With(metricLabels(prometheus.Labels{})).Set(float64(state.Disruption.Workloads))
+			}
+
+			// only cycles that started a shift evicted pods
+			if len(state.Transitions) > 0 {
+				pods := 0
+				namespaces := shifter.AffectedNamespaces(state.Victims)
+				for _, count := range namespaces {
+					pods += count
 				}
 
-				// interval between actions, leverage provider requests when
-				// another operation is already operating on the cluster
-				sleepTime = time.Duration(ApplyJitter(*cycleTime)) * time.Second
-				waitGroup.Done()
+				affectedPods.With(metricLabels(prometheus.Labels{})).Set(float64(pods))
+				affectedNS.With(metricLabels(prometheus.Labels{})).Set(float64(len(namespaces)))
 			}
 
-			nodeTotals.With(prometheus.Labels{"status": status}).Inc()
-			log.Info().Msgf("One cycle done, sleeping for %v seconds...", sleepTime)
-			time.Sleep(sleepTime)
-		}
-	}(waitGroup)
+			// only the last operation is exposed to keep the number of series bounded
+			if operations := nodePoolShifter.Operations(); len(operations) > 0 {
+				operation := operations[0]
 
-	foundation.HandleGracefulShutdown(gracefulShutdown, waitGroup)
-}
+				lastOperation.Reset()
+				lastOperation.With(metricLabels(prometheus.Labels{
+					"kind":      operation.Kind,
+					"target":    operation.Target,
+					"operation": operation.Name,
+				})).Set(float64(operation.StartedAt.Unix()))
+			}
 
-// shiftNode safely try to add a new node to a pool then remove a node from another
-func shiftNode(g GCloudContainerClient, k KubernetesClient, fromName, toName string, fromCurrentSize, toCurrentSize int) (err error) {
-	// Add node
-	toNewSize := int64(toCurrentSize + 1)
+			for _, size := range state.PoolSizes {
+				targetSize.With(metricLabels(prometheus.Labels{"pool": size.Pool, "zone": size.Zone})).Set(float64(size.Target))
+				readyNodes.With(metricLabels(prometheus.Labels{"pool": size.Pool, "zone": size.Zone})).Set(float64(size.Ready))
+			}
 
-	log.Info().
-		Str("node-pool", toName).
-		Msgf("Adding 1 node to the pool for each region, currently %d node(s), expecting %d node(s) per region", toCurrentSize, toNewSize)
+			// only cycles that got to select nodes know which are blocked
+			if state.BlockedNodes != nil {
+				for _, reason := range []string{"bare_pods", "safe_to_evict", "local_volumes", "pdb"} {
+					count := 0
+					for _, blocked := range state.BlockedNodes {
+						if blocked.Reason == reason {
+							count++
+						}
+					}
+					blockedNodes.With(metricLabels(prometheus.Labels{"reason": reason})).Set(float64(count))
+				}
+			}
 
-	err = g.SetNodePoolSize(toName, toNewSize)
+			if state.ReconciledNodes > 0 {
+				reconcileTotals.With(metricLabels(prometheus.Labels{})).Add(float64(state.ReconciledNodes))
+			}
 
-	if err != nil {
-		log.Error().
-			Err(err).
-			Str("node-pool", toName).
-			Msg("Error resizing node pool")
-		return
-	}
+			for _, t := range state.Transitions {
+				transitionTotals.With(metricLabels(prometheus.Labels{"from_phase": string(t.From), "to_phase": string(t.To)})).Inc()
+			}
 
-	zoneInfo, err := k.GetZones(toName)
-	actualNodeCount := Sum(zoneInfo)
-	amountOfZones := int64(len(zoneInfo))
-	expectedNodeCount := toNewSize * amountOfZones
+			if gcloudMonitoringClient != nil {
+				if err := gcloudMonitoringClient.WriteCycle(status, state.ZonesFrom.Sum(), state.ZonesTo.Sum()); err != nil {
+					log.Error().Err(err).Msg("Error writing Cloud Monitoring custom metrics")
+				}
+			}
 
-	log.Info().
-		Str("node-pool", toName).
-		Msgf("node pool sizes after resize actual: %d , expected: %d", actualNodeCount, expectedNodeCount)
+			// shut down like on SIGTERM, so the summary is reported before exiting successfully
+			if *exitOnConverged && state.Converged() {
+				log.Info().
+					Str("reason", state.SkipReason).
+					Msg("Node pools converged, exiting")
 
-	if expectedNodeCount < int64(actualNodeCount) {
-		log.Error().
-			Str("node-pool", toName).
-			Msgf("node pool has less nodes than expected after resize actual: %d , expected: %d", actualNodeCount, expectedNodeCount)
-		return
-	}
+				gracefulShutdown <- syscall.SIGTERM
+				return
+			}
 
-	// Remove node
-	fromNewSize := int64(fromCurrentSize - 1)
+			if cycleSchedule == nil {
+				log.Info().Msgf("One cycle done, sleeping for %v seconds...", sleepTime)
+				signalControl.Wait(sleepTime)
+			}
+		}
+	}(waitGroup)
 
-	log.Info().
-		Str("node-pool", fromName).
-		Msgf("Removing 1 node from the pool for each region, currently %d node(s), expecting %d node(s) per region", fromCurrentSize, fromNewSize)
+	foundation.HandleGracefulShutdown(gracefulShutdown, waitGroup)
 
-	err = g.SetNodePoolSize(fromName, fromNewSize)
+	report := summary.Stop()
+	log.Info().
+		Interface("summary", report).
+		Msgf("Ran %d cycle(s), shifted %d time(s), failed %d time(s)", report.Cycles, report.Shifts, report.Failures)
 
-	if err != nil {
-		log.Error().
-			Err(err).
-			Str("node-pool", fromName).
-			Msg("Error resizing node pool")
+	if *shutdownSummaryWebhook && webhook != nil {
+		if err := webhook.SendSummary(report); err != nil {
+			log.Error().Err(err).Msg("Error posting the shutdown summary to the webhook")
+		}
 	}
+}
+
+// drainMetrics exports the progress of drains, one node is drained at a time
+type drainMetrics struct{}
+
+func (drainMetrics) PodsRemaining(node string, count int) {
+	drainRemaining.With(metricLabels(prometheus.Labels{})).Set(float64(count))
+}
+
+func (drainMetrics) PodEvicted(node string, duration time.Duration) {
+	evictionSeconds.With(metricLabels(prometheus.Labels{})).Observe(duration.Seconds())
+}
 
-	return
+// metricLabels adds the cluster and node pool labels shared by all exported series
+func metricLabels(labels prometheus.Labels) prometheus.Labels {
+	labels["cluster"] = clusterName
+	labels["from_pool"] = *nodePoolFrom
+	labels["to_pool"] = *nodePoolTo
+	return labels
 }
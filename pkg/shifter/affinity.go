@@ -0,0 +1,136 @@
+package shifter
+
+import (
+	"math"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WorkloadFit estimates how much of the workload of the node pool shifted from can move to the node pool shifted to:
+// the pods running on it that need eviction and the pending pods that would run on it, and how many of them fit the
+// node pool shifted to; the workloads that don't are counted by namespace/kind/name of their controller
+type WorkloadFit struct {
+	Pods       int            `json:"pods"`
+	Fitting    int            `json:"fitting"`
+	Mismatched map[string]int `json:"mismatched,omitempty"`
+}
+
+// Ratio returns the share of the pods that fit the node pool shifted to, 1 without any pod
+func (f WorkloadFit) Ratio() float64 {
+	if f.Pods == 0 {
+		return 1
+	}
+
+	return float64(f.Fitting) / float64(f.Pods)
+}
+
+// TopMismatches returns up to n workloads with the most pods that don't fit, by decreasing number of pods
+func (f WorkloadFit) TopMismatches(n int) (workloads []string) {
+	for workload := range f.Mismatched {
+		workloads = append(workloads, workload)
+	}
+
+	sort.Slice(workloads, func(i, j int) bool {
+		if f.Mismatched[workloads[i]] != f.Mismatched[workloads[j]] {
+			return f.Mismatched[workloads[i]] > f.Mismatched[workloads[j]]
+		}
+		return workloads[i] < workloads[j]
+	})
+
+	if len(workloads) > n {
+		workloads = workloads[:n]
+	}
+
+	return
+}
+
+// AnalyzeWorkloadFit checks the pods running on the given nodes of the node pool shifted from and the unschedulable
+// pods fitting that node pool against the profile of the node pool shifted to
+func AnalyzeWorkloadFit(pods []v1.Pod, nodesFrom []v1.Node, from, to NodeProfile) WorkloadFit {
+	fit := WorkloadFit{
+		Mismatched: map[string]int{},
+	}
+
+	onNodesFrom := map[string]bool{}
+	for _, node := range nodesFrom {
+		onNodesFrom[node.Name] = true
+	}
+
+	for _, pod := range pods {
+		running := onNodesFrom[pod.Spec.NodeName] && needsEviction(pod)
+		pending := pod.Spec.NodeName == "" && len(FindUnschedulablePods([]v1.Pod{pod})) > 0 && PodFitsProfile(pod, from)
+
+		if !running && !pending {
+			continue
+		}
+
+		fit.Pods++
+
+		if PodFitsProfile(pod, to) {
+			fit.Fitting++
+			continue
+		}
+
+		fit.Mismatched[workloadName(pod)]++
+	}
+
+	return fit
+}
+
+// analyzeWorkloadFit lists the nodes of the node pool shifted from and all pods to check how much of the workload fits
+// the given profile of the node pool shifted to
+func (s *Shifter) analyzeWorkloadFit(to NodeProfile) (fit WorkloadFit, err error) {
+	nodesFrom, err := s.kubernetes.GetNodeList(s.options.NodePoolFrom)
+	if err != nil {
+		return
+	}
+
+	pods, err := s.kubernetes.GetPods("", "")
+	if err != nil {
+		return
+	}
+
+	from := NodeProfile{}
+	if len(nodesFrom.Items) > 0 {
+		from = NodeProfile{
+			Labels: nodesFrom.Items[0].Labels,
+			Taints: nodesFrom.Items[0].Spec.Taints,
+		}
+	}
+
+	return AnalyzeWorkloadFit(pods.Items, nodesFrom.Items, from, to), nil
+}
+
+// workloadName returns the namespace/kind/name of the controller of a pod, or namespace/name of a pod without one
+func workloadName(pod v1.Pod) string {
+	if controller := metav1.GetControllerOf(&pod); controller != nil {
+		return pod.Namespace + "/" + controller.Kind + "/" + controller.Name
+	}
+
+	return pod.Namespace + "/" + pod.Name
+}
+
+// limitVictimCounts lowers the number of nodes to remove per zone so that, of the nodes of each zone, at least the share
+// of the workload that can't move to the node pool shifted to stays; it returns the zones left with nodes to remove and
+// the largest count
+func limitVictimCounts(zones []string, counts, sizes map[string]int, ratio float64) (limitedZones []string, batchSize int) {
+	for _, zone := range zones {
+		keep := int(math.Ceil((1 - ratio) * float64(sizes[zone])))
+
+		if movable := sizes[zone] - keep; counts[zone] > movable {
+			counts[zone] = movable
+		}
+
+		if counts[zone] > 0 {
+			limitedZones = append(limitedZones, zone)
+		}
+
+		if counts[zone] > batchSize {
+			batchSize = counts[zone]
+		}
+	}
+
+	return
+}
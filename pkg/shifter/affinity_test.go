@@ -0,0 +1,53 @@
+package shifter
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAnalyzeWorkloadFit(t *testing.T) {
+	isController := true
+	owner := func(name string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{Kind: "ReplicaSet", Name: name, Controller: &isController}}
+	}
+
+	from := NodeProfile{Labels: map[string]string{"cloud.google.com/gke-nodepool": "default-pool"}}
+	to := NodeProfile{Labels: map[string]string{"cloud.google.com/gke-nodepool": "preemptible-pool"}}
+	pinned := map[string]string{"cloud.google.com/gke-nodepool": "default-pool"}
+	unschedulable := v1.PodStatus{Phase: v1.PodPending, Conditions: []v1.PodCondition{{Type: v1.PodScheduled, Status: v1.ConditionFalse, Reason: v1.PodReasonUnschedulable}}}
+
+	pods := []v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-a", OwnerReferences: owner("web")}, Spec: v1.PodSpec{NodeName: "node-1"}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "db-a", OwnerReferences: owner("db")}, Spec: v1.PodSpec{NodeName: "node-1", NodeSelector: pinned}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "db-b", OwnerReferences: owner("db")}, Spec: v1.PodSpec{NodeSelector: pinned}, Status: unschedulable},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-b", OwnerReferences: owner("web")}, Spec: v1.PodSpec{NodeName: "node-2"}},
+	}
+
+	fit := AnalyzeWorkloadFit(pods, []v1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}}, from, to)
+
+	if fit.Pods != 3 || fit.Fitting != 1 {
+		t.Errorf("AnalyzeWorkloadFit, expected 1 of 3 pods to fit got %d of %d", fit.Fitting, fit.Pods)
+	}
+
+	if !reflect.DeepEqual(fit.TopMismatches(5), []string{"shop/ReplicaSet/db"}) {
+		t.Errorf("AnalyzeWorkloadFit, expected shop/ReplicaSet/db to mismatch got %v", fit.TopMismatches(5))
+	}
+}
+
+func TestLimitVictimCounts(t *testing.T) {
+	counts := map[string]int{"a": 2, "b": 2, "c": 1}
+	sizes := map[string]int{"a": 10, "b": 2, "c": 1}
+
+	zones, batchSize := limitVictimCounts([]string{"a", "b", "c"}, counts, sizes, 0.5)
+
+	if !reflect.DeepEqual(zones, []string{"a", "b"}) || batchSize != 2 {
+		t.Errorf("limitVictimCounts, expected zones [a b] and batch size 2 got %v and %d", zones, batchSize)
+	}
+
+	if counts["b"] != 1 || counts["c"] != 0 {
+		t.Errorf("limitVictimCounts, expected 1 node to remove in b and none in c got %v", counts)
+	}
+}
@@ -0,0 +1,82 @@
+package shifter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// annotationPlanHash holds the hash of the plan published in the approval ConfigMap
+	annotationPlanHash = "estafette.io/plan-hash"
+
+	// annotationPlanApproved is set by an operator or automation to the hash of the plan it approves
+	annotationPlanApproved = "estafette.io/plan-approved"
+)
+
+// ShiftPlan describes the next action the shifter wants to take
+type ShiftPlan struct {
+	Cluster      string   `json:"cluster"`
+	NodePoolFrom string   `json:"nodePoolFrom"`
+	NodePoolTo   string   `json:"nodePoolTo"`
+	ToSize       int      `json:"toSize"`
+	ToNewSize    int      `json:"toNewSize"`
+	RemoveNodes  []string `json:"removeNodes"`
+}
+
+// Hash returns a stable hash of the plan, used to match the approval
+func (p ShiftPlan) Hash() string {
+	data, _ := json.Marshal(p)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// checkPlanApproval publishes the plan to the approval ConfigMap and returns whether the operator approved this exact
+// plan by setting the approved annotation to its hash
+func checkPlanApproval(k KubernetesClient, name string, plan ShiftPlan) (approved bool, err error) {
+	hash := plan.Hash()
+
+	configMap, err := k.GetConfigMap(name)
+	if err != nil {
+		return
+	}
+
+	if configMap != nil && configMap.Annotations[annotationPlanHash] == hash {
+		return configMap.Annotations[annotationPlanApproved] == hash, nil
+	}
+
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return
+	}
+
+	// a new plan replaces the previous one and invalidates its approval
+	err = k.UpsertConfigMap(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Annotations: map[string]string{
+				annotationPlanHash: hash,
+			},
+		},
+		Data: map[string]string{
+			"plan": string(data),
+		},
+	})
+
+	return false, err
+}
+
+// consumePlanApproval removes the approval once the plan has been executed so it can't be executed twice
+func consumePlanApproval(k KubernetesClient, name string) (err error) {
+	configMap, err := k.GetConfigMap(name)
+	if err != nil || configMap == nil {
+		return
+	}
+
+	delete(configMap.Annotations, annotationPlanApproved)
+
+	return k.UpsertConfigMap(configMap)
+}
@@ -0,0 +1,167 @@
+package shifter
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// taintDeletionCandidate is set by the cluster-autoscaler on nodes it considers unneeded and might remove
+	taintDeletionCandidate = "DeletionCandidateOfClusterAutoscaler"
+
+	// taintToBeDeleted is set by the cluster-autoscaler on nodes it is removing
+	taintToBeDeleted = "ToBeDeletedByClusterAutoscaler"
+)
+
+// AutoscalerNodeGroupStatus holds the scale up and scale down status of a single cluster-autoscaler node group
+type AutoscalerNodeGroupStatus struct {
+	Name      string
+	ScaleUp   string
+	ScaleDown string
+}
+
+// IsScaling returns true when the cluster-autoscaler is scaling the node group up or down; the autoscaler reports an
+// ongoing scale down as CandidatesPresent since nodes are only removed once they have been unneeded for a while
+func (s AutoscalerNodeGroupStatus) IsScaling() bool {
+	return s.ScaleUp == "InProgress" || s.ScaleDown == "CandidatesPresent"
+}
+
+// BelongsToNodePool returns true if the node group is one of the instance groups backing a node pool, given the
+// instanceGroupUrls of the node pool; the autoscaler lists the groups under another host and as instanceGroups rather
+// than instanceGroupManagers, so urls are compared by project, zone and name
+func (s AutoscalerNodeGroupStatus) BelongsToNodePool(urls []string) bool {
+	name := instanceGroupPath(s.Name)
+	if name == "" {
+		return false
+	}
+
+	for _, url := range urls {
+		if instanceGroupPath(url) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// instanceGroupPath returns the project/zone/name of an instance group url, empty if the url isn't the one of an
+// instance group
+func instanceGroupPath(url string) string {
+	var project, zone, name string
+
+	s := strings.Split(url, "/")
+	for i := 0; i+1 < len(s); i++ {
+		switch s[i] {
+		case "projects":
+			project = s[i+1]
+		case "zones":
+			zone = s[i+1]
+		case "instanceGroupManagers", "instanceGroups":
+			name = s[i+1]
+		}
+	}
+
+	if project == "" || zone == "" || name == "" {
+		return ""
+	}
+
+	return project + "/" + zone + "/" + name
+}
+
+// ParseAutoscalerStatus parses the NodeGroups section of the status written by the cluster-autoscaler e.g.
+//
+//	NodeGroups:
+//	  Name:        https://content.googleapis.com/compute/v1/projects/p/zones/z/instanceGroups/gke-c-pool-1234-grp
+//	  Health:      Healthy (ready=3 unready=0 notStarted=0 longNotStarted=0 registered=3 longUnregistered=0 cloudProviderTarget=3 (minSize=1, maxSize=5))
+//	  ScaleUp:     NoActivity (ready=3 cloudProviderTarget=3)
+//	  ScaleDown:   NoCandidates (candidates=0)
+func ParseAutoscalerStatus(status string) (nodeGroups []AutoscalerNodeGroupStatus) {
+	inNodeGroups := false
+
+	for _, line := range strings.Split(status, "\n") {
+		line = strings.TrimSpace(line)
+
+		if line == "NodeGroups:" {
+			inNodeGroups = true
+			continue
+		}
+
+		if !inNodeGroups {
+			continue
+		}
+
+		keyValue := strings.SplitN(line, ":", 2)
+		if len(keyValue) != 2 {
+			continue
+		}
+
+		key := strings.TrimSpace(keyValue[0])
+		value := strings.Fields(keyValue[1])
+
+		if len(value) == 0 {
+			continue
+		}
+
+		switch key {
+		case "Name":
+			nodeGroups = append(nodeGroups, AutoscalerNodeGroupStatus{Name: value[0]})
+		case "ScaleUp":
+			if len(nodeGroups) > 0 {
+				nodeGroups[len(nodeGroups)-1].ScaleUp = value[0]
+			}
+		case "ScaleDown":
+			if len(nodeGroups) > 0 {
+				nodeGroups[len(nodeGroups)-1].ScaleDown = value[0]
+			}
+		}
+	}
+
+	return
+}
+
+// FindScalingNodePool returns one of the given node pools the cluster-autoscaler is currently scaling, node pools are
+// given with the urls of their instance groups by name
+func FindScalingNodePool(status string, nodePools map[string][]string) (name string, scaling bool) {
+	for _, nodeGroup := range ParseAutoscalerStatus(status) {
+		if !nodeGroup.IsScaling() {
+			continue
+		}
+
+		for name, urls := range nodePools {
+			if nodeGroup.BelongsToNodePool(urls) {
+				return name, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// IsScaleDownCandidate returns true if the cluster-autoscaler marked the node as unneeded or is already removing it
+func IsScaleDownCandidate(node v1.Node) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == taintDeletionCandidate || taint.Key == taintToBeDeleted {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsRetired returns true if the node was drained in cordon only mode and is left for the cluster-autoscaler to remove
+func IsRetired(node v1.Node) bool {
+	_, ok := node.Labels[RetiredLabel]
+	return ok
+}
+
+// FindScaleDownCandidates returns the names of the nodes the cluster-autoscaler marked for scale down
+func FindScaleDownCandidates(nodes []v1.Node) (names []string) {
+	for _, node := range nodes {
+		if IsScaleDownCandidate(node) {
+			names = append(names, node.Name)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,100 @@
+package shifter
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testAutoscalerStatus = `Cluster-autoscaler status at 2021-09-01 10:00:00.000000000 +0000 UTC:
+Cluster-wide:
+  Health:      Healthy (ready=4 unready=0 notStarted=0 longNotStarted=0 registered=4 longUnregistered=0)
+  ScaleUp:     InProgress (ready=4 registered=4)
+  ScaleDown:   NoCandidates (candidates=0)
+
+NodeGroups:
+  Name:        https://content.googleapis.com/compute/v1/projects/p/zones/europe-west1-b/instanceGroups/gke-c-default-pool-1234abcd-grp
+  Health:      Healthy (ready=2 unready=0 notStarted=0 longNotStarted=0 registered=2 longUnregistered=0 cloudProviderTarget=2 (minSize=0, maxSize=5))
+  ScaleUp:     NoActivity (ready=2 cloudProviderTarget=2)
+  ScaleDown:   NoCandidates (candidates=0)
+
+  Name:        https://content.googleapis.com/compute/v1/projects/p/zones/europe-west1-b/instanceGroups/gke-c-preemptible-pool-5678abcd-grp
+  Health:      Healthy (ready=2 unready=0 notStarted=0 longNotStarted=0 registered=2 longUnregistered=0 cloudProviderTarget=3 (minSize=0, maxSize=5))
+  ScaleUp:     InProgress (ready=2 cloudProviderTarget=3)
+  ScaleDown:   NoCandidates (candidates=0)
+`
+
+func TestParseAutoscalerStatus(t *testing.T) {
+	nodeGroups := ParseAutoscalerStatus(testAutoscalerStatus)
+
+	if len(nodeGroups) != 2 {
+		t.Fatalf("ParseAutoscalerStatus, expected 2 node groups got %d", len(nodeGroups))
+	}
+
+	if nodeGroups[1].ScaleUp != "InProgress" || nodeGroups[1].ScaleDown != "NoCandidates" {
+		t.Errorf("ParseAutoscalerStatus, expected InProgress/NoCandidates got %s/%s", nodeGroups[1].ScaleUp, nodeGroups[1].ScaleDown)
+	}
+}
+
+func TestFindScalingNodePool(t *testing.T) {
+	defaultPool := []string{"https://www.googleapis.com/compute/v1/projects/p/zones/europe-west1-b/instanceGroupManagers/gke-c-default-pool-1234abcd-grp"}
+	preemptiblePool := []string{"https://www.googleapis.com/compute/v1/projects/p/zones/europe-west1-b/instanceGroupManagers/gke-c-preemptible-pool-5678abcd-grp"}
+
+	name, scaling := FindScalingNodePool(testAutoscalerStatus, map[string][]string{"default-pool": defaultPool, "preemptible-pool": preemptiblePool})
+	if !scaling || name != "preemptible-pool" {
+		t.Errorf("FindScalingNodePool, expected preemptible-pool got %q", name)
+	}
+
+	_, scaling = FindScalingNodePool(testAutoscalerStatus, map[string][]string{"default-pool": defaultPool})
+	if scaling {
+		t.Errorf("FindScalingNodePool, expected default-pool not to be scaling")
+	}
+
+	// the name of a node pool within the name of another node pool's instance group doesn't make it scale
+	_, scaling = FindScalingNodePool(testAutoscalerStatus, map[string][]string{"pool": {"https://www.googleapis.com/compute/v1/projects/p/zones/europe-west1-b/instanceGroupManagers/gke-c-pool-9999abcd-grp"}})
+	if scaling {
+		t.Errorf("FindScalingNodePool, expected pool not to be scaling")
+	}
+}
+
+func TestInstanceGroupPath(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://www.googleapis.com/compute/v1/projects/p/zones/europe-west1-b/instanceGroupManagers/gke-c-pool-1234-grp", "p/europe-west1-b/gke-c-pool-1234-grp"},
+		{"https://content.googleapis.com/compute/v1/projects/p/zones/europe-west1-b/instanceGroups/gke-c-pool-1234-grp", "p/europe-west1-b/gke-c-pool-1234-grp"},
+		{"gke-c-pool-1234-grp", ""},
+	}
+
+	for _, test := range tests {
+		if output := instanceGroupPath(test.url); output != test.expected {
+			t.Errorf("instanceGroupPath(%v), expected %q got %q", test.url, test.expected, output)
+		}
+	}
+}
+
+func TestFindScaleDownCandidates(t *testing.T) {
+	nodes := []v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-b"},
+			Spec:       v1.NodeSpec{Taints: []v1.Taint{{Key: "DeletionCandidateOfClusterAutoscaler", Effect: v1.TaintEffectPreferNoSchedule}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-c"},
+			Spec:       v1.NodeSpec{Taints: []v1.Taint{{Key: "ToBeDeletedByClusterAutoscaler", Effect: v1.TaintEffectNoSchedule}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-d"},
+			Spec:       v1.NodeSpec{Taints: []v1.Taint{{Key: "cloud.google.com/gke-preemptible", Effect: v1.TaintEffectNoSchedule}}},
+		},
+	}
+
+	output := FindScaleDownCandidates(nodes)
+	if !reflect.DeepEqual(output, []string{"node-b", "node-c"}) {
+		t.Errorf("FindScaleDownCandidates, expected [node-b node-c] got %v", output)
+	}
+}
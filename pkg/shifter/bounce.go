@@ -0,0 +1,39 @@
+package shifter
+
+import (
+	"time"
+)
+
+// BounceTracker detects the cluster-autoscaler undoing a shift by growing the node pool shifted from again within a
+// window after the shift
+type BounceTracker struct {
+	Window         time.Duration
+	shiftedAt      time.Time
+	sizeAfterShift int
+}
+
+// RecordShift records a shift and the size of the node pool shifted from right after it
+func (b *BounceTracker) RecordShift(at time.Time, sizeAfterShift int) {
+	b.shiftedAt = at
+	b.sizeAfterShift = sizeAfterShift
+}
+
+// Check returns true if the node pool shifted from grew within the window after the last shift, a shift is only
+// reported as bounced once
+func (b *BounceTracker) Check(now time.Time, size int) (bounced bool) {
+	if b.shiftedAt.IsZero() {
+		return false
+	}
+
+	if now.Sub(b.shiftedAt) > b.Window {
+		b.shiftedAt = time.Time{}
+		return false
+	}
+
+	if size > b.sizeAfterShift {
+		b.shiftedAt = time.Time{}
+		return true
+	}
+
+	return false
+}
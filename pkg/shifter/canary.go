@@ -0,0 +1,155 @@
+package shifter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CanaryLabel marks the canary pods probing the node pool shifted to
+const CanaryLabel = "estafette.io/node-pool-shifter-canary"
+
+// DefaultCanaryImage is the image of the canary pods, it does nothing but run
+const DefaultCanaryImage = "k8s.gcr.io/pause:3.5"
+
+// canaryFailureReasons are the container waiting reasons a canary pod never recovers from within its timeout
+var canaryFailureReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+	"CrashLoopBackOff":           true,
+	"RunContainerError":          true,
+}
+
+// newCanaryPod returns a pod constrained to the given node pool, tolerating only the taints its nodes are expected to
+// carry, so a node pool with a broken node image or unexpected taints fails to run it
+func newCanaryPod(name, nodePool, image string, taints []v1.Taint) *v1.Pod {
+	tolerations := []v1.Toleration{}
+	for _, taint := range taints {
+		tolerations = append(tolerations, v1.Toleration{
+			Key:      taint.Key,
+			Operator: v1.TolerationOpEqual,
+			Value:    taint.Value,
+			Effect:   taint.Effect,
+		})
+	}
+
+	requests := v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("10m"),
+		v1.ResourceMemory: resource.MustParse("16Mi"),
+	}
+
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				CanaryLabel: nodePool,
+			},
+		},
+		Spec: v1.PodSpec{
+			NodeSelector: map[string]string{
+				"cloud.google.com/gke-nodepool": nodePool,
+			},
+			Tolerations:   tolerations,
+			RestartPolicy: v1.RestartPolicyNever,
+			Containers: []v1.Container{{
+				Name:  "canary",
+				Image: image,
+				Resources: v1.ResourceRequirements{
+					Requests: requests,
+					Limits:   requests,
+				},
+			}},
+		},
+	}
+}
+
+// canaryPodStatus returns whether a canary pod is running, or why it failed for good
+func canaryPodStatus(pod v1.Pod) (running bool, failure string) {
+	switch pod.Status.Phase {
+	case v1.PodRunning:
+		return true, ""
+	case v1.PodFailed, v1.PodSucceeded:
+		return false, fmt.Sprintf("pod %v: %v", pod.Status.Phase, pod.Status.Reason)
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil && canaryFailureReasons[status.State.Waiting.Reason] {
+			return false, status.State.Waiting.Reason + ": " + status.State.Waiting.Message
+		}
+	}
+
+	return false, ""
+}
+
+// canaryPodPending describes why a canary pod isn't running yet, e.g. because no node of the pool tolerates it
+func canaryPodPending(pod v1.Pod) string {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse {
+			return condition.Reason + ": " + condition.Message
+		}
+	}
+
+	return "pod is " + string(pod.Status.Phase)
+}
+
+// probeCanary runs a canary pod on the node pool shifted to and waits for it to be running within the canary timeout;
+// the pod is removed whatever the outcome
+func (s *Shifter) probeCanary() (err error) {
+	k, nodePool := s.kubernetes, s.options.NodePoolTo
+
+	pod := newCanaryPod(fmt.Sprintf("node-pool-shifter-canary-%d", s.clock.Now().Unix()), nodePool, s.options.CanaryImage, s.options.TargetProfile.Taints)
+
+	if _, err = k.CreatePod(pod); err != nil {
+		return fmt.Errorf("Error creating canary pod %v:\n%v", pod.Name, err)
+	}
+
+	defer func() {
+		if err := k.DeletePod(pod.Name); err != nil {
+			log.Warn().
+				Err(err).
+				Str("pod", pod.Name).
+				Msg("Error deleting canary pod")
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.options.CanaryTimeout)*time.Second)
+	defer cancel()
+
+	for {
+		current, err := k.GetPod(pod.Name)
+		pending := ""
+
+		if err != nil {
+			pending = err.Error()
+		} else {
+			running, failure := canaryPodStatus(*current)
+
+			if running {
+				log.Info().
+					Str("node-pool", nodePool).
+					Str("node", current.Spec.NodeName).
+					Msg("Canary pod is running on the node pool")
+				return nil
+			}
+			if failure != "" {
+				return fmt.Errorf("Canary pod %v failed on node pool %v: %v", pod.Name, nodePool, failure)
+			}
+
+			pending = canaryPodPending(*current)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Canary pod %v isn't running on node pool %v after %d seconds: %v", pod.Name, nodePool, s.options.CanaryTimeout, pending)
+		case <-waitSeconds(s.clock, s.jitter, operationPollIntervalSecond):
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package shifter
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestNewCanaryPod(t *testing.T) {
+	pod := newCanaryPod("canary", "preemptible-pool", DefaultCanaryImage, []v1.Taint{
+		{Key: "cloud.google.com/gke-preemptible", Value: "true", Effect: v1.TaintEffectNoSchedule},
+	})
+
+	if pod.Spec.NodeSelector["cloud.google.com/gke-nodepool"] != "preemptible-pool" {
+		t.Errorf("newCanaryPod, expected the pod to be constrained to preemptible-pool got %v", pod.Spec.NodeSelector)
+	}
+	if len(pod.Spec.Tolerations) != 1 || pod.Spec.Tolerations[0].Key != "cloud.google.com/gke-preemptible" {
+		t.Errorf("newCanaryPod, expected the pod to tolerate the expected taint got %v", pod.Spec.Tolerations)
+	}
+}
+
+func TestCanaryPodStatus(t *testing.T) {
+	waiting := func(reason string) v1.Pod {
+		pod := v1.Pod{}
+		pod.Status.Phase = v1.PodPending
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{{
+			State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: reason}},
+		}}
+		return pod
+	}
+
+	tests := []struct {
+		name    string
+		pod     v1.Pod
+		running bool
+		failed  bool
+	}{
+		{"running", v1.Pod{Status: v1.PodStatus{Phase: v1.PodRunning}}, true, false},
+		{"failed", v1.Pod{Status: v1.PodStatus{Phase: v1.PodFailed}}, false, true},
+		{"image pull", waiting("ImagePullBackOff"), false, true},
+		{"creating", waiting("ContainerCreating"), false, false},
+		{"unscheduled", v1.Pod{Status: v1.PodStatus{Phase: v1.PodPending}}, false, false},
+	}
+
+	for _, test := range tests {
+		running, failure := canaryPodStatus(test.pod)
+
+		if running != test.running || (failure != "") != test.failed {
+			t.Errorf("canaryPodStatus(%v), expected running %v and failed %v got %v and %q", test.name, test.running, test.failed, running, failure)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package shifter
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// autoProvisionedPoolPrefix starts the names of the node pools GKE node auto-provisioning creates
+const autoProvisionedPoolPrefix = "nap-"
+
+// FindAutoProvisionedPools returns the names of the node pools created by node auto-provisioning the given nodes belong to
+func FindAutoProvisionedPools(nodes []v1.Node) (pools []string) {
+	seen := map[string]bool{}
+
+	for _, node := range nodes {
+		pool := node.Labels["cloud.google.com/gke-nodepool"]
+		if strings.HasPrefix(pool, autoProvisionedPoolPrefix) && !seen[pool] {
+			seen[pool] = true
+			pools = append(pools, pool)
+		}
+	}
+	sort.Strings(pools)
+
+	return
+}
+
+// filterPoolNodes returns the nodes belonging to one of the given node pools
+func filterPoolNodes(nodes []v1.Node, pools ...string) (filtered []v1.Node) {
+	for _, node := range nodes {
+		for _, pool := range pools {
+			if node.Labels["cloud.google.com/gke-nodepool"] == pool {
+				filtered = append(filtered, node)
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// minNodesForFraction returns the number of nodes per zone a node pool spread over the given zones has to keep to hold
+// at least the given fraction of the capacity of the cluster, rounding up
+func minNodesForFraction(fraction float64, capacity, zones int) int {
+	if fraction <= 0 || zones == 0 {
+		return 0
+	}
+
+	total := int(math.Ceil(fraction * float64(capacity)))
+
+	return (total + zones - 1) / zones
+}
+
+// capacityNodes returns the nodes counting as capacity of the cluster: all nodes, or only those of the node pools
+// shifted from and to when restricted to the configured pools, so pools created by node auto-provisioning don't count
+func (s *Shifter) capacityNodes() ([]v1.Node, error) {
+	nodes, err := s.kubernetes.GetNodeList("")
+	if err != nil {
+		return nil, err
+	}
+
+	if s.options.ConfiguredPoolsOnly {
+		return filterPoolNodes(nodes.Items, s.options.NodePoolFrom, s.options.NodePoolTo), nil
+	}
+
+	return nodes.Items, nil
+}
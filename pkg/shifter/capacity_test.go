@@ -0,0 +1,50 @@
+package shifter
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMinNodesForFraction(t *testing.T) {
+	tests := []struct {
+		fraction float64
+		capacity int
+		zones    int
+		expected int
+	}{
+		{0, 30, 3, 0},
+		{0.2, 30, 3, 2},
+		{0.2, 31, 3, 3},
+		{0.2, 10, 3, 1},
+		{0.5, 4, 1, 2},
+		{0.2, 30, 0, 0},
+	}
+
+	for _, test := range tests {
+		if output := minNodesForFraction(test.fraction, test.capacity, test.zones); output != test.expected {
+			t.Errorf("minNodesForFraction(%v, %d, %d), expected %d got %d", test.fraction, test.capacity, test.zones, test.expected, output)
+		}
+	}
+}
+
+func TestFindAutoProvisionedPools(t *testing.T) {
+	node := func(pool string) v1.Node {
+		return v1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"cloud.google.com/gke-nodepool": pool}}}
+	}
+
+	nodes := []v1.Node{
+		node("default-pool"),
+		node("nap-n1-highmem-4-1abc2def"),
+		node("preemptible-pool"),
+		node("nap-e2-standard-2-3ghi4jkl"),
+		node("nap-n1-highmem-4-1abc2def"),
+	}
+
+	output := FindAutoProvisionedPools(nodes)
+	if !reflect.DeepEqual(output, []string{"nap-e2-standard-2-3ghi4jkl", "nap-n1-highmem-4-1abc2def"}) {
+		t.Errorf("FindAutoProvisionedPools, expected [nap-e2-standard-2-3ghi4jkl nap-n1-highmem-4-1abc2def] got %v", output)
+	}
+}
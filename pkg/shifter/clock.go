@@ -0,0 +1,27 @@
+package shifter
+
+import (
+	"time"
+)
+
+// Clock tells the time and waits, so the shift loop and its backoffs can run against a fake clock in tests
+type Clock interface {
+	Now() time.Time
+	After(time.Duration) <-chan time.Time
+}
+
+// realClock is the wall clock
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// waitSeconds returns a channel receiving once the jittered number of seconds passed on the clock
+func waitSeconds(c Clock, j Jitter, seconds int) <-chan time.Time {
+	return c.After(time.Duration(j.Apply(seconds)) * time.Second)
+}
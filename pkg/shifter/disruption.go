@@ -0,0 +1,83 @@
+package shifter
+
+import (
+	"errors"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// errTooDisruptive is returned when not enough nodes can be removed within the maximum number of pods to disrupt
+var errTooDisruptive = errors.New("removal would disrupt more pods than allowed")
+
+// Disruption estimates what a removal disrupts: the pods to evict and the distinct workloads they belong to
+type Disruption struct {
+	Pods      int `json:"pods"`
+	Workloads int `json:"workloads"`
+}
+
+// EstimateDisruption returns the disruption of removing the given victims, a workload spread over several of them counts
+// once
+func EstimateDisruption(victims []Victim) (disruption Disruption) {
+	workloads := map[string]bool{}
+
+	for _, v := range victims {
+		disruption.Pods += v.Pods
+
+		for workload := range v.Workloads {
+			workloads[workload] = true
+		}
+	}
+
+	disruption.Workloads = len(workloads)
+
+	return
+}
+
+// disruptedWorkload returns the namespace/kind/name of the workload a pod belongs to, a pod of a ReplicaSet created by a
+// Deployment is attributed to the Deployment
+func disruptedWorkload(pod v1.Pod) string {
+	controller := metav1.GetControllerOf(&pod)
+	hash := pod.Labels["pod-template-hash"]
+
+	if controller != nil && controller.Kind == "ReplicaSet" && hash != "" && strings.HasSuffix(controller.Name, "-"+hash) {
+		return pod.Namespace + "/Deployment/" + strings.TrimSuffix(controller.Name, "-"+hash)
+	}
+
+	return workloadName(pod)
+}
+
+// countPodsToEvictByWorkload returns the number of pods to evict per workload
+func countPodsToEvictByWorkload(pods []v1.Pod) map[string]int {
+	workloads := map[string]int{}
+	for _, pod := range pods {
+		if needsEviction(pod) {
+			workloads[disruptedWorkload(pod)]++
+		}
+	}
+
+	return workloads
+}
+
+// pickVictims picks count of the given candidates in order, passing over those whose pods don't fit the pods left to
+// disrupt, e.g. for a node with less impact; budget is nil without a maximum and is decreased by the pods picked. It
+// returns fewer victims than asked for if not enough candidates fit
+func pickVictims(candidates []Victim, count int, budget *int) (picked []Victim) {
+	for _, candidate := range candidates {
+		if len(picked) == count {
+			break
+		}
+
+		if budget != nil {
+			if candidate.Pods > *budget {
+				continue
+			}
+			*budget -= candidate.Pods
+		}
+
+		picked = append(picked, candidate)
+	}
+
+	return
+}
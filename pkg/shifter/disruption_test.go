@@ -0,0 +1,80 @@
+package shifter
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEstimateDisruption(t *testing.T) {
+	victims := []Victim{
+		{Node: "node-1", Pods: 3, Workloads: map[string]int{"web/Deployment/frontend": 2, "web/StatefulSet/cache": 1}},
+		{Node: "node-2", Pods: 2, Workloads: map[string]int{"web/Deployment/frontend": 1, "jobs/Job/report": 1}},
+		{Node: "node-3"},
+	}
+
+	expected := Disruption{Pods: 5, Workloads: 3}
+
+	if output := EstimateDisruption(victims); output != expected {
+		t.Errorf("EstimateDisruption, expected %v got %v", expected, output)
+	}
+
+	if output := EstimateDisruption(nil); output != (Disruption{}) {
+		t.Errorf("EstimateDisruption without victims, expected none got %v", output)
+	}
+}
+
+func TestDisruptedWorkload(t *testing.T) {
+	controller := true
+	pod := func(name string, labels map[string]string, kind, owner string) v1.Pod {
+		pod := v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: name, Labels: labels}}
+		if kind != "" {
+			pod.OwnerReferences = []metav1.OwnerReference{{Kind: kind, Name: owner, Controller: &controller}}
+		}
+
+		return pod
+	}
+
+	tests := []struct {
+		pod      v1.Pod
+		expected string
+	}{
+		{pod("frontend-5d8f7c9b6-x2x4z", map[string]string{"pod-template-hash": "5d8f7c9b6"}, "ReplicaSet", "frontend-5d8f7c9b6"), "web/Deployment/frontend"},
+		{pod("frontend-abc12", nil, "ReplicaSet", "frontend"), "web/ReplicaSet/frontend"},
+		{pod("cache-0", map[string]string{"pod-template-hash": "5d8f7c9b6"}, "StatefulSet", "cache"), "web/StatefulSet/cache"},
+		{pod("debug", nil, "", ""), "web/debug"},
+	}
+
+	for _, test := range tests {
+		if output := disruptedWorkload(test.pod); output != test.expected {
+			t.Errorf("disruptedWorkload(%v), expected %v got %v", test.pod.Name, test.expected, output)
+		}
+	}
+}
+
+func TestPickVictims(t *testing.T) {
+	candidates := []Victim{{Node: "node-1", Pods: 8}, {Node: "node-2", Pods: 3}, {Node: "node-3", Pods: 4}, {Node: "node-4", Pods: 1}}
+
+	names := func(victims []Victim) (names []string) {
+		for _, v := range victims {
+			names = append(names, v.Node)
+		}
+		return
+	}
+
+	if output := names(pickVictims(candidates, 2, nil)); !reflect.DeepEqual(output, []string{"node-1", "node-2"}) {
+		t.Errorf("pickVictims without maximum, expected [node-1 node-2] got %v", output)
+	}
+
+	budget := 5
+	if output := names(pickVictims(candidates, 2, &budget)); !reflect.DeepEqual(output, []string{"node-2", "node-4"}) || budget != 1 {
+		t.Errorf("pickVictims within 5 pods, expected [node-2 node-4] with 1 pod left got %v with %d", output, budget)
+	}
+
+	budget = 2
+	if output := names(pickVictims(candidates, 2, &budget)); !reflect.DeepEqual(output, []string{"node-4"}) {
+		t.Errorf("pickVictims within 2 pods, expected [node-4] got %v", output)
+	}
+}
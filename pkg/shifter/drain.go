@@ -0,0 +1,289 @@
+package shifter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// drainPollIntervalSecond define the interval in second between each check of the pods left on a draining node
+	drainPollIntervalSecond = 5
+)
+
+// podKind classifies a pod by what manages it, which determines how it is affected by removing its node
+type podKind string
+
+const (
+	// podKindDaemonSet pods run on every node and are not evicted
+	podKindDaemonSet podKind = "daemonset"
+	// podKindMirror pods are static pods managed by the kubelet and are not evicted
+	podKindMirror podKind = "mirror"
+	// podKindControlled pods are recreated elsewhere by their controller once evicted
+	podKindControlled podKind = "controlled"
+	// podKindBare pods have no controller and are lost once evicted
+	podKindBare podKind = "bare"
+)
+
+// classifyPod returns the kind of a given pod
+func classifyPod(pod v1.Pod) podKind {
+	if _, ok := pod.Annotations[v1.MirrorPodAnnotationKey]; ok {
+		return podKindMirror
+	}
+
+	controller := metav1.GetControllerOf(&pod)
+
+	if controller == nil {
+		return podKindBare
+	}
+
+	if controller.Kind == "DaemonSet" {
+		return podKindDaemonSet
+	}
+
+	return podKindControlled
+}
+
+// needsEviction returns true if a given pod is still running and has to be evicted to drain its node
+func needsEviction(pod v1.Pod) bool {
+	if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return false
+	}
+
+	kind := classifyPod(pod)
+
+	return kind == podKindControlled || kind == podKindBare
+}
+
+// antiAffinityGroup returns the namespace and label selector of the pods a given pod keeps away from through pod
+// anti-affinity, the selector is empty for a pod without pod anti-affinity
+func antiAffinityGroup(pod v1.Pod) (namespace, selector string) {
+	if pod.Spec.Affinity == nil || pod.Spec.Affinity.PodAntiAffinity == nil {
+		return
+	}
+
+	antiAffinity := pod.Spec.Affinity.PodAntiAffinity
+	terms := antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	for _, weighted := range antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		terms = append(terms, weighted.PodAffinityTerm)
+	}
+
+	for _, term := range terms {
+		labelSelector, err := metav1.LabelSelectorAsSelector(term.LabelSelector)
+		if err != nil || labelSelector.Empty() {
+			continue
+		}
+
+		return pod.Namespace, labelSelector.String()
+	}
+
+	return
+}
+
+// isAntiAffinityGroupReady returns true if all members of an anti-affinity group running on other nodes than the given
+// one are ready, i.e. the replacement of a previously evicted member has been rescheduled
+func isAntiAffinityGroupReady(k KubernetesClient, node, namespace, selector string) (bool, error) {
+	pods, err := k.GetPods(namespace, selector)
+	if err != nil {
+		return false, err
+	}
+
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != node && !isPodReady(pod) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// DrainBlockedError is returned when a drain gave up while pod disruption budgets kept refusing evictions
+type DrainBlockedError struct {
+	Node string
+	Pods []string
+	Err  error
+}
+
+func (e *DrainBlockedError) Error() string {
+	return fmt.Sprintf("Node %v still has pod(s) %v whose eviction is refused by a pod disruption budget: %v", e.Node, strings.Join(e.Pods, ", "), e.Err)
+}
+
+func (e *DrainBlockedError) Unwrap() error {
+	return e.Err
+}
+
+// DrainObserver follows the progress of drains, e.g. to export it as metrics: the pods left to evict from the node
+// drained each round, and how long each evicted pod took to be gone
+type DrainObserver interface {
+	PodsRemaining(node string, count int)
+	PodEvicted(node string, duration time.Duration)
+}
+
+// nopDrainObserver ignores the progress of drains
+type nopDrainObserver struct{}
+
+func (nopDrainObserver) PodsRemaining(string, int)        {}
+func (nopDrainObserver) PodEvicted(string, time.Duration) {}
+
+// drainNode cordons a given node and evicts its pods, waiting until they are gone or the context is done; pods are
+// evicted by increasing deletion cost, the ones with a higher cost wait for the cheaper ones to be gone. When affinity
+// aware, members of the same anti-affinity group, e.g. an HA pair, are evicted one at a time and only once the previous
+// one has been rescheduled. With a namespace limit, at most that many pods of a namespace are evicted at once. The
+// observer follows the progress
+func drainNode(ctx context.Context, c Clock, k KubernetesClient, name string, affinityAware bool, namespaceLimit int, observer DrainObserver) (err error) {
+	log.Info().
+		Str("node", name).
+		Msg("Cordoning and draining node...")
+
+	err = k.SetNodeUnschedulable(name, true)
+
+	if err != nil {
+		return fmt.Errorf("Error cordoning node %v: %v", name, err)
+	}
+
+	// pods whose eviction a pod disruption budget refuses, logged once so their owners can be contacted
+	refused := map[string]bool{}
+
+	// time of the eviction of the pods still on the node, by namespace/name
+	evictedAt := map[string]time.Time{}
+
+	for {
+		pods, err := k.GetPodsOnNode(name)
+
+		if err != nil {
+			return fmt.Errorf("Error listing pods on node %v: %v", name, err)
+		}
+
+		remaining := 0
+		refusedNow := []string{}
+
+		// evicted pods no longer on the node are gone
+		onNode := map[string]bool{}
+		for _, pod := range pods.Items {
+			onNode[pod.Namespace+"/"+pod.Name] = true
+		}
+		for podName, at := range evictedAt {
+			if !onNode[podName] {
+				observer.PodEvicted(name, c.Now().Sub(at))
+				delete(evictedAt, podName)
+			}
+		}
+
+		// a group with a member still terminating waits for it to be gone
+		evictingGroups := map[string]bool{}
+		if affinityAware {
+			for _, pod := range pods.Items {
+				if namespace, selector := antiAffinityGroup(pod); selector != "" && pod.DeletionTimestamp != nil {
+					evictingGroups[namespace+"/"+selector] = true
+				}
+			}
+		}
+
+		// pods still terminating count towards the limit of their namespace
+		evictingPerNamespace := map[string]int{}
+		for _, pod := range pods.Items {
+			if needsEviction(pod) && pod.DeletionTimestamp != nil {
+				evictingPerNamespace[pod.Namespace]++
+			}
+		}
+
+		lowestCost, first := 0, true
+		for _, pod := range pods.Items {
+			if cost := podDeletionCost(pod); needsEviction(pod) && (first || cost < lowestCost) {
+				lowestCost, first = cost, false
+			}
+		}
+
+		for _, pod := range pods.Items {
+			if !needsEviction(pod) {
+				continue
+			}
+
+			remaining++
+
+			if pod.DeletionTimestamp != nil || podDeletionCost(pod) > lowestCost {
+				continue
+			}
+
+			if namespaceLimit > 0 && evictingPerNamespace[pod.Namespace] >= namespaceLimit {
+				log.Debug().
+					Str("node", name).
+					Str("pod", pod.Namespace+"/"+pod.Name).
+					Msg("Waiting for other pods of the namespace to be evicted")
+				continue
+			}
+
+			if namespace, selector := antiAffinityGroup(pod); affinityAware && selector != "" {
+				group := namespace + "/" + selector
+
+				if evictingGroups[group] {
+					continue
+				}
+
+				ready, err := isAntiAffinityGroupReady(k, name, namespace, selector)
+				if err != nil || !ready {
+					log.Debug().
+						Err(err).
+						Str("node", name).
+						Str("pod", pod.Namespace+"/"+pod.Name).
+						Msg("Waiting for the anti-affinity group of the pod to be rescheduled")
+					continue
+				}
+
+				evictingGroups[group] = true
+			}
+
+			// an eviction blocked by a pod disruption budget is retried on the next round
+			err := k.EvictPod(pod)
+
+			if err == nil {
+				evictingPerNamespace[pod.Namespace]++
+				evictedAt[pod.Namespace+"/"+pod.Name] = c.Now()
+			}
+
+			if errors.IsTooManyRequests(err) {
+				podName := pod.Namespace + "/" + pod.Name
+				refusedNow = append(refusedNow, podName)
+
+				if !refused[podName] {
+					refused[podName] = true
+					log.Warn().
+						Str("node", name).
+						Str("pod", podName).
+						Msg("Eviction refused by a pod disruption budget, retrying; contact the owner of the pod if it persists")
+				}
+			} else if err != nil && !errors.IsNotFound(err) {
+				log.Debug().
+					Err(err).
+					Str("node", name).
+					Str("pod", pod.Namespace+"/"+pod.Name).
+					Msg("Eviction refused, retrying")
+			}
+		}
+
+		observer.PodsRemaining(name, remaining)
+
+		if remaining == 0 {
+			return nil
+		}
+
+		log.Info().
+			Str("node", name).
+			Msgf("Waiting for %d pod(s) to be evicted...", remaining)
+
+		select {
+		case <-ctx.Done():
+			if len(refusedNow) > 0 {
+				return &DrainBlockedError{Node: name, Pods: refusedNow, Err: ctx.Err()}
+			}
+			return fmt.Errorf("Node %v still has %d pod(s) to evict: %v", name, remaining, ctx.Err())
+		case <-c.After(drainPollIntervalSecond * time.Second):
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package shifter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAntiAffinityGroup(t *testing.T) {
+	term := v1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "zeebe"}},
+		TopologyKey:   "kubernetes.io/hostname",
+	}
+
+	required := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "zeebe-0"},
+		Spec:       v1.PodSpec{Affinity: &v1.Affinity{PodAntiAffinity: &v1.PodAntiAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{term}}}},
+	}
+	preferred := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "zeebe-1"},
+		Spec:       v1.PodSpec{Affinity: &v1.Affinity{PodAntiAffinity: &v1.PodAntiAffinity{PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{{Weight: 100, PodAffinityTerm: term}}}}},
+	}
+	none := v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+
+	for _, pod := range []v1.Pod{required, preferred} {
+		namespace, selector := antiAffinityGroup(pod)
+		if namespace != "default" || selector != "app=zeebe" {
+			t.Errorf("antiAffinityGroup(%v), expected default app=zeebe got %v %v", pod.Name, namespace, selector)
+		}
+	}
+
+	if _, selector := antiAffinityGroup(none); selector != "" {
+		t.Errorf("antiAffinityGroup(web), expected no selector got %v", selector)
+	}
+}
+
+func TestDrainNode(t *testing.T) {
+	newCluster := func() *fakeKubernetes {
+		k := newFakeKubernetes(fakeNode("a-b-1", "pool-a", "europe-west1-b"))
+
+		isController := true
+		daemonSet := fakePod("kube-system", "kube-proxy", "a-b-1", false)
+		daemonSet.OwnerReferences = []metav1.OwnerReference{{Kind: "DaemonSet", Name: "kube-proxy", Controller: &isController}}
+
+		k.pods["a-b-1"] = []v1.Pod{fakePod("shop", "web-1", "a-b-1", true), fakePod("shop", "web-2", "a-b-1", true), daemonSet}
+
+		return k
+	}
+
+	k := newCluster()
+	if err := drainNode(context.Background(), &fakeClock{}, k, "a-b-1", false, 0, nopDrainObserver{}); err != nil {
+		t.Errorf("drainNode, expected no error got %v", err)
+	}
+	if !k.node("a-b-1").Spec.Unschedulable {
+		t.Errorf("drainNode, expected the node to be cordoned")
+	}
+	if !contains(k.calls, "EvictPod shop/web-1") || !contains(k.calls, "EvictPod shop/web-2") || contains(k.calls, "EvictPod kube-system/kube-proxy") {
+		t.Errorf("drainNode, expected the pods but the DaemonSet pod to be evicted got %v", k.calls)
+	}
+
+	k = newCluster()
+	k.errs["SetNodeUnschedulable a-b-1 true"] = errors.New("conflict")
+	if err := drainNode(context.Background(), &fakeClock{}, k, "a-b-1", false, 0, nopDrainObserver{}); err == nil || contains(k.calls, "EvictPod shop/web-1") {
+		t.Errorf("drainNode of a node failing to cordon, expected an error and no eviction got %v", err)
+	}
+
+	// a pod disruption budget keeps refusing the eviction until the deadline
+	k = newCluster()
+	k.errs["EvictPod shop/web-2"] = apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := drainNode(ctx, &fakeClock{}, k, "a-b-1", false, 0, nopDrainObserver{})
+
+	var blockedErr *DrainBlockedError
+	if !errors.As(err, &blockedErr) || blockedErr.Node != "a-b-1" || !reflect.DeepEqual(blockedErr.Pods, []string{"shop/web-2"}) {
+		t.Errorf("drainNode refused by a pod disruption budget, expected a DrainBlockedError for shop/web-2 got %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package shifter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// FindShortZones returns how many Ready nodes each of the given zones lacks to reach the expected number of nodes, moved
+// by the offset of the zone; zones that aren't short are left out
+func FindShortZones(nodes []v1.Node, zones []string, expectedPerZone int, offsets map[string]int) map[string]int {
+	ready := CountReadyNodesByZone(nodes)
+
+	short := map[string]int{}
+	for _, zone := range zones {
+		if missing := expectedPerZone + offsets[zone] - ready[zone]; missing > 0 {
+			short[zone] = missing
+		}
+	}
+
+	return short
+}
+
+// pickFailoverZone returns the first of the given zones that is neither short nor unreliable, empty if there is none
+func pickFailoverZone(zones []string, short map[string]int, unreliable map[string]time.Time) string {
+	for _, zone := range zones {
+		if _, isShort := short[zone]; isShort {
+			continue
+		}
+		if _, isUnreliable := unreliable[zone]; isUnreliable {
+			continue
+		}
+		return zone
+	}
+
+	return ""
+}
+
+// UnreliableZones returns the zones of the node pool shifted to that last failed to provision nodes in time
+func (s *Shifter) UnreliableZones() (zones []string) {
+	for zone := range s.unreliableZones {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+
+	return
+}
+
+// verifyProvisioning waits until the pool shifted to has the added nodes; when a zone doesn't provision them Ready
+// within the provisioning timeout, the zone is recorded as unreliable and its missing capacity is requested in another
+// zone of the pool instead, before giving up
+func (s *Shifter) verifyProvisioning(sh *shift) error {
+	k, toName := s.kubernetes, s.options.NodePoolTo
+	expected := sh.toCurrentSize + sh.count
+
+	if s.options.ProvisioningTimeout <= 0 {
+		return verifyNodeCount(sh.ctx, s.clock, s.jitter, k, toName, sh.toLocations, int64(expected))
+	}
+
+	ctx, cancel := context.WithTimeout(sh.ctx, time.Duration(s.options.ProvisioningTimeout)*time.Second)
+	defer cancel()
+
+	err := verifyNodeCount(ctx, s.clock, s.jitter, k, toName, sh.toLocations, int64(expected))
+
+	nodes, listErr := k.GetNodeList(toName)
+	if listErr != nil {
+		return err
+	}
+
+	zones := FilterZones(sh.toLocations, s.options.ZonesInclude, s.options.ZonesExclude)
+	short := FindShortZones(nodes.Items, zones, expected, s.zoneOffsets)
+
+	// a zone that provisioned in time is reliable again, once all zones provisioned and none is left unreliable the
+	// node pool is spread evenly again
+	for _, zone := range zones {
+		if _, isShort := short[zone]; !isShort {
+			delete(s.unreliableZones, zone)
+		}
+	}
+
+	if len(short) == 0 && len(s.unreliableZones) == 0 {
+		s.zoneOffsets = map[string]int{}
+		sh.record.ZoneOffsets = nil
+	}
+
+	if err == nil || sh.ctx.Err() != nil {
+		return err
+	}
+
+	zoneSizes := map[string]int{}
+	for _, zone := range zones {
+		zoneSizes[zone] = expected + s.zoneOffsets[zone]
+	}
+
+	for _, zone := range zones {
+		missing, isShort := short[zone]
+		if !isShort {
+			continue
+		}
+
+		s.unreliableZones[zone] = s.clock.Now()
+
+		failover := pickFailoverZone(zones, short, s.unreliableZones)
+		if failover == "" {
+			return fmt.Errorf("zone %v didn't provision %d node(s) within %ds and no other zone is left to fail over to", zone, missing, s.options.ProvisioningTimeout)
+		}
+
+		sh.logger.Warn().
+			Str("node-pool", toName).
+			Str("zone", zone).
+			Str("failover-zone", failover).
+			Msgf("Zone didn't provision %d node(s) in time, requesting them in another zone", missing)
+
+		// withdraw the request in the unreliable zone so it doesn't provision late on top of the failover
+		zoneSizes[zone] -= missing
+		zoneSizes[failover] += missing
+
+		s.zoneOffsets[zone] -= missing
+		s.zoneOffsets[failover] += missing
+		sh.record.ZoneOffsets = s.copyZoneOffsets()
+
+		if err = s.to.SetNodePoolZoneSize(sh.ctx, toName, zone, int64(zoneSizes[zone])); err != nil {
+			return fmt.Errorf("Error withdrawing the capacity requested in zone %v: %v", zone, err)
+		}
+
+		if err = s.to.SetNodePoolZoneSize(sh.ctx, toName, failover, int64(zoneSizes[failover])); err != nil {
+			return fmt.Errorf("Error requesting capacity in zone %v: %v", failover, err)
+		}
+	}
+
+	// the capacity moved zones, so the total is what counts now
+	return verifyNodeCount(sh.ctx, s.clock, s.jitter, k, toName, sh.toLocations, int64(expected))
+}
+
+// copyZoneOffsets returns a copy of the capacity moved by failovers to record with a shift, nil when none was moved
+func (s *Shifter) copyZoneOffsets() map[string]int {
+	if len(s.zoneOffsets) == 0 {
+		return nil
+	}
+
+	offsets := map[string]int{}
+	for zone, offset := range s.zoneOffsets {
+		offsets[zone] = offset
+	}
+
+	return offsets
+}
+
+// withoutOffsets returns the zones of the node pool shifted to as if failovers hadn't moved capacity between them
+func (s *Shifter) withoutOffsets(zonesTo ZoneStats) ZoneStats {
+	zones := ZoneStats{}
+	for zone, stat := range zonesTo {
+		stat.Total -= s.zoneOffsets[zone]
+		stat.Ready -= s.zoneOffsets[zone]
+		zones[zone] = stat
+	}
+
+	return zones
+}
+
+// loadZoneOffsets restores the capacity moved by failovers from the last shift persisted in the state ConfigMap, a
+// shift of other node pools is ignored
+func (s *Shifter) loadZoneOffsets() error {
+	record, err := loadShiftRecord(s.kubernetes, s.options.StateConfigMap)
+	if err != nil || record == nil {
+		return err
+	}
+
+	if record.NodePoolFrom != s.options.NodePoolFrom || record.NodePoolTo != s.options.NodePoolTo {
+		return nil
+	}
+
+	for zone, offset := range record.ZoneOffsets {
+		s.zoneOffsets[zone] = offset
+	}
+
+	return nil
+}
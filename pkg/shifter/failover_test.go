@@ -0,0 +1,199 @@
+package shifter
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFindShortZones(t *testing.T) {
+	ready := v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}}
+	notReady := v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}}
+	node := func(zone string, status v1.NodeStatus) v1.Node {
+		return v1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"failure-domain.beta.kubernetes.io/zone": zone}}, Status: status}
+	}
+
+	nodes := []v1.Node{
+		node("europe-west1-b", ready),
+		node("europe-west1-b", ready),
+		node("europe-west1-c", ready),
+		node("europe-west1-c", notReady),
+	}
+
+	output := FindShortZones(nodes, []string{"europe-west1-b", "europe-west1-c", "europe-west1-d"}, 2, nil)
+	if !reflect.DeepEqual(output, map[string]int{"europe-west1-c": 1, "europe-west1-d": 2}) {
+		t.Errorf("FindShortZones, expected map[europe-west1-c:1 europe-west1-d:2] got %v", output)
+	}
+
+	// capacity moved from zone c to zone b by a failover
+	offsets := map[string]int{"europe-west1-b": 1, "europe-west1-c": -1}
+	output = FindShortZones(nodes, []string{"europe-west1-b", "europe-west1-c"}, 2, offsets)
+	if !reflect.DeepEqual(output, map[string]int{"europe-west1-b": 1}) {
+		t.Errorf("FindShortZones with offsets, expected map[europe-west1-b:1] got %v", output)
+	}
+}
+
+func TestPickFailoverZone(t *testing.T) {
+	zones := []string{"europe-west1-b", "europe-west1-c", "europe-west1-d"}
+	short := map[string]int{"europe-west1-b": 1}
+	unreliable := map[string]time.Time{"europe-west1-c": time.Now()}
+
+	if output := pickFailoverZone(zones, short, unreliable); output != "europe-west1-d" {
+		t.Errorf("pickFailoverZone, expected europe-west1-d got %v", output)
+	}
+
+	unreliable["europe-west1-d"] = time.Now()
+	if output := pickFailoverZone(zones, short, unreliable); output != "" {
+		t.Errorf("pickFailoverZone, expected no zone got %v", output)
+	}
+}
+
+// tickingClock waits a millisecond for any duration, for waits bounded by a real deadline
+type tickingClock struct{}
+
+func (tickingClock) Now() time.Time {
+	return time.Now()
+}
+
+func (tickingClock) After(time.Duration) <-chan time.Time {
+	return time.After(time.Millisecond)
+}
+
+func TestVerifyProvisioning(t *testing.T) {
+	tests := []struct {
+		name       string
+		timeout    int
+		stockout   []string
+		fails      bool
+		resizes    []string
+		unreliable []string
+	}{
+		{"provisioned", 0, nil, false, nil, nil},
+		{"failed over", 1, []string{"europe-west1-b"}, false, []string{"SetNodePoolZoneSize pool-b europe-west1-b 1", "SetNodePoolZoneSize pool-b europe-west1-c 3"}, []string{"europe-west1-b"}},
+		{"no zone left", 1, []string{"europe-west1-b", "europe-west1-c"}, true, nil, []string{"europe-west1-b"}},
+	}
+
+	for _, test := range tests {
+		k, g, _ := newShiftFakes()
+		for _, zone := range test.stockout {
+			g.stockout[zone] = true
+		}
+
+		s := newFakeShifter(Options{ProvisioningTimeout: test.timeout}, k, g)
+		s.clock = tickingClock{}
+
+		if err := g.SetNodePoolSize(context.Background(), "pool-b", 2); err != nil {
+			t.Fatalf("%v: scaling up, expected no error got %v", test.name, err)
+		}
+		g.calls = nil
+
+		err := s.verifyProvisioning(&shift{
+			ctx:           context.Background(),
+			toLocations:   g.locations["pool-b"],
+			toCurrentSize: 1,
+			count:         1,
+			logger:        log.Logger,
+		})
+
+		if test.fails != (err != nil) {
+			t.Errorf("%v: expected failure %v got %v", test.name, test.fails, err)
+		}
+
+		resizes := []string{}
+		for _, call := range g.calls {
+			if strings.HasPrefix(call, "SetNodePoolZoneSize") {
+				resizes = append(resizes, call)
+			}
+		}
+		if len(resizes) != len(test.resizes) || len(resizes) > 0 && !reflect.DeepEqual(resizes, test.resizes) {
+			t.Errorf("%v: expected resizes %v got %v", test.name, test.resizes, resizes)
+		}
+
+		if unreliable := s.UnreliableZones(); len(unreliable) != len(test.unreliable) || len(unreliable) > 0 && !reflect.DeepEqual(unreliable, test.unreliable) {
+			t.Errorf("%v: expected unreliable zones %v got %v", test.name, test.unreliable, unreliable)
+		}
+	}
+}
+
+func TestShiftsAfterFailover(t *testing.T) {
+	// pool-a has four nodes running a pod each and pool-b a single node in both zones, zone b is out of capacity
+	k := newFakeKubernetes(
+		fakeNode("b-b-1", "pool-b", "europe-west1-b"),
+		fakeNode("b-c-1", "pool-b", "europe-west1-c"),
+	)
+	for _, zone := range []string{"b", "c"} {
+		for i := 1; i <= 4; i++ {
+			node := fmt.Sprintf("a-%v-%d", zone, i)
+			k.nodes = append(k.nodes, fakeNode(node, "pool-a", "europe-west1-"+zone))
+			k.pods[node] = []v1.Pod{fakePod("shop", "web-"+node, node, true)}
+		}
+	}
+
+	g := newFakeContainer(k, map[string][]string{
+		"pool-a": {"europe-west1-b", "europe-west1-c"},
+		"pool-b": {"europe-west1-b", "europe-west1-c"},
+	})
+	g.stockout["europe-west1-b"] = true
+
+	options := Options{NodePoolFromMinNode: 1, ProvisioningTimeout: 1, StateConfigMap: "state"}
+
+	tests := []struct {
+		name     string
+		restored bool
+		resizes  []string
+		offsets  map[string]int
+	}{
+		{
+			name:    "failover",
+			resizes: []string{"SetNodePoolSize pool-b 2", "SetNodePoolZoneSize pool-b europe-west1-b 1", "SetNodePoolZoneSize pool-b europe-west1-c 3"},
+			offsets: map[string]int{"europe-west1-b": -1, "europe-west1-c": 1},
+		},
+		{
+			name:    "zone still out of capacity",
+			resizes: []string{"SetNodePoolZoneSize pool-b europe-west1-b 2", "SetNodePoolZoneSize pool-b europe-west1-c 4", "SetNodePoolZoneSize pool-b europe-west1-b 1", "SetNodePoolZoneSize pool-b europe-west1-c 5"},
+			offsets: map[string]int{"europe-west1-b": -2, "europe-west1-c": 2},
+		},
+		{
+			name:     "zone provisions again",
+			restored: true,
+			resizes:  []string{"SetNodePoolZoneSize pool-b europe-west1-b 2", "SetNodePoolZoneSize pool-b europe-west1-c 6"},
+		},
+	}
+
+	for _, test := range tests {
+		if test.restored {
+			delete(g.stockout, "europe-west1-b")
+		}
+		g.calls = nil
+
+		// each shift runs in a new shifter, as after a restart
+		s := newFakeShifter(options, k, g)
+		s.clock = tickingClock{}
+
+		if status, _, state := s.RunCycle(); status != "shifted" {
+			t.Fatalf("%v: expected the shift to succeed got %v: %v", test.name, status, state.Decision)
+		}
+
+		resizes := []string{}
+		for _, call := range g.calls {
+			if strings.HasPrefix(call, "SetNodePool") {
+				resizes = append(resizes, call)
+			}
+		}
+		if !reflect.DeepEqual(resizes, test.resizes) {
+			t.Errorf("%v: expected resizes %v got %v", test.name, test.resizes, resizes)
+		}
+
+		record, _ := loadShiftRecord(k, "state")
+		if record == nil || !reflect.DeepEqual(record.ZoneOffsets, test.offsets) {
+			t.Errorf("%v: expected the zone offsets %v persisted got %v", test.name, test.offsets, record)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package shifter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeKubernetes is an in-memory cluster whose nodes belong to a node pool and a zone through their GKE labels; every
+// call is recorded, and fails with the error set for it in errs if any
+type fakeKubernetes struct {
+	nodes      []v1.Node
+	pods       map[string][]v1.Pod
+	configMaps map[string]*v1.ConfigMap
+	errs       map[string]error
+	calls      []string
+}
+
+func newFakeKubernetes(nodes ...v1.Node) *fakeKubernetes {
+	return &fakeKubernetes{
+		nodes:      nodes,
+		pods:       map[string][]v1.Pod{},
+		configMaps: map[string]*v1.ConfigMap{},
+		errs:       map[string]error{},
+	}
+}
+
+// fakeNode returns a Ready node of a node pool in a zone, whose instance has the same name
+func fakeNode(name, pool, zone string) v1.Node {
+	return v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				"cloud.google.com/gke-nodepool":          pool,
+				"failure-domain.beta.kubernetes.io/zone": zone,
+			},
+		},
+		Spec: v1.NodeSpec{ProviderID: "gce://my-project/" + zone + "/" + name},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+		},
+	}
+}
+
+// fakePod returns a running pod on a node, owned by a ReplicaSet when controlled and bare otherwise
+func fakePod(namespace, name, node string, controlled bool) v1.Pod {
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       v1.PodSpec{NodeName: node},
+		Status:     v1.PodStatus{Phase: v1.PodRunning},
+	}
+
+	if controlled {
+		isController := true
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: name + "-rs", Controller: &isController}}
+	}
+
+	return pod
+}
+
+func (k *fakeKubernetes) call(format string, args ...interface{}) error {
+	call := fmt.Sprintf(format, args...)
+	k.calls = append(k.calls, call)
+	return k.errs[call]
+}
+
+func (k *fakeKubernetes) node(name string) *v1.Node {
+	for i := range k.nodes {
+		if k.nodes[i].Name == name {
+			return &k.nodes[i]
+		}
+	}
+	return nil
+}
+
+// unschedulable returns the names of the cordoned nodes
+func (k *fakeKubernetes) unschedulable() (names []string) {
+	for _, node := range k.nodes {
+		if node.Spec.Unschedulable {
+			names = append(names, node.Name)
+		}
+	}
+	return
+}
+
+func (k *fakeKubernetes) GetNodeList(name string) (*v1.NodeList, error) {
+	if err := k.call("GetNodeList %v", name); err != nil {
+		return nil, err
+	}
+
+	nodes := &v1.NodeList{}
+	for _, node := range k.nodes {
+		if name == "" || node.Labels["cloud.google.com/gke-nodepool"] == name {
+			nodes.Items = append(nodes.Items, *node.DeepCopy())
+		}
+	}
+	return nodes, nil
+}
+
+func (k *fakeKubernetes) GetZones(name string, locations []string, filter NodeFilter) (ZoneStats, error) {
+	if err := k.call("GetZones %v", name); err != nil {
+		return nil, err
+	}
+
+	zones := ZoneStats{}
+	for _, zone := range locations {
+		nodes := []v1.Node{}
+		for _, node := range k.nodes {
+			if node.Labels["cloud.google.com/gke-nodepool"] == name && node.Labels["failure-domain.beta.kubernetes.io/zone"] == zone && !IsRetired(node) {
+				nodes = append(nodes, node)
+			}
+		}
+		zones.AddNodes(zone, filter.Filter(nodes))
+	}
+	return zones, nil
+}
+
+func (k *fakeKubernetes) GetAutoscalerStatus() (string, error) {
+	return "", k.call("GetAutoscalerStatus")
+}
+
+func (k *fakeKubernetes) GetConfigMap(name string) (*v1.ConfigMap, error) {
+	if err := k.call("GetConfigMap %v", name); err != nil {
+		return nil, err
+	}
+	return k.configMaps[name], nil
+}
+
+func (k *fakeKubernetes) UpsertConfigMap(configMap *v1.ConfigMap) error {
+	if err := k.call("UpsertConfigMap %v", configMap.Name); err != nil {
+		return err
+	}
+	k.configMaps[configMap.Name] = configMap
+	return nil
+}
+
+func (k *fakeKubernetes) GetPodsOnNode(name string) (*v1.PodList, error) {
+	if err := k.call("GetPodsOnNode %v", name); err != nil {
+		return nil, err
+	}
+	return &v1.PodList{Items: k.pods[name]}, nil
+}
+
+func (k *fakeKubernetes) GetPods(namespace, selector string) (*v1.PodList, error) {
+	return &v1.PodList{}, k.call("GetPods %v %v", namespace, selector)
+}
+
+func (k *fakeKubernetes) GetHorizontalPodAutoscalers(namespace string) (*autoscalingv1.HorizontalPodAutoscalerList, error) {
+	return &autoscalingv1.HorizontalPodAutoscalerList{}, k.call("GetHorizontalPodAutoscalers %v", namespace)
+}
+
+func (k *fakeKubernetes) SetNodeUnschedulable(name string, unschedulable bool) error {
+	if err := k.call("SetNodeUnschedulable %v %v", name, unschedulable); err != nil {
+		return err
+	}
+	if node := k.node(name); node != nil {
+		node.Spec.Unschedulable = unschedulable
+	}
+	return nil
+}
+
+func (k *fakeKubernetes) SetNodeLabels(name string, labels map[string]string) error {
+	if err := k.call("SetNodeLabels %v", name); err != nil {
+		return err
+	}
+	if node := k.node(name); node != nil {
+		for key, value := range labels {
+			node.Labels[key] = value
+		}
+	}
+	return nil
+}
+
+func (k *fakeKubernetes) SetNodeAnnotations(name string, annotations map[string]string) error {
+	if err := k.call("SetNodeAnnotations %v", name); err != nil {
+		return err
+	}
+	if node := k.node(name); node != nil {
+		if node.Annotations == nil {
+			node.Annotations = map[string]string{}
+		}
+		for key, value := range annotations {
+			if value == "" {
+				delete(node.Annotations, key)
+				continue
+			}
+			node.Annotations[key] = value
+		}
+	}
+	return nil
+}
+
+// EvictPod removes the pod from its node right away
+func (k *fakeKubernetes) EvictPod(pod v1.Pod) error {
+	if err := k.call("EvictPod %v/%v", pod.Namespace, pod.Name); err != nil {
+		return err
+	}
+
+	pods := []v1.Pod{}
+	for _, p := range k.pods[pod.Spec.NodeName] {
+		if p.Namespace != pod.Namespace || p.Name != pod.Name {
+			pods = append(pods, p)
+		}
+	}
+	k.pods[pod.Spec.NodeName] = pods
+	return nil
+}
+
+func (k *fakeKubernetes) GetPersistentVolumes() (*v1.PersistentVolumeList, error) {
+	return &v1.PersistentVolumeList{}, k.call("GetPersistentVolumes")
+}
+
+func (k *fakeKubernetes) CreatePod(pod *v1.Pod) (*v1.Pod, error) {
+	return pod, k.call("CreatePod %v", pod.Name)
+}
+
+func (k *fakeKubernetes) GetPod(name string) (*v1.Pod, error) {
+	if err := k.call("GetPod %v", name); err != nil {
+		return nil, err
+	}
+	for _, pods := range k.pods {
+		for _, pod := range pods {
+			if pod.Name == name {
+				return &pod, nil
+			}
+		}
+	}
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}}, nil
+}
+
+func (k *fakeKubernetes) DeletePod(name string) error {
+	return k.call("DeletePod %v", name)
+}
+
+// fakeContainer manages the node pools of a fakeKubernetes: resizes add or remove nodes in each zone of the node pool,
+// except that zones out of stock never add any, and deleted instances remove the nodes of the same name; pending holds
+// the operation pending on a node pool by name. Calls are recorded and fail like those of fakeKubernetes
+type fakeContainer struct {
+	kubernetes *fakeKubernetes
+	locations  map[string][]string
+	stockout   map[string]bool
+	pending    map[string]string
+	errs       map[string]error
+	calls      []string
+}
+
+func newFakeContainer(k *fakeKubernetes, locations map[string][]string) *fakeContainer {
+	return &fakeContainer{
+		kubernetes: k,
+		locations:  locations,
+		stockout:   map[string]bool{},
+		pending:    map[string]string{},
+		errs:       map[string]error{},
+	}
+}
+
+func (g *fakeContainer) call(format string, args ...interface{}) error {
+	call := fmt.Sprintf(format, args...)
+	g.calls = append(g.calls, call)
+	return g.errs[call]
+}
+
+func (g *fakeContainer) resizeZone(name, zone string, size int) {
+	nodes, count := []v1.Node{}, 0
+	for _, node := range g.kubernetes.nodes {
+		if node.Labels["cloud.google.com/gke-nodepool"] == name && node.Labels["failure-domain.beta.kubernetes.io/zone"] == zone {
+			if count == size {
+				continue
+			}
+			count++
+		}
+		nodes = append(nodes, node)
+	}
+
+	for i := 0; count < size && !g.stockout[zone]; i++ {
+		node := fmt.Sprintf("%v-%v-added-%d", name, zone, i)
+		if g.kubernetes.node(node) == nil {
+			nodes = append(nodes, fakeNode(node, name, zone))
+			count++
+		}
+	}
+
+	g.kubernetes.nodes = nodes
+}
+
+func (g *fakeContainer) GetNodePoolLocations(name string) ([]string, error) {
+	return g.locations[name], g.call("GetNodePoolLocations %v", name)
+}
+
+func (g *fakeContainer) GetNodePoolInstanceGroupURLs(name string) ([]string, error) {
+	return nil, g.call("GetNodePoolInstanceGroupURLs %v", name)
+}
+
+func (g *fakeContainer) GetPendingResizeOperation(name string) (string, error) {
+	return g.pending[name], g.call("GetPendingResizeOperation %v", name)
+}
+
+func (g *fakeContainer) GetMaintenanceExclusions() ([]MaintenanceExclusion, error) {
+	return nil, g.call("GetMaintenanceExclusions")
+}
+
+func (g *fakeContainer) GetNodePoolTargetSizes(name string) (map[string]int, error) {
+	if err := g.call("GetNodePoolTargetSizes %v", name); err != nil {
+		return nil, err
+	}
+
+	sizes := map[string]int{}
+	for _, zone := range g.locations[name] {
+		sizes[zone] = 0
+	}
+	for _, node := range g.kubernetes.nodes {
+		if node.Labels["cloud.google.com/gke-nodepool"] == name {
+			sizes[node.Labels["failure-domain.beta.kubernetes.io/zone"]]++
+		}
+	}
+	return sizes, nil
+}
+
+func (g *fakeContainer) SetNodePoolSize(ctx context.Context, name string, size int64) error {
+	if err := g.call("SetNodePoolSize %v %d", name, size); err != nil {
+		return err
+	}
+	for _, zone := range g.locations[name] {
+		g.resizeZone(name, zone, int(size))
+	}
+	return nil
+}
+
+func (g *fakeContainer) SetNodePoolZoneSize(ctx context.Context, name, zone string, size int64) error {
+	if err := g.call("SetNodePoolZoneSize %v %v %d", name, zone, size); err != nil {
+		return err
+	}
+	g.resizeZone(name, zone, int(size))
+	return nil
+}
+
+func (g *fakeContainer) DeleteNodePoolInstances(ctx context.Context, name, zone string, instances []string) error {
+	if err := g.call("DeleteNodePoolInstances %v %v %v", name, zone, instances); err != nil {
+		return err
+	}
+
+	deleted := map[string]bool{}
+	for _, instance := range instances {
+		deleted[instance] = true
+	}
+
+	nodes := []v1.Node{}
+	for _, node := range g.kubernetes.nodes {
+		if !deleted[node.Name] {
+			nodes = append(nodes, node)
+		}
+	}
+	g.kubernetes.nodes = nodes
+	return nil
+}
+
+func (g *fakeContainer) DeleteNodePool(ctx context.Context, name string) error {
+	return g.call("DeleteNodePool %v", name)
+}
+
+// fakeCloud reports a fixed number of preemptions
+type fakeCloud struct {
+	preemptions int
+}
+
+func (c fakeCloud) CountPreemptions(string, []string, time.Time) (int, error) {
+	return c.preemptions, nil
+}
+
+// fakeShiftHook fails with err when set, recording the hooks it ran
+type fakeShiftHook struct {
+	err   error
+	hooks []string
+}
+
+func (h *fakeShiftHook) Run(ctx context.Context, request ShiftHookRequest) error {
+	h.hooks = append(h.hooks, request.Hook)
+	return h.err
+}
+
+// newFakeShifter returns a shifter of pool-a to pool-b on the given fakes, both node pools managed by g, where time
+// passes instantly
+func newFakeShifter(options Options, k *fakeKubernetes, g *fakeContainer) *Shifter {
+	options.NodePoolFrom = "pool-a"
+	options.NodePoolTo = "pool-b"
+	options.Clock = &fakeClock{now: time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)}
+	options.Jitter = fixedJitter{}
+
+	if options.ShiftDeadline == 0 {
+		options.ShiftDeadline = 600
+	}
+
+	return New(options, fakeCloud{}, g, g, k)
+}
+
+// contains returns true if the calls include the given call
+func contains(calls []string, call string) bool {
+	for _, c := range calls {
+		if c == call {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package shifter
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// nodeSelectorOperators maps the operators of node affinity requirements to the ones of label selectors
+var nodeSelectorOperators = map[v1.NodeSelectorOperator]selection.Operator{
+	v1.NodeSelectorOpIn:           selection.In,
+	v1.NodeSelectorOpNotIn:        selection.NotIn,
+	v1.NodeSelectorOpExists:       selection.Exists,
+	v1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+	v1.NodeSelectorOpGt:           selection.GreaterThan,
+	v1.NodeSelectorOpLt:           selection.LessThan,
+}
+
+// NodeProfile holds the labels and taints pods are matched against when checking whether they can move to a node pool
+type NodeProfile struct {
+	Labels map[string]string
+	Taints []v1.Taint
+}
+
+// ParseTaint parses a taint in the kubectl format key=value:Effect, the value is optional
+func ParseTaint(input string) (taint v1.Taint, err error) {
+	keyValueEffect := strings.SplitN(input, ":", 2)
+
+	if len(keyValueEffect) != 2 || keyValueEffect[0] == "" {
+		return taint, fmt.Errorf("Invalid taint %q, expected key=value:Effect", input)
+	}
+
+	keyValue := strings.SplitN(keyValueEffect[0], "=", 2)
+	taint.Key = keyValue[0]
+	if len(keyValue) == 2 {
+		taint.Value = keyValue[1]
+	}
+
+	switch v1.TaintEffect(keyValueEffect[1]) {
+	case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+		taint.Effect = v1.TaintEffect(keyValueEffect[1])
+	default:
+		return taint, fmt.Errorf("Invalid effect %q of taint %q", keyValueEffect[1], input)
+	}
+
+	return
+}
+
+// FindProfileMismatches returns the expected labels and taints a node doesn't carry
+func FindProfileMismatches(node v1.Node, expected NodeProfile) (mismatches []string) {
+	for key, value := range expected.Labels {
+		if node.Labels[key] != value {
+			mismatches = append(mismatches, fmt.Sprintf("label %v=%v", key, value))
+		}
+	}
+
+	for _, taint := range expected.Taints {
+		found := false
+		for _, nodeTaint := range node.Spec.Taints {
+			if nodeTaint.MatchTaint(&taint) && nodeTaint.Value == taint.Value {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			mismatches = append(mismatches, fmt.Sprintf("taint %v=%v:%v", taint.Key, taint.Value, taint.Effect))
+		}
+	}
+
+	return
+}
+
+// PodFitsProfile returns true if the node selector and required node affinity of a pod match the labels of the profile
+// and the pod tolerates all its taints that prevent scheduling
+func PodFitsProfile(pod v1.Pod, profile NodeProfile) bool {
+	for key, value := range pod.Spec.NodeSelector {
+		if profile.Labels[key] != value {
+			return false
+		}
+	}
+
+	if affinity := pod.Spec.Affinity; affinity != nil && affinity.NodeAffinity != nil && affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		if !matchesNodeSelectorTerms(affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms, profile.Labels) {
+			return false
+		}
+	}
+
+	for _, taint := range profile.Taints {
+		if taint.Effect == v1.TaintEffectPreferNoSchedule {
+			continue
+		}
+
+		tolerated := false
+		for _, toleration := range pod.Spec.Tolerations {
+			if toleration.ToleratesTaint(&taint) {
+				tolerated = true
+				break
+			}
+		}
+
+		if !tolerated {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesNodeSelectorTerms returns true if the labels match any of the terms, a term matches when all its label
+// expressions do; field expressions can't be checked against labels and are ignored
+func matchesNodeSelectorTerms(terms []v1.NodeSelectorTerm, nodeLabels map[string]string) bool {
+	for _, term := range terms {
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+
+		selector := labels.NewSelector()
+		valid := true
+
+		for _, expression := range term.MatchExpressions {
+			requirement, err := labels.NewRequirement(expression.Key, nodeSelectorOperators[expression.Operator], expression.Values)
+			if err != nil {
+				valid = false
+				break
+			}
+			selector = selector.Add(*requirement)
+		}
+
+		if valid && selector.Matches(labels.Set(nodeLabels)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allPodsFitProfile returns true if all the pods to evict from a node fit the given profile
+func allPodsFitProfile(pods []v1.Pod, profile NodeProfile) bool {
+	for _, pod := range pods {
+		if needsEviction(pod) && !PodFitsProfile(pod, profile) {
+			return false
+		}
+	}
+
+	return true
+}
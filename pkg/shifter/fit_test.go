@@ -0,0 +1,74 @@
+package shifter
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseTaint(t *testing.T) {
+	taint, err := ParseTaint("cloud.google.com/gke-preemptible=true:NoSchedule")
+	if err != nil || taint.Key != "cloud.google.com/gke-preemptible" || taint.Value != "true" || taint.Effect != v1.TaintEffectNoSchedule {
+		t.Errorf("ParseTaint, expected cloud.google.com/gke-preemptible=true:NoSchedule got %v (%v)", taint, err)
+	}
+
+	if _, err := ParseTaint("dedicated=spot"); err == nil {
+		t.Errorf("ParseTaint without effect, expected an error")
+	}
+}
+
+// requireNodes returns a required node affinity on the preemptible label of GKE nodes
+func requireNodes(operator v1.NodeSelectorOperator, values ...string) *v1.Affinity {
+	return &v1.Affinity{
+		NodeAffinity: &v1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+				NodeSelectorTerms: []v1.NodeSelectorTerm{{
+					MatchExpressions: []v1.NodeSelectorRequirement{{Key: "cloud.google.com/gke-preemptible", Operator: operator, Values: values}},
+				}},
+			},
+		},
+	}
+}
+
+func TestPodFitsProfile(t *testing.T) {
+	profile := NodeProfile{
+		Labels: map[string]string{"cloud.google.com/gke-preemptible": "true"},
+		Taints: []v1.Taint{{Key: "cloud.google.com/gke-preemptible", Value: "true", Effect: v1.TaintEffectNoSchedule}},
+	}
+
+	tolerating := []v1.Toleration{{Key: "cloud.google.com/gke-preemptible", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule}}
+
+	tests := []struct {
+		name     string
+		spec     v1.PodSpec
+		expected bool
+	}{
+		{"tolerates taint", v1.PodSpec{Tolerations: tolerating}, true},
+		{"doesn't tolerate taint", v1.PodSpec{}, false},
+		{"selects other nodes", v1.PodSpec{Tolerations: tolerating, NodeSelector: map[string]string{"cloud.google.com/gke-nodepool": "default-pool"}}, false},
+		{"requires preemptible nodes", v1.PodSpec{Tolerations: tolerating, Affinity: requireNodes(v1.NodeSelectorOpIn, "true")}, true},
+		{"requires regular nodes", v1.PodSpec{Tolerations: tolerating, Affinity: requireNodes(v1.NodeSelectorOpDoesNotExist)}, false},
+	}
+
+	for _, test := range tests {
+		pod := v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: test.name}, Spec: test.spec}
+
+		if output := PodFitsProfile(pod, profile); output != test.expected {
+			t.Errorf("PodFitsProfile %v, expected %v got %v", test.name, test.expected, output)
+		}
+	}
+}
+
+func TestFindProfileMismatches(t *testing.T) {
+	node := v1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"cloud.google.com/gke-preemptible": "true"}}}
+	expected := NodeProfile{
+		Labels: map[string]string{"cloud.google.com/gke-preemptible": "true"},
+		Taints: []v1.Taint{{Key: "cloud.google.com/gke-preemptible", Value: "true", Effect: v1.TaintEffectNoSchedule}},
+	}
+
+	output := FindProfileMismatches(node, expected)
+	if len(output) != 1 || output[0] != "taint cloud.google.com/gke-preemptible=true:NoSchedule" {
+		t.Errorf("FindProfileMismatches, expected [taint cloud.google.com/gke-preemptible=true:NoSchedule] got %v", output)
+	}
+}
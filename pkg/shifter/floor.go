@@ -0,0 +1,96 @@
+package shifter
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// CapacityFloor is the Ready allocatable capacity of the cluster that removals never take it below, whatever the
+// minimum of the node pools, e.g. while other controllers shrink the cluster at the same time; a zero quantity doesn't
+// apply
+type CapacityFloor struct {
+	CPU    resource.Quantity
+	Memory resource.Quantity
+}
+
+// ParseCapacityFloor returns the floor given as cpu and memory quantities, e.g. 64 and 256Gi, empty ones don't apply
+func ParseCapacityFloor(cpu, memory string) (floor CapacityFloor, err error) {
+	if cpu != "" {
+		floor.CPU, err = resource.ParseQuantity(cpu)
+		if err != nil {
+			return floor, fmt.Errorf("Invalid cpu capacity floor %q:\n%v", cpu, err)
+		}
+	}
+
+	if memory != "" {
+		floor.Memory, err = resource.ParseQuantity(memory)
+		if err != nil {
+			return floor, fmt.Errorf("Invalid memory capacity floor %q:\n%v", memory, err)
+		}
+	}
+
+	return
+}
+
+// IsZero returns true if no floor applies
+func (f CapacityFloor) IsZero() bool {
+	return f.CPU.IsZero() && f.Memory.IsZero()
+}
+
+// readyCapacity returns the allocatable cpu and memory of the nodes able to take pods: Ready, schedulable and not
+// retired, leaving out the given nodes
+func readyCapacity(nodes []v1.Node, excluded map[string]bool) (cpu, memory resource.Quantity) {
+	for _, node := range nodes {
+		if excluded[node.Name] || !isNodeReady(node) || node.Spec.Unschedulable || IsRetired(node) {
+			continue
+		}
+
+		cpu.Add(*node.Status.Allocatable.Cpu())
+		memory.Add(*node.Status.Allocatable.Memory())
+	}
+
+	return
+}
+
+// breach describes how the given capacity falls below the floor, empty if it doesn't
+func (f CapacityFloor) breach(cpu, memory resource.Quantity) string {
+	switch {
+	case !f.CPU.IsZero() && cpu.Cmp(f.CPU) < 0:
+		return fmt.Sprintf("cpu %v below floor %v", cpu.String(), f.CPU.String())
+	case !f.Memory.IsZero() && memory.Cmp(f.Memory) < 0:
+		return fmt.Sprintf("memory %v below floor %v", memory.String(), f.Memory.String())
+	}
+
+	return ""
+}
+
+// checkCapacityFloor returns an error if the Ready allocatable capacity of the cluster, without the given victims,
+// falls below the capacity floor
+func (s *Shifter) checkCapacityFloor(victims []Victim) error {
+	if s.options.CapacityFloor.IsZero() {
+		return nil
+	}
+
+	nodes, err := s.capacityNodes()
+	if err != nil {
+		return fmt.Errorf("Error listing nodes to check the capacity floor:\n%v", err)
+	}
+
+	excluded := map[string]bool{}
+	for _, v := range victims {
+		excluded[v.Node] = true
+	}
+
+	breach := s.options.CapacityFloor.breach(readyCapacity(nodes, excluded))
+
+	switch {
+	case breach == "":
+		return nil
+	case len(victims) == 0:
+		return fmt.Errorf("Ready capacity of the cluster has %v", breach)
+	}
+
+	return fmt.Errorf("Ready capacity of the cluster without the %d node(s) to remove has %v", len(victims), breach)
+}
@@ -0,0 +1,84 @@
+package shifter
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseCapacityFloor(t *testing.T) {
+	floor, err := ParseCapacityFloor("64", "256Gi")
+	if err != nil || floor.CPU.String() != "64" || floor.Memory.String() != "256Gi" {
+		t.Errorf("ParseCapacityFloor(64, 256Gi), expected 64 256Gi got %v %v %v", floor.CPU.String(), floor.Memory.String(), err)
+	}
+
+	if floor, _ := ParseCapacityFloor("", ""); !floor.IsZero() {
+		t.Errorf("ParseCapacityFloor of empty quantities, expected a zero floor")
+	}
+
+	if _, err := ParseCapacityFloor("lots", ""); err == nil {
+		t.Errorf("ParseCapacityFloor(lots), expected an error")
+	}
+}
+
+func TestReadyCapacity(t *testing.T) {
+	node := func(name string, ready, unschedulable bool, labels map[string]string) v1.Node {
+		status := v1.ConditionFalse
+		if ready {
+			status = v1.ConditionTrue
+		}
+
+		return v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+			Spec:       v1.NodeSpec{Unschedulable: unschedulable},
+			Status: v1.NodeStatus{
+				Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: status}},
+				Allocatable: v1.ResourceList{
+					v1.ResourceCPU:    resource.MustParse("4"),
+					v1.ResourceMemory: resource.MustParse("16Gi"),
+				},
+			},
+		}
+	}
+
+	nodes := []v1.Node{
+		node("node-1", true, false, nil),
+		node("node-2", true, false, nil),
+		node("node-3", false, false, nil),
+		node("node-4", true, true, nil),
+		node("node-5", true, true, map[string]string{RetiredLabel: "1600000000"}),
+		node("node-6", true, false, nil),
+	}
+
+	cpu, memory := readyCapacity(nodes, map[string]bool{"node-6": true})
+	if cpu.String() != "8" || memory.String() != "32Gi" {
+		t.Errorf("readyCapacity, expected 8 32Gi got %v %v", cpu.String(), memory.String())
+	}
+}
+
+func TestCapacityFloorBreach(t *testing.T) {
+	floor, _ := ParseCapacityFloor("8", "32Gi")
+
+	tests := []struct {
+		cpu      string
+		memory   string
+		expected string
+	}{
+		{"8", "32Gi", ""},
+		{"12", "64Gi", ""},
+		{"7500m", "64Gi", "cpu 7500m below floor 8"},
+		{"12", "16Gi", "memory 16Gi below floor 32Gi"},
+	}
+
+	for _, test := range tests {
+		if output := floor.breach(resource.MustParse(test.cpu), resource.MustParse(test.memory)); output != test.expected {
+			t.Errorf("breach(%v, %v), expected %q got %q", test.cpu, test.memory, test.expected, output)
+		}
+	}
+
+	if output := (CapacityFloor{}).breach(resource.MustParse("0"), resource.MustParse("0")); output != "" {
+		t.Errorf("breach of a zero floor, expected none got %q", output)
+	}
+}
@@ -0,0 +1,53 @@
+package shifter
+
+import (
+	"math/rand"
+	"time"
+
+	foundation "github.com/estafette/estafette-foundation"
+)
+
+// seed random number
+var R = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// ApplyJitter returns the input deviated randomly by up to DefaultJitterPercent either way, drawn from R
+func ApplyJitter(input int) (output int) {
+	return applyPercentJitter(R, DefaultJitterPercent, input)
+}
+
+// AdaptiveInterval scales an interval between the shortest and the longest one by the distance of a node pool from its
+// minimum size: at or beyond the full distance the shortest interval applies, at the minimum the longest one
+func AdaptiveInterval(shortest, longest, distance, fullDistance int) int {
+	if fullDistance <= 0 || distance >= fullDistance {
+		return shortest
+	}
+	if distance <= 0 {
+		return longest
+	}
+
+	return longest - (longest-shortest)*distance/fullDistance
+}
+
+// FilterZones returns the zones present in include (or all zones if include is empty) that are not present in exclude
+func FilterZones(zones, include, exclude []string) (filtered []string) {
+	for _, zone := range zones {
+		if len(include) > 0 && !foundation.StringArrayContains(include, zone) {
+			continue
+		}
+		if foundation.StringArrayContains(exclude, zone) {
+			continue
+		}
+		filtered = append(filtered, zone)
+	}
+	return
+}
+
+// IntersectZones returns the zones of a that are also present in b, in the order of a
+func IntersectZones(a, b []string) (shared []string) {
+	for _, zone := range a {
+		if foundation.StringArrayContains(b, zone) {
+			shared = append(shared, zone)
+		}
+	}
+	return
+}
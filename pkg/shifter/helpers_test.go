@@ -0,0 +1,67 @@
+package shifter
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestAdaptiveInterval(t *testing.T) {
+	tests := []struct {
+		distance int
+		expected int
+	}{
+		{0, 300},
+		{-1, 300},
+		{1, 252},
+		{3, 156},
+		{5, 60},
+		{8, 60},
+	}
+
+	for _, test := range tests {
+		if output := AdaptiveInterval(60, 300, test.distance, 5); output != test.expected {
+			t.Errorf("AdaptiveInterval(60, 300, %d, 5), expected %d got %d", test.distance, test.expected, output)
+		}
+	}
+}
+
+func TestApplyJitter(t *testing.T) {
+	R = rand.New(rand.NewSource(0))
+
+	var output = ApplyJitter(100)
+	if output != 99 {
+		t.Errorf("ApplyJitter, expected 99 got %d", output)
+	}
+
+	output = ApplyJitter(3)
+	if output != 3 {
+		t.Errorf("ApplyJitter, expected 3 got %d", output)
+	}
+}
+
+func TestFilterZones(t *testing.T) {
+	zones := []string{"europe-west1-b", "europe-west1-c", "europe-west1-d"}
+
+	var output = FilterZones(zones, nil, []string{"europe-west1-c"})
+	if !reflect.DeepEqual(output, []string{"europe-west1-b", "europe-west1-d"}) {
+		t.Errorf("FilterZones, expected [europe-west1-b europe-west1-d] got %v", output)
+	}
+
+	output = FilterZones(zones, []string{"europe-west1-c", "europe-west1-d"}, []string{"europe-west1-d"})
+	if !reflect.DeepEqual(output, []string{"europe-west1-c"}) {
+		t.Errorf("FilterZones, expected [europe-west1-c] got %v", output)
+	}
+}
+
+func TestIntersectZones(t *testing.T) {
+	var output = IntersectZones([]string{"europe-west1-b", "europe-west1-c", "europe-west1-d"}, []string{"europe-west1-d", "europe-west1-b"})
+	if !reflect.DeepEqual(output, []string{"europe-west1-b", "europe-west1-d"}) {
+		t.Errorf("IntersectZones, expected [europe-west1-b europe-west1-d] got %v", output)
+	}
+
+	output = IntersectZones([]string{"europe-west1-b"}, []string{"europe-west1-c"})
+	if len(output) != 0 {
+		t.Errorf("IntersectZones, expected [] got %v", output)
+	}
+}
@@ -0,0 +1,71 @@
+package shifter
+
+import (
+	"context"
+)
+
+// HookFailurePolicy decides what a failing shift hook does to the shift
+type HookFailurePolicy string
+
+const (
+	// HookAbort fails the shift when the hook fails
+	HookAbort HookFailurePolicy = "abort"
+
+	// HookContinue logs the failure of the hook and carries on with the shift
+	HookContinue HookFailurePolicy = "continue"
+)
+
+// ShiftHookRequest is what a shift hook is run with, the hook is pre_shift before the node pool shifted to is scaled
+// up or post_shift after the node pool shifted from is scaled down
+type ShiftHookRequest struct {
+	Hook    string      `json:"hook"`
+	Cluster string      `json:"cluster"`
+	Shift   ShiftRecord `json:"shift"`
+}
+
+// ShiftHook runs before or after a shift, e.g. to warm caches on the new nodes or flush queues before nodes are removed;
+// the context carries the shift deadline
+type ShiftHook interface {
+	Run(context.Context, ShiftHookRequest) error
+}
+
+// runShiftHook runs a hook of the shift if configured, it returns false if the hook failed and the shift has to fail
+// with it
+func (s *Shifter) runShiftHook(sh *shift, name string, hook ShiftHook, policy HookFailurePolicy) bool {
+	if hook == nil {
+		return true
+	}
+
+	sh.logger.Info().
+		Str("hook", name).
+		Msg("Running shift hook")
+
+	err := hook.Run(sh.ctx, ShiftHookRequest{
+		Hook:    name,
+		Cluster: s.options.Cluster,
+		Shift:   sh.record,
+	})
+
+	if err == nil {
+		return true
+	}
+
+	if policy != HookAbort {
+		sh.logger.Warn().
+			Err(err).
+			Str("hook", name).
+			Msg("Shift hook failed, continuing the shift")
+
+		return true
+	}
+
+	sh.err = newShiftError(sh.ctx, name+"_hook_failed", err)
+
+	sh.logger.Error().
+		Err(err).
+		Str("hook", name).
+		Str("reason", sh.err.Reason).
+		Msg("Shift hook failed, aborting the shift")
+
+	return false
+}
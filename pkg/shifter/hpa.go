@@ -0,0 +1,17 @@
+package shifter
+
+import (
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+)
+
+// FindScalingUpHPAs returns the namespace/name of the HorizontalPodAutoscalers that want more replicas than they
+// currently have, i.e. are scaling up during a traffic ramp
+func FindScalingUpHPAs(hpas []autoscalingv1.HorizontalPodAutoscaler) (names []string) {
+	for _, hpa := range hpas {
+		if hpa.Status.DesiredReplicas > hpa.Status.CurrentReplicas {
+			names = append(names, hpa.Namespace+"/"+hpa.Name)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,22 @@
+package shifter
+
+import (
+	"reflect"
+	"testing"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFindScalingUpHPAs(t *testing.T) {
+	hpas := []autoscalingv1.HorizontalPodAutoscaler{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "frontend"}, Status: autoscalingv1.HorizontalPodAutoscalerStatus{CurrentReplicas: 3, DesiredReplicas: 6}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"}, Status: autoscalingv1.HorizontalPodAutoscalerStatus{CurrentReplicas: 4, DesiredReplicas: 4}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "batch", Name: "worker"}, Status: autoscalingv1.HorizontalPodAutoscalerStatus{CurrentReplicas: 5, DesiredReplicas: 2}},
+	}
+
+	output := FindScalingUpHPAs(hpas)
+	if !reflect.DeepEqual(output, []string{"shop/frontend"}) {
+		t.Errorf("FindScalingUpHPAs, expected [shop/frontend] got %v", output)
+	}
+}
@@ -0,0 +1,49 @@
+package shifter
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// DefaultJitterPercent is the deviation either way applied by the default jitter
+const DefaultJitterPercent = 25
+
+// Jitter spreads a number of seconds to wait, so retries of several shifters don't line up
+type Jitter interface {
+	Apply(int) int
+}
+
+// PercentJitter deviates a number of seconds randomly by up to a percentage either way, 0 keeps it unchanged for
+// deterministic scheduling; it's safe for concurrent use
+type PercentJitter struct {
+	Percent int
+
+	mutex  sync.Mutex
+	random *rand.Rand
+}
+
+// NewPercentJitter returns a jitter of up to the given percentage either way, drawing from a source with the given
+// seed so a sequence of deviations can be reproduced
+func NewPercentJitter(percent int, seed int64) *PercentJitter {
+	return &PercentJitter{
+		Percent: percent,
+		random:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Apply returns the input deviated randomly by up to the percentage either way
+func (j *PercentJitter) Apply(input int) int {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return applyPercentJitter(j.random, j.Percent, input)
+}
+
+// applyPercentJitter returns the input deviated by up to the percentage either way, drawn from the given source
+func applyPercentJitter(r *rand.Rand, percent, input int) int {
+	deviation := int(float64(percent) / 100 * float64(input))
+	if deviation <= 0 {
+		return input
+	}
+	return input - deviation + r.Intn(2*deviation)
+}
@@ -0,0 +1,25 @@
+package shifter
+
+import (
+	"testing"
+)
+
+func TestPercentJitter(t *testing.T) {
+	first, second := NewPercentJitter(10, 42), NewPercentJitter(10, 42)
+
+	for i := 0; i < 10; i++ {
+		output := first.Apply(100)
+
+		if output < 90 || output >= 110 {
+			t.Errorf("PercentJitter, expected 100 deviated by up to 10%% got %d", output)
+		}
+
+		if other := second.Apply(100); other != output {
+			t.Errorf("PercentJitter, expected the same seed to deviate the same got %d and %d", output, other)
+		}
+	}
+
+	if output := NewPercentJitter(0, 42).Apply(100); output != 100 {
+		t.Errorf("PercentJitter, expected no deviation at 0%% got %d", output)
+	}
+}
@@ -0,0 +1,77 @@
+package shifter
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// preemptibleKillerStateAnnotation is set by estafette-gke-preemptible-killer on the nodes it is going to delete
+	preemptibleKillerStateAnnotation = "estafette.io/gke-preemptible-killer-state"
+
+	// shiftLeaseAnnotation is set on the nodes of the pool shifted to while a shift relies on them, to the time the
+	// lease expires, so estafette-gke-preemptible-killer can hold off deleting them
+	shiftLeaseAnnotation = "estafette.io/gke-node-pool-shifter-lease"
+)
+
+// preemptibleKillerState is the state estafette-gke-preemptible-killer keeps in a node annotation
+type preemptibleKillerState struct {
+	ExpiryDatetime string `json:"expiry-datetime"`
+}
+
+// FindNodesExpiringSoon returns the names of the nodes estafette-gke-preemptible-killer is going to delete within the
+// given window, based on the state it annotates the nodes with
+func FindNodesExpiringSoon(nodes []v1.Node, now time.Time, window time.Duration) (names []string) {
+	for _, node := range nodes {
+		value, ok := node.Annotations[preemptibleKillerStateAnnotation]
+		if !ok {
+			continue
+		}
+
+		var state preemptibleKillerState
+		if err := json.Unmarshal([]byte(value), &state); err != nil {
+			continue
+		}
+
+		expiry, err := time.Parse(time.RFC3339, state.ExpiryDatetime)
+		if err != nil {
+			continue
+		}
+
+		if expiry.Before(now.Add(window)) {
+			names = append(names, node.Name)
+		}
+	}
+
+	return
+}
+
+// leaseNodes annotates the nodes of a given node pool with a lease expiring at the given time; failing to do so
+// doesn't fail the shift
+func leaseNodes(k KubernetesClient, name string, expiry time.Time) {
+	nodes, err := getNodeNames(k, name)
+
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("node-pool", name).
+			Msg("Error listing nodes, the nodes won't be leased")
+		return
+	}
+
+	lease := map[string]string{
+		shiftLeaseAnnotation: expiry.UTC().Format(time.RFC3339),
+	}
+
+	for node := range nodes {
+		if err := k.SetNodeAnnotations(node, lease); err != nil {
+			log.Warn().
+				Err(err).
+				Str("node", node).
+				Msg("Error leasing node")
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package shifter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFindNodesExpiringSoon(t *testing.T) {
+	now := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+	state := func(expiry string) map[string]string {
+		return map[string]string{preemptibleKillerStateAnnotation: `{"expiry-datetime":"` + expiry + `"}`}
+	}
+
+	nodes := []v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "soon", Annotations: state("2021-09-01T12:05:00Z")}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "overdue", Annotations: state("2021-09-01T11:00:00Z")}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "later", Annotations: state("2021-09-01T18:00:00Z")}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "invalid", Annotations: state("tomorrow")}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "unmanaged"}},
+	}
+
+	output := FindNodesExpiringSoon(nodes, now, 15*time.Minute)
+	if !reflect.DeepEqual(output, []string{"soon", "overdue"}) {
+		t.Errorf("FindNodesExpiringSoon, expected [soon overdue] got %v", output)
+	}
+}
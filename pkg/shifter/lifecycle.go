@@ -0,0 +1,257 @@
+package shifter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ShiftPhase is a phase in the lifecycle of a shift
+type ShiftPhase string
+
+const (
+	PhasePlanned     ShiftPhase = "Planned"
+	PhaseScalingUp   ShiftPhase = "ScalingUp"
+	PhaseVerifyingUp ShiftPhase = "VerifyingUp"
+	PhaseDraining    ShiftPhase = "Draining"
+	PhaseScalingDown ShiftPhase = "ScalingDown"
+	PhaseDone        ShiftPhase = "Done"
+	PhaseFailed      ShiftPhase = "Failed"
+	PhaseRolledBack  ShiftPhase = "RolledBack"
+)
+
+// IsFinal returns true if a shift in this phase is over
+func (p ShiftPhase) IsFinal() bool {
+	return p == PhaseDone || p == PhaseFailed || p == PhaseRolledBack
+}
+
+// ShiftTransition records a shift moving from one phase to the next
+type ShiftTransition struct {
+	From ShiftPhase `json:"from"`
+	To   ShiftPhase `json:"to"`
+	At   time.Time  `json:"at"`
+}
+
+// ShiftRecord is the persisted state of the current or last shift
+type ShiftRecord struct {
+	Phase        ShiftPhase `json:"phase"`
+	NodePoolFrom string     `json:"nodePoolFrom"`
+	NodePoolTo   string     `json:"nodePoolTo"`
+	ToSize       int        `json:"toSize"`
+	ToNewSize    int        `json:"toNewSize"`
+	Victims      []string   `json:"victims"`
+	Operations   []string   `json:"operations,omitempty"`
+
+	// Removed is set once instances of the node pool shifted from are deleted, which cordon only shifts never do
+	Removed bool `json:"removed,omitempty"`
+
+	// Namespaces holds the number of pods evicted by the shift per namespace
+	Namespaces map[string]int `json:"namespaces,omitempty"`
+
+	// ZoneOffsets holds the nodes moved per zone of the node pool shifted to by failovers, see Shifter.zoneOffsets
+	ZoneOffsets map[string]int `json:"zoneOffsets,omitempty"`
+	Reason      string         `json:"reason,omitempty"`
+	StartedAt   time.Time      `json:"startedAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+}
+
+// ShiftEvent is emitted when a shift reaches a milestone of its lifecycle, the event is one of planned, scaled_up,
+// drained, scaled_down or failed; a shift done without removing nodes, i.e. in cordon only mode, emits completed
+// instead of scaled_down
+type ShiftEvent struct {
+	Event   string      `json:"event"`
+	Cluster string      `json:"cluster"`
+	Shift   ShiftRecord `json:"shift"`
+	At      time.Time   `json:"at"`
+}
+
+// EventSink receives the lifecycle events of shifts, e.g. to forward them to external automation
+type EventSink interface {
+	Send(ShiftEvent) error
+}
+
+// shiftEvents maps the phases emitting an event when entered to that event, see shiftEvent for PhaseDone
+var shiftEvents = map[ShiftPhase]string{
+	PhasePlanned:     "planned",
+	PhaseDraining:    "scaled_up",
+	PhaseScalingDown: "drained",
+	PhaseDone:        "scaled_down",
+	PhaseFailed:      "failed",
+	PhaseRolledBack:  "failed",
+}
+
+// shiftEvent returns the event a shift emits on entering its current phase, if any; a shift done without removing
+// nodes didn't scale down the node pool shifted from
+func shiftEvent(record ShiftRecord) (event string, ok bool) {
+	if record.Phase == PhaseDone && !record.Removed {
+		return "completed", true
+	}
+
+	event, ok = shiftEvents[record.Phase]
+	return
+}
+
+// persistState writes a value as json to a key of the state ConfigMap, leaving its other keys untouched
+func persistState(k KubernetesClient, name, key string, value interface{}) (err error) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return
+	}
+
+	configMap, err := k.GetConfigMap(name)
+	if err != nil {
+		return
+	}
+
+	state := map[string]string{}
+	if configMap != nil {
+		for field, content := range configMap.Data {
+			state[field] = content
+		}
+	}
+	state[key] = string(data)
+
+	return k.UpsertConfigMap(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Data: state,
+	})
+}
+
+// loadState reads the value of a key of the state ConfigMap back, returning false if it wasn't persisted yet
+func loadState(k KubernetesClient, name, key string, value interface{}) (found bool, err error) {
+	configMap, err := k.GetConfigMap(name)
+	if err != nil || configMap == nil || configMap.Data[key] == "" {
+		return
+	}
+
+	if err = json.Unmarshal([]byte(configMap.Data[key]), value); err != nil {
+		return false, fmt.Errorf("Error parsing the %v persisted in %v:\n%v", key, name, err)
+	}
+
+	return true, nil
+}
+
+// persistShiftRecord writes the record to the state ConfigMap, so the phase of a shift can be inspected and a shift
+// interrupted by a restart of the shifter recovered
+func persistShiftRecord(k KubernetesClient, name string, record ShiftRecord) error {
+	return persistState(k, name, "shift", record)
+}
+
+// loadShiftRecord reads the record back from the state ConfigMap, nil if no shift was persisted yet
+func loadShiftRecord(k KubernetesClient, name string) (*ShiftRecord, error) {
+	record := &ShiftRecord{}
+
+	found, err := loadState(k, name, "shift", record)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// recoverShift finishes a shift the shifter was interrupted in, e.g. by a restart, as if it had failed: the nodes to
+// remove are uncordoned and the resize of the pool shifted to is rolled back, unless nodes were removed already. A
+// shift of other node pools is left alone
+func (s *Shifter) recoverShift() (transitions []ShiftTransition, err error) {
+	record, err := loadShiftRecord(s.kubernetes, s.options.StateConfigMap)
+	if err != nil || record == nil || record.Phase.IsFinal() {
+		return
+	}
+
+	if record.NodePoolFrom != s.options.NodePoolFrom || record.NodePoolTo != s.options.NodePoolTo {
+		return
+	}
+
+	toLocations, err := s.to.GetNodePoolLocations(s.options.NodePoolTo)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.options.ShiftDeadline)*time.Second)
+	defer cancel()
+
+	sh := &shift{
+		ctx:           ctx,
+		toLocations:   toLocations,
+		toCurrentSize: record.ToSize,
+		removed:       record.Phase == PhaseScalingDown,
+		record:        *record,
+		logger:        log.With().Strs("operations", record.Operations).Logger(),
+	}
+
+	for _, node := range record.Victims {
+		sh.victims = append(sh.victims, Victim{Node: node})
+	}
+
+	sh.logger.Warn().
+		Str("node-pool", s.options.NodePoolTo).
+		Str("phase", string(record.Phase)).
+		Msg("Found a shift interrupted before it finished, aborting it")
+
+	interrupted := fmt.Errorf("shift interrupted in phase %v", record.Phase)
+
+	// nothing was changed before scaling up
+	if record.Phase == PhasePlanned {
+		sh.err = newShiftError(ctx, "interrupted", interrupted)
+		s.transition(sh, PhaseFailed)
+		return sh.transitions, nil
+	}
+
+	s.transition(sh, s.abortRemoval(sh, "interrupted", interrupted, sh.victims))
+
+	return sh.transitions, nil
+}
+
+// transition moves the shift to the next phase, recording, persisting and emitting the transition; failing to persist
+// or emit it doesn't fail the shift
+func (s *Shifter) transition(sh *shift, next ShiftPhase) {
+	now := s.clock.Now()
+
+	sh.transitions = append(sh.transitions, ShiftTransition{
+		From: sh.record.Phase,
+		To:   next,
+		At:   now,
+	})
+
+	sh.logger.Debug().
+		Str("node-pool", s.options.NodePoolTo).
+		Msgf("Shift moves from %v to %v", sh.record.Phase, next)
+
+	sh.record.Phase = next
+	sh.record.UpdatedAt = now
+	if sh.err != nil {
+		sh.record.Reason = sh.err.Reason
+	}
+
+	if s.options.StateConfigMap != "" {
+		if err := persistShiftRecord(s.kubernetes, s.options.StateConfigMap, sh.record); err != nil {
+			sh.logger.Warn().
+				Err(err).
+				Str("configmap", s.options.StateConfigMap).
+				Msg("Error persisting the state of the shift")
+		}
+	}
+
+	if event, ok := shiftEvent(sh.record); ok && s.options.Events != nil {
+		err := s.options.Events.Send(ShiftEvent{
+			Event:   event,
+			Cluster: s.options.Cluster,
+			Shift:   sh.record,
+			At:      now,
+		})
+
+		if err != nil {
+			sh.logger.Warn().
+				Err(err).
+				Str("event", event).
+				Msg("Error sending shift event")
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package shifter
+
+import (
+	"fmt"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// LocalVolumeHandling decides what happens to the nodes of the node pool shifted from whose pods use local volumes, the
+// data of which is lost with the node
+type LocalVolumeHandling string
+
+const (
+	// LocalVolumesSkip never selects those nodes for removal, they're reported as blocked
+	LocalVolumesSkip LocalVolumeHandling = "skip"
+
+	// LocalVolumesForce drains those nodes like any other
+	LocalVolumesForce LocalVolumeHandling = "force"
+
+	// LocalVolumesHook calls the pre-drain hook before draining those nodes, e.g. to snapshot the volumes
+	LocalVolumesHook LocalVolumeHandling = "hook"
+)
+
+// LocalVolume is a local or host path PersistentVolume bound to a pod on a node
+type LocalVolume struct {
+	Pod    string `json:"pod"`
+	Claim  string `json:"claim"`
+	Volume string `json:"volume"`
+	Path   string `json:"path"`
+}
+
+// PreDrainRequest is what the pre-drain hook is called with before a node with local volumes is drained
+type PreDrainRequest struct {
+	Cluster  string        `json:"cluster"`
+	NodePool string        `json:"nodePool"`
+	Node     string        `json:"node"`
+	Volumes  []LocalVolume `json:"volumes"`
+}
+
+// PreDrainHook prepares a node with local volumes for its drain, e.g. by running a snapshot job; the drain only
+// proceeds when it returns no error
+type PreDrainHook interface {
+	BeforeDrain(PreDrainRequest) error
+}
+
+// localVolumePath returns the path of a PersistentVolume on its node, empty if it isn't a local volume, e.g. of the
+// local-path provisioner
+func localVolumePath(pv v1.PersistentVolume) string {
+	switch {
+	case pv.Spec.Local != nil:
+		return pv.Spec.Local.Path
+	case pv.Spec.HostPath != nil:
+		return pv.Spec.HostPath.Path
+	}
+
+	return ""
+}
+
+// localVolumesByClaim returns the local PersistentVolumes by the namespace/name of the claim they're bound to
+func localVolumesByClaim(pvs []v1.PersistentVolume) map[string]v1.PersistentVolume {
+	volumes := map[string]v1.PersistentVolume{}
+
+	for _, pv := range pvs {
+		if pv.Spec.ClaimRef == nil || localVolumePath(pv) == "" {
+			continue
+		}
+
+		volumes[pv.Spec.ClaimRef.Namespace+"/"+pv.Spec.ClaimRef.Name] = pv
+	}
+
+	return volumes
+}
+
+// findLocalVolumes returns the local volumes the given pods to evict use
+func findLocalVolumes(pods []v1.Pod, volumesByClaim map[string]v1.PersistentVolume) (volumes []LocalVolume) {
+	for _, pod := range pods {
+		if !needsEviction(pod) {
+			continue
+		}
+
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim == nil {
+				continue
+			}
+
+			claim := pod.Namespace + "/" + volume.PersistentVolumeClaim.ClaimName
+			if pv, ok := volumesByClaim[claim]; ok {
+				volumes = append(volumes, LocalVolume{
+					Pod:    pod.Namespace + "/" + pod.Name,
+					Claim:  claim,
+					Volume: pv.Name,
+					Path:   localVolumePath(pv),
+				})
+			}
+		}
+	}
+
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].Claim < volumes[j].Claim
+	})
+
+	return
+}
+
+// prepareLocalVolumes calls the pre-drain hook for a victim with local volumes when configured to
+func (s *Shifter) prepareLocalVolumes(v Victim) error {
+	if len(v.LocalVolumes) == 0 || s.options.LocalVolumes != LocalVolumesHook {
+		return nil
+	}
+
+	if s.options.PreDrainHook == nil {
+		return fmt.Errorf("Node %v uses local volumes but no pre-drain hook is configured", v.Node)
+	}
+
+	return s.options.PreDrainHook.BeforeDrain(PreDrainRequest{
+		Cluster:  s.options.Cluster,
+		NodePool: s.options.NodePoolFrom,
+		Node:     v.Node,
+		Volumes:  v.LocalVolumes,
+	})
+}
@@ -0,0 +1,52 @@
+package shifter
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFindLocalVolumes(t *testing.T) {
+	pv := func(name, claim string, source v1.PersistentVolumeSource) v1.PersistentVolume {
+		return v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeSource: source,
+				ClaimRef:               &v1.ObjectReference{Namespace: "db", Name: claim},
+			},
+		}
+	}
+
+	volumesByClaim := localVolumesByClaim([]v1.PersistentVolume{
+		pv("pvc-local", "data-local", v1.PersistentVolumeSource{Local: &v1.LocalVolumeSource{Path: "/mnt/disks/ssd0"}}),
+		pv("pvc-host", "data-host", v1.PersistentVolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/opt/local-path-provisioner/pvc-host"}}),
+		pv("pvc-disk", "data-disk", v1.PersistentVolumeSource{GCEPersistentDisk: &v1.GCEPersistentDiskVolumeSource{PDName: "disk"}}),
+	})
+
+	pod := func(name string, claims ...string) v1.Pod {
+		pod := v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "db",
+			Name:            name,
+			OwnerReferences: []metav1.OwnerReference{{Kind: "StatefulSet", Name: name}},
+		}}
+		for _, claim := range claims {
+			pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
+				VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: claim}},
+			})
+		}
+		return pod
+	}
+
+	volumes := findLocalVolumes([]v1.Pod{pod("postgres-0", "data-local", "data-disk"), pod("redis-0", "data-host"), pod("web")}, volumesByClaim)
+
+	if len(volumes) != 2 {
+		t.Fatalf("findLocalVolumes, expected 2 local volumes got %v", volumes)
+	}
+	if volumes[0].Pod != "db/redis-0" || volumes[0].Path != "/opt/local-path-provisioner/pvc-host" {
+		t.Errorf("findLocalVolumes, expected the host path volume of db/redis-0 got %+v", volumes[0])
+	}
+	if volumes[1].Pod != "db/postgres-0" || volumes[1].Volume != "pvc-local" {
+		t.Errorf("findLocalVolumes, expected the local volume of db/postgres-0 got %+v", volumes[1])
+	}
+}
@@ -0,0 +1,50 @@
+package shifter
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MaintenanceExclusion is a window configured on a GKE cluster during which no maintenance should happen, e.g. a
+// retail freeze period
+type MaintenanceExclusion struct {
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// ParseMaintenanceExclusion parses an exclusion window as returned by the Container API, with RFC3339 start and end times
+func ParseMaintenanceExclusion(name, start, end string) (exclusion MaintenanceExclusion, err error) {
+	startTime, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return exclusion, fmt.Errorf("Error parsing start time of maintenance exclusion %v:\n%v", name, err)
+	}
+
+	endTime, err := time.Parse(time.RFC3339, end)
+	if err != nil {
+		return exclusion, fmt.Errorf("Error parsing end time of maintenance exclusion %v:\n%v", name, err)
+	}
+
+	return MaintenanceExclusion{Name: name, Start: startTime, End: endTime}, nil
+}
+
+// IsActive returns true if the given time falls within the exclusion window
+func (e MaintenanceExclusion) IsActive(now time.Time) bool {
+	return !now.Before(e.Start) && now.Before(e.End)
+}
+
+// FindActiveMaintenanceExclusion returns the exclusion active at the given time, the one ending last if several overlap
+func FindActiveMaintenanceExclusion(exclusions []MaintenanceExclusion, now time.Time) (exclusion MaintenanceExclusion, active bool) {
+	sort.SliceStable(exclusions, func(i, j int) bool {
+		return exclusions[i].End.After(exclusions[j].End)
+	})
+
+	for _, e := range exclusions {
+		if e.IsActive(now) {
+			return e, true
+		}
+	}
+
+	return MaintenanceExclusion{}, false
+}
@@ -0,0 +1,37 @@
+package shifter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFindActiveMaintenanceExclusion(t *testing.T) {
+	freeze, _ := ParseMaintenanceExclusion("freeze", "2020-11-20T00:00:00Z", "2020-12-01T00:00:00Z")
+	holidays, _ := ParseMaintenanceExclusion("holidays", "2020-11-25T00:00:00Z", "2021-01-05T00:00:00Z")
+	exclusions := []MaintenanceExclusion{freeze, holidays}
+
+	tests := []struct {
+		now      string
+		expected string
+	}{
+		{"2020-11-19T23:59:59Z", ""},
+		{"2020-11-20T00:00:00Z", "freeze"},
+		{"2020-11-26T00:00:00Z", "holidays"},
+		{"2021-01-05T00:00:00Z", ""},
+	}
+
+	for _, test := range tests {
+		now, _ := time.Parse(time.RFC3339, test.now)
+		exclusion, active := FindActiveMaintenanceExclusion(exclusions, now)
+
+		if active != (test.expected != "") || exclusion.Name != test.expected {
+			t.Errorf("FindActiveMaintenanceExclusion at %v, expected %q got %q", test.now, test.expected, exclusion.Name)
+		}
+	}
+}
+
+func TestParseMaintenanceExclusionInvalid(t *testing.T) {
+	if _, err := ParseMaintenanceExclusion("freeze", "tomorrow", "2020-12-01T00:00:00Z"); err == nil {
+		t.Errorf("ParseMaintenanceExclusion, expected an error for an invalid start time")
+	}
+}
@@ -0,0 +1,168 @@
+package shifter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+)
+
+// migrate runs the migration specific steps of a cycle: once the node pool migrated from is empty the migration is
+// complete and that node pool is deleted when requested; otherwise all its nodes are cordoned, so evicted pods only
+// land on the node pool migrated to, and the next step waits for all pods to be scheduled. It returns true with the
+// status of the cycle when the cycle ends there
+func (s *Shifter) migrate(zonesFrom ZoneStats, state *CycleState) (status string, done bool) {
+	nodePoolFrom, k := s.options.NodePoolFrom, s.kubernetes
+
+	// only the zones the filters keep are migrated
+	zonesMigrated := ZoneStats{}
+	for _, zone := range FilterZones(zonesFrom.Zones(), s.options.ZonesInclude, s.options.ZonesExclude) {
+		zonesMigrated[zone] = zonesFrom[zone]
+	}
+
+	if zonesMigrated.Sum() == 0 {
+		// the zones counted leave out excluded zones, filtered and retired nodes, which remain in the node pool
+		if err := s.verifyPoolEmpty(nodePoolFrom); err != nil {
+			log.Warn().
+				Err(err).
+				Str("node-pool", nodePoolFrom).
+				Msg("Node pool migrated from isn't empty, migration not complete")
+
+			state.SkipReason = "pool_not_empty"
+			state.Decision = "node pool migrated from still has nodes"
+			return "skipped", true
+		}
+
+		if s.options.DeleteMigratedPool {
+			ctx, cancel := context.WithTimeout(WithOperationRecorder(context.Background(), s.indexOperation), time.Duration(s.options.ShiftDeadline)*time.Second)
+			defer cancel()
+
+			log.Info().
+				Str("node-pool", nodePoolFrom).
+				Msg("Migration complete, deleting the node pool migrated from")
+
+			if err := s.from.DeleteNodePool(ctx, nodePoolFrom); err != nil {
+				log.Error().
+					Err(err).
+					Str("node-pool", nodePoolFrom).
+					Msg("Error deleting the node pool migrated from")
+
+				state.Decision = "error deleting the node pool migrated from"
+				return "failed", true
+			}
+		}
+
+		log.Info().
+			Str("node-pool-from", nodePoolFrom).
+			Str("node-pool-to", s.options.NodePoolTo).
+			Msg("Migration complete")
+
+		s.migrated = true
+		state.SkipReason = "migrated"
+		state.Decision = "migration complete"
+		return "skipped", true
+	}
+
+	nodes, err := k.GetNodeList(nodePoolFrom)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("node-pool", nodePoolFrom).
+			Msg("Error while listing nodes")
+
+		state.Decision = "error listing nodes of node pool to migrate from"
+		return "failed", true
+	}
+
+	for _, node := range nodes.Items {
+		if node.Spec.Unschedulable {
+			continue
+		}
+
+		log.Info().
+			Str("node-pool", nodePoolFrom).
+			Str("node", node.Name).
+			Msg("Cordoning node of the node pool migrated from")
+
+		if err := k.SetNodeUnschedulable(node.Name, true); err != nil {
+			log.Error().
+				Err(err).
+				Str("node", node.Name).
+				Msg("Error cordoning node")
+
+			state.Decision = "error cordoning nodes of node pool to migrate from"
+			return "failed", true
+		}
+	}
+
+	// the workloads moved by the previous step have to run again before the next one
+	pods, err := k.GetPods("", "")
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error while listing pods")
+
+		state.Decision = "error listing pods"
+		return "failed", true
+	}
+
+	if unschedulable := FindUnschedulablePods(pods.Items); len(unschedulable) > 0 {
+		log.Info().
+			Strs("pods", unschedulable).
+			Msg("Pods are waiting to be scheduled, waiting for the workloads to settle before the next migration step")
+
+		state.SkipReason = "unschedulable_pods"
+		state.Decision = fmt.Sprintf("%d pod(s) waiting to be scheduled", len(unschedulable))
+		return "skipped", true
+	}
+
+	return "", false
+}
+
+// verifyPoolEmpty returns an error if a node pool still has any node, whatever the zone and node filters, or GKE still
+// targets any instance for it
+func (s *Shifter) verifyPoolEmpty(name string) error {
+	nodes, err := s.kubernetes.GetNodeList(name)
+	if err != nil {
+		return fmt.Errorf("Error listing nodes of node pool %v:\n%v", name, err)
+	}
+
+	if len(nodes.Items) > 0 {
+		return fmt.Errorf("Node pool %v still has %d node(s), e.g. %v", name, len(nodes.Items), nodes.Items[0].Name)
+	}
+
+	sizes, err := s.from.GetNodePoolTargetSizes(name)
+	if err != nil {
+		return fmt.Errorf("Error getting target sizes of node pool %v:\n%v", name, err)
+	}
+
+	for zone, size := range sizes {
+		if size > 0 {
+			return fmt.Errorf("Node pool %v still targets %d instance(s) in zone %v", name, size, zone)
+		}
+	}
+
+	return nil
+}
+
+// FindUnschedulablePods returns the namespace/name of the pending pods the scheduler failed to find a node for
+func FindUnschedulablePods(pods []v1.Pod) (names []string) {
+	for _, pod := range pods {
+		if pod.Status.Phase != v1.PodPending {
+			continue
+		}
+
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse && condition.Reason == v1.PodReasonUnschedulable {
+				names = append(names, pod.Namespace+"/"+pod.Name)
+				break
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,63 @@
+package shifter
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFindUnschedulablePods(t *testing.T) {
+	pod := func(name string, phase v1.PodPhase, conditions ...v1.PodCondition) v1.Pod {
+		return v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Status:     v1.PodStatus{Phase: phase, Conditions: conditions},
+		}
+	}
+
+	unschedulable := v1.PodCondition{Type: v1.PodScheduled, Status: v1.ConditionFalse, Reason: v1.PodReasonUnschedulable}
+	scheduled := v1.PodCondition{Type: v1.PodScheduled, Status: v1.ConditionTrue}
+
+	pods := []v1.Pod{
+		pod("running", v1.PodRunning, scheduled),
+		pod("pulling", v1.PodPending, scheduled),
+		pod("waiting", v1.PodPending, unschedulable),
+		pod("new", v1.PodPending),
+	}
+
+	got := FindUnschedulablePods(pods)
+
+	if !reflect.DeepEqual(got, []string{"default/waiting"}) {
+		t.Errorf("FindUnschedulablePods, expected [default/waiting] got %v", got)
+	}
+}
+
+func TestMigrateComplete(t *testing.T) {
+	// the only node left is in a zone excluded from the migration
+	k := newFakeKubernetes(
+		fakeNode("a-c-1", "pool-a", "europe-west1-c"),
+		fakeNode("b-b-1", "pool-b", "europe-west1-b"),
+		fakeNode("b-c-1", "pool-b", "europe-west1-c"),
+	)
+	g := newFakeContainer(k, map[string][]string{
+		"pool-a": {"europe-west1-b", "europe-west1-c"},
+		"pool-b": {"europe-west1-b", "europe-west1-c"},
+	})
+
+	s := newFakeShifter(Options{Migrate: true, ZonesExclude: []string{"europe-west1-c"}}, k, g)
+
+	status, _, state := s.RunCycle()
+
+	if status != "skipped" || state.SkipReason != "pool_not_empty" || s.migrated {
+		t.Errorf("expected skipped %q with a node left in an excluded zone got %v %q: %v", "pool_not_empty", status, state.SkipReason, state.Decision)
+	}
+
+	k.nodes = k.nodes[1:]
+
+	status, _, state = s.RunCycle()
+
+	if status != "skipped" || state.SkipReason != "migrated" || !s.migrated {
+		t.Errorf("expected skipped %q once the node pool is empty got %v %q: %v", "migrated", status, state.SkipReason, state.Decision)
+	}
+}
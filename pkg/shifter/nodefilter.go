@@ -0,0 +1,59 @@
+package shifter
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// NodeFilter restricts the nodes of a node pool taking part in shifts, e.g. to leave out nodes reserved for dedicated
+// workloads without splitting them into their own node pool; the zero value matches all nodes
+type NodeFilter struct {
+	Selector      labels.Selector
+	ExcludeTaints []string
+}
+
+// ParseNodeFilter returns a filter matching the nodes whose labels match a label selector, e.g. dedicated!=batch, and
+// that don't carry a taint with any of the given keys
+func ParseNodeFilter(selector string, excludeTaints []string) (filter NodeFilter, err error) {
+	filter.ExcludeTaints = excludeTaints
+
+	if selector != "" {
+		filter.Selector, err = labels.Parse(selector)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid node filter selector %q:\n%v", selector, err)
+		}
+	}
+
+	return
+}
+
+// Matches returns true if a node takes part in shifts
+func (f NodeFilter) Matches(node v1.Node) bool {
+	if f.Selector != nil && !f.Selector.Matches(labels.Set(node.Labels)) {
+		return false
+	}
+
+	for _, taint := range node.Spec.Taints {
+		for _, key := range f.ExcludeTaints {
+			if taint.Key == key {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Filter returns the nodes taking part in shifts
+func (f NodeFilter) Filter(nodes []v1.Node) []v1.Node {
+	filtered := []v1.Node{}
+	for _, node := range nodes {
+		if f.Matches(node) {
+			filtered = append(filtered, node)
+		}
+	}
+
+	return filtered
+}
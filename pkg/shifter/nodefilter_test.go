@@ -0,0 +1,49 @@
+package shifter
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNodeFilterMatches(t *testing.T) {
+	node := func(labels map[string]string, taints ...string) v1.Node {
+		node := v1.Node{ObjectMeta: metav1.ObjectMeta{Labels: labels}}
+		for _, key := range taints {
+			node.Spec.Taints = append(node.Spec.Taints, v1.Taint{Key: key, Effect: v1.TaintEffectNoSchedule})
+		}
+		return node
+	}
+
+	filter, err := ParseNodeFilter("dedicated!=batch", []string{"reserved"})
+	if err != nil {
+		t.Fatalf("ParseNodeFilter, expected no error got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		node     v1.Node
+		expected bool
+	}{
+		{"plain", node(nil), true},
+		{"other workload", node(map[string]string{"dedicated": "web"}), true},
+		{"dedicated", node(map[string]string{"dedicated": "batch"}), false},
+		{"reserved", node(nil, "reserved"), false},
+		{"other taint", node(nil, "cloud.google.com/gke-preemptible"), true},
+	}
+
+	for _, test := range tests {
+		if output := filter.Matches(test.node); output != test.expected {
+			t.Errorf("Matches(%v), expected %v got %v", test.name, test.expected, output)
+		}
+	}
+
+	if !(NodeFilter{}).Matches(node(map[string]string{"dedicated": "batch"}, "reserved")) {
+		t.Errorf("Matches, expected the zero filter to match all nodes")
+	}
+
+	if _, err := ParseNodeFilter("dedicated in (", nil); err == nil {
+		t.Errorf("ParseNodeFilter, expected an error for an invalid selector")
+	}
+}
@@ -0,0 +1,98 @@
+package shifter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// operationIndexSize is the number of operations kept in memory
+const operationIndexSize = 100
+
+// Operation is a GKE or Compute Engine operation started by the shifter, its name identifies it in the GCP audit logs
+// and the kind is one of set_node_pool_size, delete_node_pool, delete_instances or resize_instance_group it was
+// started; the target is the node pool or instance group it acts on
+type Operation struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	Target    string    `json:"target"`
+	Zone      string    `json:"zone,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// OperationRecorder receives the operations started on behalf of a context
+type OperationRecorder func(Operation)
+
+type operationRecorderKey struct{}
+
+// WithOperationRecorder returns a context whose operations are reported to the given recorder
+func WithOperationRecorder(ctx context.Context, recorder OperationRecorder) context.Context {
+	return context.WithValue(ctx, operationRecorderKey{}, recorder)
+}
+
+// RecordOperation reports an operation to the recorder of the context, if any; clients call it for every operation
+// they start
+func RecordOperation(ctx context.Context, operation Operation) {
+	if recorder, ok := ctx.Value(operationRecorderKey{}).(OperationRecorder); ok {
+		recorder(operation)
+	}
+}
+
+// logOperation logs a started operation so it can be found in the GCP audit logs
+func logOperation(logger zerolog.Logger, operation Operation) {
+	logger.Info().
+		Str("operation", operation.Name).
+		Str("kind", operation.Kind).
+		Str("target", operation.Target).
+		Str("zone", operation.Zone).
+		Msg("Started operation")
+}
+
+// indexOperation logs and indexes an operation started outside of a shift
+func (s *Shifter) indexOperation(operation Operation) {
+	logOperation(log.Logger, operation)
+
+	s.operations.Add(operation)
+}
+
+// detachContext returns a context without the deadline of the given one, reporting its operations to the same recorder
+func detachContext(ctx context.Context) context.Context {
+	if recorder, ok := ctx.Value(operationRecorderKey{}).(OperationRecorder); ok {
+		return WithOperationRecorder(context.Background(), recorder)
+	}
+
+	return context.Background()
+}
+
+// OperationIndex keeps the most recent operations in memory, it's safe for concurrent use
+type OperationIndex struct {
+	mutex      sync.Mutex
+	operations []Operation
+}
+
+// Add adds an operation, dropping the oldest one when the index is full
+func (i *OperationIndex) Add(operation Operation) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.operations = append(i.operations, operation)
+	if len(i.operations) > operationIndexSize {
+		i.operations = i.operations[len(i.operations)-operationIndexSize:]
+	}
+}
+
+// List returns the operations, the most recent first
+func (i *OperationIndex) List() []Operation {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	operations := make([]Operation, len(i.operations))
+	for j, operation := range i.operations {
+		operations[len(i.operations)-1-j] = operation
+	}
+
+	return operations
+}
@@ -0,0 +1,40 @@
+package shifter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestRecordOperation(t *testing.T) {
+	recorded := []Operation{}
+	ctx := WithOperationRecorder(context.Background(), func(operation Operation) {
+		recorded = append(recorded, operation)
+	})
+
+	RecordOperation(ctx, Operation{Name: "operation-1"})
+	RecordOperation(detachContext(ctx), Operation{Name: "operation-2"})
+	RecordOperation(context.Background(), Operation{Name: "operation-3"})
+
+	if len(recorded) != 2 || recorded[0].Name != "operation-1" || recorded[1].Name != "operation-2" {
+		t.Errorf("RecordOperation, expected operation-1 and operation-2 to be recorded got %v", recorded)
+	}
+}
+
+func TestOperationIndex(t *testing.T) {
+	index := &OperationIndex{}
+
+	for i := 0; i < operationIndexSize+5; i++ {
+		index.Add(Operation{Name: fmt.Sprintf("operation-%d", i)})
+	}
+
+	operations := index.List()
+
+	if len(operations) != operationIndexSize {
+		t.Fatalf("OperationIndex, expected %d operations got %d", operationIndexSize, len(operations))
+	}
+
+	if operations[0].Name != fmt.Sprintf("operation-%d", operationIndexSize+4) || operations[len(operations)-1].Name != "operation-5" {
+		t.Errorf("OperationIndex, expected the most recent operations first got %v to %v", operations[0].Name, operations[len(operations)-1].Name)
+	}
+}
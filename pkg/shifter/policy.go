@@ -0,0 +1,12 @@
+package shifter
+
+// PolicyRequest is what a policy hook decides on: the planned shift and the state of the cycle that planned it
+type PolicyRequest struct {
+	Plan  ShiftPlan   `json:"plan"`
+	State *CycleState `json:"state"`
+}
+
+// PolicyHook decides whether a planned shift may proceed, with the reason when it may not
+type PolicyHook interface {
+	Allow(PolicyRequest) (allowed bool, reason string, err error)
+}
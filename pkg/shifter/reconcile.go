@@ -0,0 +1,111 @@
+package shifter
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// desiredSize is the size per zone the node pool shifted to is reconciled to, persisted in the state ConfigMap so it
+// survives a restart of the shifter
+type desiredSize struct {
+	NodePoolTo string    `json:"nodePoolTo"`
+	ToSize     int       `json:"toSize"`
+	Since      time.Time `json:"since"`
+}
+
+// setDesiredToSize records the size per zone to reconcile the node pool shifted to to, counting preemptions from since
+func (s *Shifter) setDesiredToSize(size int, since time.Time) {
+	s.desiredToSize = size
+	s.desiredSince = since
+
+	if s.options.StateConfigMap == "" {
+		return
+	}
+
+	err := persistState(s.kubernetes, s.options.StateConfigMap, "desired", desiredSize{
+		NodePoolTo: s.options.NodePoolTo,
+		ToSize:     size,
+		Since:      since,
+	})
+
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("configmap", s.options.StateConfigMap).
+			Msg("Error persisting the size to reconcile the node pool to")
+	}
+}
+
+// loadDesiredToSize reads the size to reconcile the node pool shifted to to back from the state ConfigMap, a size
+// persisted for another node pool is ignored
+func (s *Shifter) loadDesiredToSize() error {
+	desired := desiredSize{}
+
+	found, err := loadState(s.kubernetes, s.options.StateConfigMap, "desired", &desired)
+	if err != nil || !found || desired.NodePoolTo != s.options.NodePoolTo {
+		return err
+	}
+
+	s.desiredToSize = desired.ToSize
+	s.desiredSince = desired.Since
+
+	return nil
+}
+
+// reconcile tops the node pool shifted to back up to the size the last shift left it at, when preemptions shrank it
+// since; a pool that shrank without preemptions, e.g. scaled down by the cluster-autoscaler, is taken as is. It returns
+// whether the pool was resized
+func (s *Shifter) reconcile(locationsTo []string, zonesTo ZoneStats, state *CycleState) bool {
+	nodePoolTo := s.options.NodePoolTo
+
+	if s.desiredToSize == 0 || len(zonesTo) == 0 {
+		return false
+	}
+
+	// a preempted node can linger NotReady until its instance is recreated
+	current := s.withoutOffsets(zonesTo).MinReady()
+	if current >= s.desiredToSize {
+		return false
+	}
+
+	preemptions, err := s.cloud.CountPreemptions(nodePoolTo, locationsTo, s.desiredSince)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("node-pool", nodePoolTo).
+			Msg("Error while counting preemptions, not reconciling the node pool size")
+		return false
+	}
+
+	// only nodes that are gone shrink the pool, a node merely NotReady without preemptions may come back
+	if preemptions == 0 {
+		if total := s.withoutOffsets(zonesTo).Min(); total < s.desiredToSize {
+			s.setDesiredToSize(total, s.desiredSince)
+		}
+		return false
+	}
+
+	log.Info().
+		Str("node-pool", nodePoolTo).
+		Msgf("Node pool lost capacity to %d preemption(s), topping it up from %d to %d node(s) per region", preemptions, current, s.desiredToSize)
+
+	ctx, cancel := context.WithTimeout(WithOperationRecorder(context.Background(), s.indexOperation), time.Duration(s.options.ShiftDeadline)*time.Second)
+	defer cancel()
+
+	if err := s.setToSize(ctx, locationsTo, int64(s.desiredToSize)); err != nil {
+		log.Error().
+			Err(err).
+			Str("node-pool", nodePoolTo).
+			Msg("Error topping up node pool")
+		return false
+	}
+
+	// the preemptions made up for don't count again
+	s.setDesiredToSize(s.desiredToSize, s.clock.Now())
+	state.ReconciledNodes = s.desiredToSize - current
+
+	return true
+}
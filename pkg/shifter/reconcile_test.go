@@ -0,0 +1,99 @@
+package shifter
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name        string
+		desired     int
+		preemptions int
+		notReady    []string
+		removed     []string
+		reconciled  bool
+		resize      string
+		expected    int
+	}{
+		{"no shift yet", 0, 1, []string{"b-b-2"}, nil, false, "", 0},
+		{"at desired size", 2, 1, nil, nil, false, "", 2},
+		{"preempted node NotReady", 2, 1, []string{"b-b-2"}, nil, true, "SetNodePoolSize pool-b 2", 2},
+		{"preempted node gone", 2, 1, nil, []string{"b-c-2"}, true, "SetNodePoolSize pool-b 2", 2},
+		{"NotReady without preemptions", 2, 0, []string{"b-b-2"}, nil, false, "", 2},
+		{"scaled down without preemptions", 2, 0, nil, []string{"b-c-2"}, false, "", 1},
+	}
+
+	for _, test := range tests {
+		// pool-b has two nodes in both zones
+		nodes := []v1.Node{}
+		for _, node := range []v1.Node{
+			fakeNode("b-b-1", "pool-b", "europe-west1-b"),
+			fakeNode("b-b-2", "pool-b", "europe-west1-b"),
+			fakeNode("b-c-1", "pool-b", "europe-west1-c"),
+			fakeNode("b-c-2", "pool-b", "europe-west1-c"),
+		} {
+			if !contains(test.removed, node.Name) {
+				nodes = append(nodes, node)
+			}
+		}
+
+		k := newFakeKubernetes(nodes...)
+		for _, name := range test.notReady {
+			k.node(name).Status.Conditions[0].Status = v1.ConditionFalse
+		}
+
+		locations := []string{"europe-west1-b", "europe-west1-c"}
+		g := newFakeContainer(k, map[string][]string{"pool-b": locations})
+
+		s := newFakeShifter(Options{}, k, g)
+		s.cloud = fakeCloud{preemptions: test.preemptions}
+		s.desiredToSize = test.desired
+
+		zonesTo, _ := k.GetZones("pool-b", locations, NodeFilter{})
+		state := &CycleState{}
+
+		if output := s.reconcile(locations, zonesTo, state); output != test.reconciled {
+			t.Errorf("%v: expected reconciled %v got %v", test.name, test.reconciled, output)
+		}
+		if test.resize != "" && !contains(g.calls, test.resize) {
+			t.Errorf("%v: expected %v got %v", test.name, test.resize, g.calls)
+		}
+		if test.resize == "" && len(g.calls) > 0 {
+			t.Errorf("%v: expected no resize got %v", test.name, g.calls)
+		}
+		if s.desiredToSize != test.expected {
+			t.Errorf("%v: expected the desired size %d got %d", test.name, test.expected, s.desiredToSize)
+		}
+	}
+}
+
+func TestDesiredToSizePersisted(t *testing.T) {
+	since := time.Date(2021, 9, 1, 9, 0, 0, 0, time.UTC)
+
+	k := newFakeKubernetes()
+	g := newFakeContainer(k, nil)
+
+	s := newFakeShifter(Options{StateConfigMap: "state"}, k, g)
+	s.setDesiredToSize(3, since)
+
+	if err := persistShiftRecord(k, "state", ShiftRecord{Phase: PhaseDone}); err != nil {
+		t.Fatalf("persisting the shift, expected no error got %v", err)
+	}
+
+	restarted := newFakeShifter(Options{StateConfigMap: "state"}, k, g)
+	if err := restarted.loadDesiredToSize(); err != nil {
+		t.Fatalf("loading the desired size, expected no error got %v", err)
+	}
+	if restarted.desiredToSize != 3 || !restarted.desiredSince.Equal(since) {
+		t.Errorf("expected the desired size 3 since %v got %d since %v", since, restarted.desiredToSize, restarted.desiredSince)
+	}
+
+	other := newFakeShifter(Options{StateConfigMap: "state"}, k, g)
+	other.options.NodePoolTo = "pool-c"
+	if err := other.loadDesiredToSize(); err != nil || other.desiredToSize != 0 {
+		t.Errorf("other node pool, expected no desired size got %d %v", other.desiredToSize, err)
+	}
+}
@@ -0,0 +1,582 @@
+package shifter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// operationWaitTimeoutSecond define the time wait in second before assuming the failure of a rollback
+	operationWaitTimeoutSecond = 600
+
+	// operationPollIntervalSecond define the interval in second between each retry or node count check
+	operationPollIntervalSecond = 10
+
+	// shiftedFromLabel is set on nodes added by a shift to the node pool they were shifted from
+	shiftedFromLabel = "estafette.io/shifted-from"
+
+	// shiftedAtLabel is set on nodes added by a shift to the unix time of the shift
+	shiftedAtLabel = "estafette.io/shifted-at"
+)
+
+// RetiredLabel is set in cordon only mode on drained nodes left for the cluster-autoscaler to remove, to the unix time
+// they were shifted away; those nodes no longer count towards the size of their node pool
+const RetiredLabel = "estafette.io/retired-at"
+
+// ErrResizeDeclined is returned by a client when the operator declines a resize in interactive mode, it is never
+// retried nor rolled back
+var ErrResizeDeclined = errors.New("resize declined by operator")
+
+// ShiftError describes why a shift failed, the reason is one of scale_up_failed, verify_failed, warm_up_failed,
+// capacity_floor, drain_failed, scale_down_failed, declined, deadline_exceeded or interrupted
+type ShiftError struct {
+	Reason string
+	Err    error
+}
+
+func (e *ShiftError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Reason, e.Err)
+}
+
+func (e *ShiftError) Unwrap() error {
+	return e.Err
+}
+
+// newShiftError returns a ShiftError for the given reason, unless the deadline of the shift was exceeded
+func newShiftError(ctx context.Context, reason string, err error) *ShiftError {
+	if errors.Is(err, ErrResizeDeclined) {
+		reason = "declined"
+	} else if ctx.Err() == context.DeadlineExceeded {
+		reason = "deadline_exceeded"
+	}
+
+	return &ShiftError{
+		Reason: reason,
+		Err:    err,
+	}
+}
+
+// shift holds what a shift in progress works with while it moves through its phases
+type shift struct {
+	ctx           context.Context
+	retries       int
+	toLocations   []string
+	victims       []Victim
+	toCurrentSize int
+	count         int
+
+	// the nodes that already exist, to recognize the ones added by this shift
+	existingNodes map[string]bool
+
+	// set once instances of the pool shifted from were deleted, the capacity added to the pool shifted to replaces them
+	removed bool
+
+	record      ShiftRecord
+	transitions []ShiftTransition
+	err         *ShiftError
+
+	// logger carries the operations started by the shift so far
+	logger zerolog.Logger
+}
+
+// shiftNode safely try to add count nodes per zone to a pool with a single resize, then drain and remove the selected
+// victims from another with a single deletion per zone, within the shift deadline and retry budget; when a step fails
+// after the pool to shift to has been resized, that resize is rolled back. The shift moves through the phases Planned,
+// ScalingUp, VerifyingUp, Draining and ScalingDown to Done, Failed or RolledBack, the transitions are returned
+func (s *Shifter) shiftNode(toLocations []string, victims []Victim, toCurrentSize, count int) (transitions []ShiftTransition, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.options.ShiftDeadline)*time.Second)
+	defer cancel()
+
+	now := s.clock.Now()
+	sh := &shift{
+		ctx:           ctx,
+		retries:       s.options.ShiftRetries,
+		toLocations:   toLocations,
+		victims:       victims,
+		toCurrentSize: toCurrentSize,
+		count:         count,
+		record: ShiftRecord{
+			NodePoolFrom: s.options.NodePoolFrom,
+			NodePoolTo:   s.options.NodePoolTo,
+			ToSize:       toCurrentSize,
+			ToNewSize:    toCurrentSize + count,
+			ZoneOffsets:  s.copyZoneOffsets(),
+			StartedAt:    now,
+		},
+	}
+
+	for _, v := range victims {
+		sh.record.Victims = append(sh.record.Victims, v.Node)
+	}
+	sh.record.Namespaces = AffectedNamespaces(victims)
+
+	sh.logger = log.Logger
+	sh.ctx = WithOperationRecorder(ctx, func(operation Operation) {
+		s.recordOperation(sh, operation)
+	})
+
+	s.transition(sh, PhasePlanned)
+
+	for !sh.record.Phase.IsFinal() {
+		var next ShiftPhase
+
+		switch sh.record.Phase {
+		case PhasePlanned:
+			next = s.plan(sh)
+		case PhaseScalingUp:
+			next = s.scaleUp(sh)
+		case PhaseVerifyingUp:
+			next = s.verifyUp(sh)
+		case PhaseDraining:
+			next = s.drain(sh)
+		case PhaseScalingDown:
+			next = s.scaleDown(sh)
+		}
+
+		s.transition(sh, next)
+	}
+
+	if sh.err != nil {
+		return sh.transitions, sh.err
+	}
+
+	return sh.transitions, nil
+}
+
+// plan records the nodes of the pool shifted to before it's resized
+func (s *Shifter) plan(sh *shift) ShiftPhase {
+	toName := s.options.NodePoolTo
+
+	existingNodes, err := getNodeNames(s.kubernetes, toName)
+
+	if err != nil {
+		sh.logger.Warn().
+			Err(err).
+			Str("node-pool", toName).
+			Msg("Error listing nodes, the added nodes won't be labeled")
+	}
+
+	sh.existingNodes = existingNodes
+
+	// nothing was changed yet, an aborting hook just fails the shift
+	if !s.runShiftHook(sh, "pre_shift", s.options.PreShiftHook, s.options.PreShiftHookFailure) {
+		return PhaseFailed
+	}
+
+	return PhaseScalingUp
+}
+
+// scaleUp adds count nodes per zone to the pool shifted to with a single resize
+func (s *Shifter) scaleUp(sh *shift) ShiftPhase {
+	toName := s.options.NodePoolTo
+	toNewSize := int64(sh.toCurrentSize + sh.count)
+
+	sh.logger.Info().
+		Str("node-pool", toName).
+		Msgf("Adding %d node(s) to the pool for each region, currently %d node(s), expecting %d node(s) per region", sh.count, sh.toCurrentSize, toNewSize)
+
+	err := retryWithBudget(sh.ctx, s.clock, s.jitter, &sh.retries, func() error {
+		return s.setToSize(sh.ctx, sh.toLocations, toNewSize)
+	})
+
+	if err == nil {
+		return PhaseVerifyingUp
+	}
+
+	sh.err = newShiftError(sh.ctx, "scale_up_failed", err)
+
+	sh.logger.Error().
+		Err(err).
+		Str("node-pool", toName).
+		Str("reason", sh.err.Reason).
+		Msg("Error resizing node pool")
+
+	// a resize that timed out might still be applied
+	return s.rollback(sh)
+}
+
+// verifyUp waits until the nodes added to the pool shifted to exist and, when a warm up period is set, are warmed up
+func (s *Shifter) verifyUp(sh *shift) ShiftPhase {
+	k, toName := s.kubernetes, s.options.NodePoolTo
+
+	err := s.verifyProvisioning(sh)
+
+	if err != nil {
+		sh.err = newShiftError(sh.ctx, "verify_failed", err)
+
+		sh.logger.Error().
+			Err(err).
+			Str("node-pool", toName).
+			Str("reason", sh.err.Reason).
+			Msg("Node pool has less nodes than expected after resize")
+
+		return s.rollback(sh)
+	}
+
+	// keep the preemptible killer off the nodes the shift relies on until it's done
+	if s.options.PreemptibleKillerCoordination {
+		deadline, _ := sh.ctx.Deadline()
+		leaseNodes(k, toName, deadline)
+	}
+
+	if s.options.WarmUpPeriod > 0 {
+		err = waitForWarmUp(sh.ctx, s.clock, s.jitter, k, toName, sh.existingNodes, time.Duration(s.options.WarmUpPeriod)*time.Second)
+
+		if err != nil {
+			sh.err = newShiftError(sh.ctx, "warm_up_failed", err)
+
+			sh.logger.Error().
+				Err(err).
+				Str("node-pool", toName).
+				Str("reason", sh.err.Reason).
+				Msg("Added nodes didn't warm up")
+
+			return s.rollback(sh)
+		}
+	}
+
+	return PhaseDraining
+}
+
+// drain drains all victims first, so the instances of a zone can be deleted with a single request; nothing is drained
+// if removing the victims would take the cluster below its capacity floor
+func (s *Shifter) drain(sh *shift) ShiftPhase {
+	if err := s.checkCapacityFloor(sh.victims); err != nil {
+		return s.abortRemoval(sh, "capacity_floor", err, nil)
+	}
+
+	for i, v := range sh.victims {
+		sh.logger.Info().
+			Str("node-pool", s.options.NodePoolFrom).
+			Str("node", v.Node).
+			Str("zone", v.Zone).
+			Msgf("Draining node to remove from the pool, evicting %d pod(s)", v.Pods)
+
+		if err := s.prepareLocalVolumes(v); err != nil {
+			return s.abortRemoval(sh, "pre_drain_failed", err, sh.victims[:i])
+		}
+
+		if err := drainNode(sh.ctx, s.clock, s.kubernetes, v.Node, s.options.AffinityAwareDrain, s.options.NamespaceEvictionLimit, s.options.DrainObserver); err != nil {
+			return s.abortRemoval(sh, "drain_failed", err, sh.victims[:i+1])
+		}
+	}
+
+	return PhaseScalingDown
+}
+
+// scaleDown deletes the instances of the drained victims with a single request per zone, in cordon only mode they're
+// retired instead
+func (s *Shifter) scaleDown(sh *shift) ShiftPhase {
+	fromName := s.options.NodePoolFrom
+
+	if s.options.CordonOnly {
+		s.retire(sh)
+
+		if sh.existingNodes != nil {
+			labelShiftedNodes(s.kubernetes, fromName, s.options.NodePoolTo, sh.existingNodes, s.clock.Now())
+		}
+
+		return s.finish(sh)
+	}
+
+	zones, victimsByZone := groupVictimsByZone(sh.victims)
+
+	for i, zone := range zones {
+		instances := []string{}
+		for _, v := range victimsByZone[zone] {
+			instances = append(instances, v.Instance)
+		}
+
+		sh.logger.Info().
+			Str("node-pool", fromName).
+			Str("zone", zone).
+			Msgf("Removing %d node(s) from the pool", len(instances))
+
+		err := retryWithBudget(sh.ctx, s.clock, s.jitter, &sh.retries, func() error {
+			return s.from.DeleteNodePoolInstances(sh.ctx, fromName, zone, instances)
+		})
+
+		if err != nil {
+			// the nodes of the zones that haven't been deleted yet stay
+			remaining := []Victim{}
+			for _, zone := range zones[i:] {
+				remaining = append(remaining, victimsByZone[zone]...)
+			}
+
+			return s.abortRemoval(sh, "scale_down_failed", err, remaining)
+		}
+
+		sh.removed = true
+		sh.record.Removed = true
+	}
+
+	if sh.existingNodes != nil {
+		labelShiftedNodes(s.kubernetes, fromName, s.options.NodePoolTo, sh.existingNodes, s.clock.Now())
+	}
+
+	return s.finish(sh)
+}
+
+// finish runs the post-shift hook once the nodes moved; an aborting hook fails the shift, which can't be rolled back
+func (s *Shifter) finish(sh *shift) ShiftPhase {
+	if !s.runShiftHook(sh, "post_shift", s.options.PostShiftHook, s.options.PostShiftHookFailure) {
+		return PhaseFailed
+	}
+
+	return PhaseDone
+}
+
+// retire labels the drained victims as retired, leaving them cordoned for the cluster-autoscaler to remove; a victim
+// that fails to be labeled would be counted and selected again, so it's uncordoned instead
+func (s *Shifter) retire(sh *shift) {
+	retired := map[string]string{
+		RetiredLabel: strconv.FormatInt(s.clock.Now().Unix(), 10),
+	}
+
+	for _, v := range sh.victims {
+		sh.logger.Info().
+			Str("node-pool", s.options.NodePoolFrom).
+			Str("node", v.Node).
+			Str("zone", v.Zone).
+			Msg("Leaving drained node cordoned for the cluster-autoscaler to remove")
+
+		if err := s.kubernetes.SetNodeLabels(v.Node, retired); err != nil {
+			sh.logger.Error().
+				Err(err).
+				Str("node", v.Node).
+				Msg("Error labeling node as retired, uncordoning it")
+
+			if err := s.kubernetes.SetNodeUnschedulable(v.Node, false); err != nil {
+				sh.logger.Error().
+					Err(err).
+					Str("node", v.Node).
+					Msg("Error uncordoning node")
+			}
+		}
+	}
+}
+
+// recordOperation adds an operation started by the shift to its record, its log lines and the index of operations
+func (s *Shifter) recordOperation(sh *shift, operation Operation) {
+	sh.record.Operations = append(sh.record.Operations, operation.Name)
+	sh.logger = log.With().Strs("operations", sh.record.Operations).Logger()
+
+	logOperation(sh.logger, operation)
+
+	s.operations.Add(operation)
+}
+
+// abortRemoval makes the given victims schedulable again since they stay, unless migrating, and rolls back the resize
+// of the pool shifted to unless the operator declined the removal
+func (s *Shifter) abortRemoval(sh *shift, reason string, err error, victims []Victim) ShiftPhase {
+	sh.err = newShiftError(sh.ctx, reason, err)
+
+	sh.logger.Error().
+		Err(err).
+		Str("node-pool", s.options.NodePoolFrom).
+		Str("reason", sh.err.Reason).
+		Msg("Error removing nodes")
+
+	// a migration keeps the whole node pool cordoned
+	if s.options.Migrate {
+		victims = nil
+	}
+
+	for _, v := range victims {
+		if err := s.kubernetes.SetNodeUnschedulable(v.Node, false); err != nil {
+			sh.logger.Error().
+				Err(err).
+				Str("node", v.Node).
+				Msg("Error uncordoning node")
+		}
+	}
+
+	return s.rollback(sh)
+}
+
+// rollback resets the pool shifted to to its size before the shift, unless the operator declined the shift or nodes of
+// the pool shifted from were already deleted: resizing the pool shifted to as a whole would also remove the capacity
+// replacing them
+func (s *Shifter) rollback(sh *shift) ShiftPhase {
+	if sh.err.Reason == "declined" {
+		return PhaseFailed
+	}
+
+	if sh.removed {
+		sh.logger.Warn().
+			Str("node-pool", s.options.NodePoolTo).
+			Msg("Nodes were removed in some zones already, keeping the node pool shifted to at its new size")
+		return PhaseFailed
+	}
+
+	// the rollback gets its own deadline since the one of the shift might have been exceeded already
+	ctx, cancel := context.WithTimeout(detachContext(sh.ctx), operationWaitTimeoutSecond*time.Second)
+	defer cancel()
+
+	if err := s.rollbackToSize(ctx, sh.logger, sh.toLocations, int64(sh.toCurrentSize)); err != nil {
+		return PhaseFailed
+	}
+
+	return PhaseRolledBack
+}
+
+// groupVictimsByZone groups victims by zone, keeping the zones in the order they first appear
+func groupVictimsByZone(victims []Victim) (zones []string, victimsByZone map[string][]Victim) {
+	victimsByZone = map[string][]Victim{}
+
+	for _, v := range victims {
+		if _, ok := victimsByZone[v.Zone]; !ok {
+			zones = append(zones, v.Zone)
+		}
+		victimsByZone[v.Zone] = append(victimsByZone[v.Zone], v)
+	}
+
+	return
+}
+
+// getNodeNames returns the set of names of the nodes of a given node pool
+func getNodeNames(k KubernetesClient, name string) (names map[string]bool, err error) {
+	nodes, err := k.GetNodeList(name)
+
+	if err != nil {
+		return
+	}
+
+	names = map[string]bool{}
+	for _, node := range nodes.Items {
+		names[node.Name] = true
+	}
+
+	return
+}
+
+// labelShiftedNodes records on each node added to a node pool since the given set of nodes where it was shifted from
+// and at the given time, so nodes that exist because of the shifter can be traced back; failing to do so doesn't fail the shift
+func labelShiftedNodes(k KubernetesClient, fromName, toName string, existingNodes map[string]bool, now time.Time) {
+	nodes, err := getNodeNames(k, toName)
+
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("node-pool", toName).
+			Msg("Error listing nodes, the added nodes won't be labeled")
+		return
+	}
+
+	provenance := map[string]string{
+		shiftedFromLabel: fromName,
+		shiftedAtLabel:   strconv.FormatInt(now.Unix(), 10),
+	}
+
+	for node := range nodes {
+		if existingNodes[node] {
+			continue
+		}
+
+		if err := k.SetNodeLabels(node, provenance); err != nil {
+			log.Warn().
+				Err(err).
+				Str("node", node).
+				Msg("Error labeling node added by the shift")
+		}
+	}
+}
+
+// retryWithBudget calls fn until it succeeds, the retry budget is spent or the context is done
+func retryWithBudget(ctx context.Context, c Clock, j Jitter, retries *int, fn func() error) (err error) {
+	for {
+		err = fn()
+
+		if err == nil || errors.Is(err, ErrResizeDeclined) || ctx.Err() != nil || *retries <= 0 {
+			return
+		}
+
+		*retries--
+
+		sleepTime := j.Apply(operationPollIntervalSecond)
+		log.Warn().Err(err).Msgf("Step failed, retrying in %v seconds, %d retries left...", sleepTime, *retries)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.After(time.Duration(sleepTime) * time.Second):
+		}
+	}
+}
+
+// verifyNodeCount waits until the node pool has the expected number of nodes per zone or the context is done
+func verifyNodeCount(ctx context.Context, c Clock, j Jitter, k KubernetesClient, name string, locations []string, expectedPerZone int64) error {
+	for {
+		zones, err := k.GetZones(name, locations, NodeFilter{})
+
+		if err == nil {
+			actualNodeCount := int64(zones.Sum())
+			expectedNodeCount := expectedPerZone * int64(len(zones))
+
+			log.Info().
+				Str("node-pool", name).
+				Msgf("node pool sizes after resize actual: %d , expected: %d", actualNodeCount, expectedNodeCount)
+
+			if actualNodeCount >= expectedNodeCount {
+				return nil
+			}
+
+			err = fmt.Errorf("node pool %v has %d node(s) after resize, expected %d", name, actualNodeCount, expectedNodeCount)
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-waitSeconds(c, j, operationPollIntervalSecond):
+		}
+	}
+}
+
+// setToSize sets the number of nodes per zone of the pool shifted to: with a single resize of the node pool when all its
+// zones take part in shifts, otherwise zone by zone so the zones left out by the zone filters keep their size and the
+// capacity moved by failovers stays where it was moved to
+func (s *Shifter) setToSize(ctx context.Context, locations []string, size int64) error {
+	name := s.options.NodePoolTo
+	zones := FilterZones(locations, s.options.ZonesInclude, s.options.ZonesExclude)
+
+	if len(zones) == len(locations) && len(s.zoneOffsets) == 0 {
+		return s.to.SetNodePoolSize(ctx, name, size)
+	}
+
+	for _, zone := range zones {
+		zoneSize := size + int64(s.zoneOffsets[zone])
+		if zoneSize < 0 {
+			zoneSize = 0
+		}
+
+		if err := s.to.SetNodePoolZoneSize(ctx, name, zone, zoneSize); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rollbackToSize resets the size of the pool shifted to after a failed shift
+func (s *Shifter) rollbackToSize(ctx context.Context, logger zerolog.Logger, locations []string, size int64) (err error) {
+	name := s.options.NodePoolTo
+
+	logger.Info().
+		Str("node-pool", name).
+		Msgf("Rolling back node pool to %d node(s) per region", size)
+
+	if err = s.setToSize(ctx, locations, size); err != nil {
+		logger.Error().
+			Err(err).
+			Str("node-pool", name).
+			Msg("Error rolling back node pool size")
+	}
+
+	return
+}
@@ -0,0 +1,354 @@
+package shifter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock passes time instantly, recording the waits
+type fakeClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// fixedJitter doesn't deviate
+type fixedJitter struct{}
+
+func (fixedJitter) Apply(input int) int {
+	return input
+}
+
+func TestRetryWithBudget(t *testing.T) {
+	clock := &fakeClock{}
+	retries := 3
+	calls := 0
+
+	err := retryWithBudget(context.Background(), clock, fixedJitter{}, &retries, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("resize failed")
+		}
+		return nil
+	})
+
+	if err != nil || calls != 3 || retries != 1 {
+		t.Errorf("retryWithBudget, expected success after 3 calls with 1 retry left got %v after %d calls with %d retries left", err, calls, retries)
+	}
+
+	if len(clock.waits) != 2 || clock.waits[0] != operationPollIntervalSecond*time.Second {
+		t.Errorf("retryWithBudget, expected 2 waits of %ds got %v", operationPollIntervalSecond, clock.waits)
+	}
+
+	retries = 1
+	err = retryWithBudget(context.Background(), clock, fixedJitter{}, &retries, func() error {
+		return errors.New("resize failed")
+	})
+
+	if err == nil || retries != 0 {
+		t.Errorf("retryWithBudget, expected failure once the budget is spent got %v with %d retries left", err, retries)
+	}
+
+	retries = 3
+	err = retryWithBudget(context.Background(), clock, fixedJitter{}, &retries, func() error {
+		return ErrResizeDeclined
+	})
+
+	if !errors.Is(err, ErrResizeDeclined) || retries != 3 {
+		t.Errorf("retryWithBudget, expected a declined resize not to be retried got %v with %d retries left", err, retries)
+	}
+}
+
+// newShiftFakes returns a cluster where pool-a and pool-b have a node in each of two zones, and the nodes of pool-a
+// selected for removal
+func newShiftFakes() (*fakeKubernetes, *fakeContainer, []Victim) {
+	k := newFakeKubernetes(
+		fakeNode("a-b-1", "pool-a", "europe-west1-b"),
+		fakeNode("a-c-1", "pool-a", "europe-west1-c"),
+		fakeNode("b-b-1", "pool-b", "europe-west1-b"),
+		fakeNode("b-c-1", "pool-b", "europe-west1-c"),
+	)
+
+	g := newFakeContainer(k, map[string][]string{
+		"pool-a": {"europe-west1-b", "europe-west1-c"},
+		"pool-b": {"europe-west1-b", "europe-west1-c"},
+	})
+
+	victims := []Victim{
+		{Node: "a-b-1", Zone: "europe-west1-b", Instance: "a-b-1"},
+		{Node: "a-c-1", Zone: "europe-west1-c", Instance: "a-c-1"},
+	}
+
+	return k, g, victims
+}
+
+func TestShiftNode(t *testing.T) {
+	errFailed := errors.New("failed")
+	floor, _ := ParseCapacityFloor("1", "")
+
+	tests := []struct {
+		name           string
+		options        Options
+		localVolumes   bool
+		kubernetesErrs map[string]error
+		containerErrs  map[string]error
+		reason         string
+		phase          ShiftPhase
+		resizes        []string
+		cordoned       []string
+		uncordoned     []string
+	}{
+		{
+			name:    "shifted",
+			phase:   PhaseDone,
+			resizes: []string{"SetNodePoolSize pool-b 2"},
+		},
+		{
+			name:    "pre-shift hook aborts",
+			options: Options{PreShiftHook: &fakeShiftHook{err: errFailed}, PreShiftHookFailure: HookAbort},
+			reason:  "pre_shift_hook_failed",
+			phase:   PhaseFailed,
+		},
+		{
+			name:          "scale up fails",
+			containerErrs: map[string]error{"SetNodePoolSize pool-b 2": errFailed},
+			reason:        "scale_up_failed",
+			phase:         PhaseRolledBack,
+			resizes:       []string{"SetNodePoolSize pool-b 2", "SetNodePoolSize pool-b 1"},
+		},
+		{
+			name:          "scale up and rollback fail",
+			containerErrs: map[string]error{"SetNodePoolSize pool-b 2": errFailed, "SetNodePoolSize pool-b 1": errFailed},
+			reason:        "scale_up_failed",
+			phase:         PhaseFailed,
+			resizes:       []string{"SetNodePoolSize pool-b 2", "SetNodePoolSize pool-b 1"},
+		},
+		{
+			name:          "scale up declined",
+			containerErrs: map[string]error{"SetNodePoolSize pool-b 2": ErrResizeDeclined},
+			reason:        "declined",
+			phase:         PhaseFailed,
+			resizes:       []string{"SetNodePoolSize pool-b 2"},
+		},
+		{
+			name:           "verify past the deadline",
+			options:        Options{ShiftDeadline: -1},
+			kubernetesErrs: map[string]error{"GetZones pool-b": errFailed},
+			reason:         "deadline_exceeded",
+			phase:          PhaseRolledBack,
+			resizes:        []string{"SetNodePoolSize pool-b 2", "SetNodePoolSize pool-b 1"},
+		},
+		{
+			name:    "capacity floor",
+			options: Options{CapacityFloor: floor},
+			reason:  "capacity_floor",
+			phase:   PhaseRolledBack,
+			resizes: []string{"SetNodePoolSize pool-b 2", "SetNodePoolSize pool-b 1"},
+		},
+		{
+			name:           "drain fails",
+			kubernetesErrs: map[string]error{"SetNodeUnschedulable a-c-1 true": errFailed},
+			reason:         "drain_failed",
+			phase:          PhaseRolledBack,
+			resizes:        []string{"SetNodePoolSize pool-b 2", "SetNodePoolSize pool-b 1"},
+			uncordoned:     []string{"a-b-1", "a-c-1"},
+		},
+		{
+			name:         "pre-drain fails",
+			options:      Options{LocalVolumes: LocalVolumesHook},
+			localVolumes: true,
+			reason:       "pre_drain_failed",
+			phase:        PhaseRolledBack,
+			resizes:      []string{"SetNodePoolSize pool-b 2", "SetNodePoolSize pool-b 1"},
+			uncordoned:   []string{"a-b-1"},
+		},
+		{
+			name:          "scale down fails",
+			containerErrs: map[string]error{"DeleteNodePoolInstances pool-a europe-west1-b [a-b-1]": errFailed},
+			reason:        "scale_down_failed",
+			phase:         PhaseRolledBack,
+			resizes:       []string{"SetNodePoolSize pool-b 2", "SetNodePoolSize pool-b 1"},
+			uncordoned:    []string{"a-b-1", "a-c-1"},
+		},
+		{
+			name:          "scale down fails after removing nodes",
+			containerErrs: map[string]error{"DeleteNodePoolInstances pool-a europe-west1-c [a-c-1]": errFailed},
+			reason:        "scale_down_failed",
+			phase:         PhaseFailed,
+			resizes:       []string{"SetNodePoolSize pool-b 2"},
+			uncordoned:    []string{"a-c-1"},
+		},
+		{
+			name:           "migration keeps nodes cordoned",
+			options:        Options{Migrate: true},
+			kubernetesErrs: map[string]error{"SetNodeUnschedulable a-c-1 true": errFailed},
+			reason:         "drain_failed",
+			phase:          PhaseRolledBack,
+			resizes:        []string{"SetNodePoolSize pool-b 2", "SetNodePoolSize pool-b 1"},
+			cordoned:       []string{"a-b-1"},
+		},
+		{
+			name:    "post-shift hook aborts",
+			options: Options{PostShiftHook: &fakeShiftHook{err: errFailed}, PostShiftHookFailure: HookAbort},
+			reason:  "post_shift_hook_failed",
+			phase:   PhaseFailed,
+			resizes: []string{"SetNodePoolSize pool-b 2"},
+		},
+	}
+
+	for _, test := range tests {
+		k, g, victims := newShiftFakes()
+		k.errs, g.errs = test.kubernetesErrs, test.containerErrs
+		if test.localVolumes {
+			victims[1].LocalVolumes = []LocalVolume{{Pod: "db/db-0", Volume: "local-pv"}}
+		}
+
+		s := newFakeShifter(test.options, k, g)
+		transitions, err := s.shiftNode(g.locations["pool-b"], victims, 1, 1)
+
+		var shiftErr *ShiftError
+		if test.reason == "" && err != nil || test.reason != "" && (!errors.As(err, &shiftErr) || shiftErr.Reason != test.reason) {
+			t.Errorf("%v: expected reason %q got %v", test.name, test.reason, err)
+		}
+
+		if len(transitions) == 0 || transitions[len(transitions)-1].To != test.phase {
+			t.Errorf("%v: expected the shift to end %v got %v", test.name, test.phase, transitions)
+		}
+
+		resizes := []string{}
+		for _, call := range g.calls {
+			if strings.HasPrefix(call, "SetNodePoolSize") {
+				resizes = append(resizes, call)
+			}
+		}
+		if len(resizes) != len(test.resizes) || len(test.resizes) > 0 && !reflect.DeepEqual(resizes, test.resizes) {
+			t.Errorf("%v: expected resizes %v got %v", test.name, test.resizes, resizes)
+		}
+
+		if cordoned := k.unschedulable(); !reflect.DeepEqual(cordoned, test.cordoned) {
+			t.Errorf("%v: expected cordoned nodes %v got %v", test.name, test.cordoned, cordoned)
+		}
+
+		for _, node := range test.uncordoned {
+			if !contains(k.calls, "SetNodeUnschedulable "+node+" false") {
+				t.Errorf("%v: expected node %v to be uncordoned, calls %v", test.name, node, k.calls)
+			}
+		}
+	}
+}
+
+// fakeEvents records the events sent to it
+type fakeEvents struct {
+	events []string
+}
+
+func (f *fakeEvents) Send(event ShiftEvent) error {
+	f.events = append(f.events, event.Event)
+	return nil
+}
+
+func TestShiftEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		events  []string
+	}{
+		{
+			name:   "shifted",
+			events: []string{"planned", "scaled_up", "drained", "scaled_down"},
+		},
+		{
+			name:    "cordon only",
+			options: Options{CordonOnly: true},
+			events:  []string{"planned", "scaled_up", "drained", "completed"},
+		},
+	}
+
+	for _, test := range tests {
+		k, g, victims := newShiftFakes()
+		events := &fakeEvents{}
+		test.options.Events = events
+
+		s := newFakeShifter(test.options, k, g)
+		if _, err := s.shiftNode(g.locations["pool-b"], victims, 1, 1); err != nil {
+			t.Errorf("%v: expected no error got %v", test.name, err)
+		}
+
+		if !reflect.DeepEqual(events.events, test.events) {
+			t.Errorf("%v: expected events %v got %v", test.name, test.events, events.events)
+		}
+	}
+}
+
+func TestRecoverShift(t *testing.T) {
+	tests := []struct {
+		name        string
+		record      *ShiftRecord
+		phase       ShiftPhase
+		resizes     []string
+		uncordoned  bool
+		transitions int
+	}{
+		{"no shift persisted", nil, "", nil, false, 0},
+		{"shift finished", &ShiftRecord{Phase: PhaseDone, NodePoolFrom: "pool-a", NodePoolTo: "pool-b"}, PhaseDone, nil, false, 0},
+		{"shift of other node pools", &ShiftRecord{Phase: PhaseDraining, NodePoolFrom: "pool-c", NodePoolTo: "pool-b"}, PhaseDraining, nil, false, 0},
+		{"interrupted planning", &ShiftRecord{Phase: PhasePlanned, NodePoolFrom: "pool-a", NodePoolTo: "pool-b", ToSize: 1, Victims: []string{"a-b-1"}}, PhaseFailed, nil, false, 1},
+		{"interrupted drain", &ShiftRecord{Phase: PhaseDraining, NodePoolFrom: "pool-a", NodePoolTo: "pool-b", ToSize: 1, Victims: []string{"a-b-1"}}, PhaseRolledBack, []string{"SetNodePoolSize pool-b 1"}, true, 1},
+		{"interrupted scale down", &ShiftRecord{Phase: PhaseScalingDown, NodePoolFrom: "pool-a", NodePoolTo: "pool-b", ToSize: 1, Victims: []string{"a-b-1"}}, PhaseFailed, nil, true, 1},
+	}
+
+	for _, test := range tests {
+		k, g, _ := newShiftFakes()
+		s := newFakeShifter(Options{StateConfigMap: "state"}, k, g)
+
+		if test.record != nil {
+			if err := persistShiftRecord(k, "state", *test.record); err != nil {
+				t.Fatalf("%v: persisting the shift, expected no error got %v", test.name, err)
+			}
+		}
+		g.calls = nil
+
+		transitions, err := s.recoverShift()
+		if err != nil || len(transitions) != test.transitions {
+			t.Errorf("%v: expected %d transition(s) got %v %v", test.name, test.transitions, transitions, err)
+		}
+
+		record, _ := loadShiftRecord(k, "state")
+		if record != nil && record.Phase != test.phase || record == nil && test.record != nil {
+			t.Errorf("%v: expected the persisted shift in phase %v got %v", test.name, test.phase, record)
+		}
+		if test.transitions > 0 && record.Reason != "interrupted" {
+			t.Errorf("%v: expected the shift to fail as interrupted got %q", test.name, record.Reason)
+		}
+
+		resizes := []string{}
+		for _, call := range g.calls {
+			if strings.HasPrefix(call, "SetNodePoolSize") {
+				resizes = append(resizes, call)
+			}
+		}
+		if len(resizes) != len(test.resizes) || len(test.resizes) > 0 && !reflect.DeepEqual(resizes, test.resizes) {
+			t.Errorf("%v: expected resizes %v got %v", test.name, test.resizes, resizes)
+		}
+
+		if uncordoned := contains(k.calls, "SetNodeUnschedulable a-b-1 false"); uncordoned != test.uncordoned {
+			t.Errorf("%v: expected node a-b-1 uncordoned %v got %v", test.name, test.uncordoned, uncordoned)
+		}
+	}
+}
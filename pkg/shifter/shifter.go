@@ -0,0 +1,1298 @@
+// Package shifter implements the decision and shift logic of the node pool shifter: every cycle it checks whether a
+// node can be moved from one GKE node pool to another and safely shifts it, so other controllers can embed the
+// behavior with their own clients.
+package shifter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	foundation "github.com/estafette/estafette-foundation"
+	"github.com/rs/zerolog/log"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// KubernetesClient is the part of the Kubernetes API the shifter needs
+type KubernetesClient interface {
+	GetNodeList(string) (*v1.NodeList, error)
+	GetZones(string, []string, NodeFilter) (ZoneStats, error)
+	GetAutoscalerStatus() (string, error)
+	GetConfigMap(string) (*v1.ConfigMap, error)
+	UpsertConfigMap(*v1.ConfigMap) error
+	GetPodsOnNode(string) (*v1.PodList, error)
+	GetPods(string, string) (*v1.PodList, error)
+	GetHorizontalPodAutoscalers(string) (*autoscalingv1.HorizontalPodAutoscalerList, error)
+	SetNodeUnschedulable(string, bool) error
+	SetNodeLabels(string, map[string]string) error
+	SetNodeAnnotations(string, map[string]string) error // an empty value removes the annotation
+	EvictPod(v1.Pod) error
+	GetPersistentVolumes() (*v1.PersistentVolumeList, error)
+	CreatePod(*v1.Pod) (*v1.Pod, error)
+	GetPod(string) (*v1.Pod, error)
+	DeletePod(string) error
+}
+
+// ContainerClient is the part of the GKE API the shifter needs to manage a node pool
+type ContainerClient interface {
+	GetNodePoolLocations(string) ([]string, error)
+	GetNodePoolInstanceGroupURLs(string) ([]string, error)
+	GetPendingResizeOperation(string) (string, error)
+	GetMaintenanceExclusions() ([]MaintenanceExclusion, error)
+	GetNodePoolTargetSizes(string) (map[string]int, error)
+	SetNodePoolSize(context.Context, string, int64) error
+	SetNodePoolZoneSize(context.Context, string, string, int64) error
+	DeleteNodePoolInstances(context.Context, string, string, []string) error
+	DeleteNodePool(context.Context, string) error
+}
+
+// CloudClient is the part of the GCE API the shifter needs
+type CloudClient interface {
+	CountPreemptions(string, []string, time.Time) (int, error)
+}
+
+// Options configures a Shifter, times are in second
+type Options struct {
+	Cluster             string
+	NodePoolFrom        string
+	NodePoolTo          string
+	NodePoolFromMinNode int
+
+	// MinOnDemandFraction is the fraction of the capacity of the cluster the node pool shifted from keeps at least,
+	// raising NodePoolFromMinNode as the cluster grows; 0 disables it
+	MinOnDemandFraction float64
+	ZonesInclude        []string
+	ZonesExclude        []string
+
+	// CapacityFloor is the Ready allocatable capacity of the cluster no removal takes it below, independently of the
+	// minimum of the node pool shifted from
+	CapacityFloor CapacityFloor
+
+	// NodeFilter restricts the nodes of the node pool shifted from counted and selected for removal, all nodes take part
+	// when empty
+	NodeFilter NodeFilter
+	Interval   int
+	CycleTime  int
+
+	// AdaptiveInterval shortens the interval down to AdaptiveMinInterval while the node pool shifted from is far above
+	// its minimum, reaching it AdaptiveDistance nodes per zone above the minimum
+	AdaptiveInterval             bool
+	AdaptiveMinInterval          int
+	AdaptiveDistance             int
+	RespectAutoscalerStatus      bool
+	RespectMaintenanceExclusions bool
+	HPANamespaces                []string
+
+	// NodeAutoprovisioning is set when GKE creates node pools on its own; ConfiguredPoolsOnly then restricts the
+	// capacity of the cluster to the nodes of the node pools shifted from and to
+	NodeAutoprovisioning    bool
+	ConfiguredPoolsOnly     bool
+	PreemptionRateThreshold int
+	PreemptionRateWindow    int
+	BounceWindow            int
+	BounceCooldown          int
+	ShiftDeadline           int
+	ShiftRetries            int
+	BatchSize               int
+	WarmUpPeriod            int
+	ProvisioningTimeout     int
+	ReconcileTargetSize     bool
+
+	// Migrate moves all nodes off the node pool shifted from, cordoning it as a whole and waiting for the workloads to
+	// be scheduled again between steps; DeleteMigratedPool deletes that node pool once it's empty
+	Migrate            bool
+	DeleteMigratedPool bool
+
+	// WorkloadAffinityAnalysis limits shifts to the share of the workload whose node selectors, affinities and
+	// tolerations fit the node pool shifted to
+	WorkloadAffinityAnalysis bool
+
+	// CordonOnly leaves drained nodes cordoned for the cluster-autoscaler to remove instead of deleting them
+	CordonOnly         bool
+	AffinityAwareDrain bool
+
+	// DrainObserver follows the progress of drains when set
+	DrainObserver DrainObserver
+
+	// NamespaceEvictionLimit caps the pods of a namespace evicted at once while draining, 0 for no limit
+	NamespaceEvictionLimit int
+	ForceBarePods          bool
+
+	// MaxPodsDisrupted caps the pods a shift evicts, nodes with less impact are removed instead or the shift is
+	// deferred to a later cycle; 0 for no limit
+	MaxPodsDisrupted int
+
+	// LocalVolumes decides what happens to nodes whose pods use local volumes, skipped when empty; PreDrainHook is
+	// called before draining them when handled by a hook
+	LocalVolumes LocalVolumeHandling
+	PreDrainHook PreDrainHook
+
+	// PreemptibleKillerCoordination avoids racing estafette-gke-preemptible-killer over the nodes of the pool shifted to
+	PreemptibleKillerCoordination bool
+	PreemptibleKillerWindow       int
+
+	// CanaryProbe runs a canary pod on the node pool shifted to after each shift, which has to be running within
+	// CanaryTimeout; with CanaryBreaker a failing probe pauses shifting until the probe passes again
+	CanaryProbe   bool
+	CanaryImage   string
+	CanaryTimeout int
+	CanaryBreaker bool
+
+	// TargetProfile holds the labels and taints the nodes of the pool shifted to are expected to carry
+	TargetProfile     NodeProfile
+	RequireApproval   bool
+	ApprovalConfigMap string
+
+	// Policy has to allow each shift when set
+	Policy PolicyHook
+
+	// PreShiftHook runs before the node pool shifted to is scaled up and PostShiftHook after the node pool shifted from
+	// is scaled down, when set; their failure policies default to continue
+	PreShiftHook         ShiftHook
+	PreShiftHookFailure  HookFailurePolicy
+	PostShiftHook        ShiftHook
+	PostShiftHookFailure HookFailurePolicy
+
+	// StateConfigMap receives the phase of the current or last shift when set
+	StateConfigMap string
+
+	// Events receives the lifecycle events of shifts when set
+	Events EventSink
+
+	// NodeName, PodName and PodNamespace locate the shifter itself, so it never removes the node it runs on
+	NodeName     string
+	PodName      string
+	PodNamespace string
+
+	// PlanOutput receives the plan before each shift when set, e.g. for interactive use
+	PlanOutput io.Writer
+
+	// Clock and Jitter default to the wall clock and a random jitter, tests inject deterministic ones
+	Clock  Clock
+	Jitter Jitter
+}
+
+// Shifter shifts nodes from one node pool to another, one cycle at a time
+type Shifter struct {
+	options    Options
+	cloud      CloudClient
+	from       ContainerClient
+	to         ContainerClient
+	kubernetes KubernetesClient
+
+	// detects shifts undone by the cluster-autoscaler and pauses shifting after them
+	bounceTracker *BounceTracker
+	cooldownUntil time.Time
+
+	// size per zone the last shift left the node pool shifted to at, and since when
+	desiredToSize int
+	desiredSince  time.Time
+
+	// the most recent operations started by shifts
+	operations *OperationIndex
+
+	// set while the node pool shifted from has no nodes, e.g. after the cluster-autoscaler scaled it away
+	sourceEmpty bool
+
+	// set while the canary probe fails and the circuit breaker pauses shifting
+	canaryFailing bool
+
+	// set once a migration is complete, the node pool migrated from might not exist anymore
+	migrated bool
+
+	// set once a shift interrupted by a restart has been looked for in the state ConfigMap
+	recovered bool
+
+	// zones of the node pool shifted to that failed to provision nodes in time, by time of the failure
+	unreliableZones map[string]time.Time
+
+	// nodes moved per zone of the node pool shifted to by failovers, relative to the same size in every zone; kept
+	// until no zone is unreliable anymore so the next shifts don't put the capacity back into an unreliable zone
+	zoneOffsets map[string]int
+
+	clock  Clock
+	jitter Jitter
+}
+
+// CycleState holds the state computed during a single cycle, logged in debug mode to diagnose shift decisions
+type CycleState struct {
+	LocationsFrom           []string                    `json:"locationsFrom"`
+	LocationsTo             []string                    `json:"locationsTo"`
+	ZonesFrom               ZoneStats                   `json:"zonesFrom"`
+	ZonesTo                 ZoneStats                   `json:"zonesTo"`
+	PoolSizes               []PoolZoneSize              `json:"poolSizes"`
+	Interval                int                         `json:"interval"`
+	CapacityNodes           int                         `json:"capacityNodes,omitempty"`
+	AutoProvisionedPools    []string                    `json:"autoProvisionedPools,omitempty"`
+	NodePoolFromSize        int                         `json:"nodePoolFromSize"`
+	NodePoolFromMinNode     int                         `json:"nodePoolFromMinNode"`
+	RespectAutoscalerStatus bool                        `json:"respectAutoscalerStatus"`
+	Preemptions             int                         `json:"preemptions"`
+	PreemptionRateThreshold int                         `json:"preemptionRateThreshold"`
+	AutoscalerNodeGroups    []AutoscalerNodeGroupStatus `json:"autoscalerNodeGroups"`
+	SharedZones             []string                    `json:"sharedZones"`
+	ScaleDownCandidates     []string                    `json:"scaleDownCandidates"`
+	ScalingUpHPAs           []string                    `json:"scalingUpHPAs,omitempty"`
+	MaintenanceExclusion    *MaintenanceExclusion       `json:"maintenanceExclusion,omitempty"`
+	Bounced                 bool                        `json:"bounced"`
+	CanaryHealthy           *bool                       `json:"canaryHealthy,omitempty"`
+	WorkloadFit             *WorkloadFit                `json:"workloadFit,omitempty"`
+	Victims                 []Victim                    `json:"victims"`
+	Disruption              *Disruption                 `json:"disruption,omitempty"`
+	BlockedNodes            []BlockedNode               `json:"blockedNodes,omitempty"`
+	Transitions             []ShiftTransition           `json:"transitions,omitempty"`
+	UnreliableZones         []string                    `json:"unreliableZones,omitempty"`
+	ReconciledNodes         int                         `json:"reconciledNodes,omitempty"`
+	SkipReason              string                      `json:"skipReason,omitempty"`
+	Decision                string                      `json:"decision"`
+}
+
+// convergedReasons are the skip reasons of a cycle finding the node pool shifted from at its target state: at its
+// minimum, without nodes, or migrated
+var convergedReasons = map[string]bool{
+	"at_minimum":   true,
+	"empty_source": true,
+	"migrated":     true,
+}
+
+// Converged returns true if the cycle found the node pool shifted from at its target state and the node pool shifted
+// to healthy, with all its nodes Ready and the last canary probe, if any, passing
+func (c *CycleState) Converged() bool {
+	if !convergedReasons[c.SkipReason] {
+		return false
+	}
+
+	if c.CanaryHealthy != nil && !*c.CanaryHealthy {
+		return false
+	}
+
+	return c.ZonesTo.ReadySum() == c.ZonesTo.Sum()
+}
+
+// New returns a Shifter moving nodes from the node pool managed by from to the one managed by to, both clients can be
+// the same when both node pools are in the same cluster
+func New(options Options, cloud CloudClient, from, to ContainerClient, kubernetes KubernetesClient) *Shifter {
+	if options.BatchSize < 1 {
+		options.BatchSize = 1
+	}
+
+	// a migration empties the node pool shifted from
+	if options.Migrate {
+		options.NodePoolFromMinNode = 0
+		options.MinOnDemandFraction = 0
+	}
+
+	if options.DrainObserver == nil {
+		options.DrainObserver = nopDrainObserver{}
+	}
+	if options.LocalVolumes == "" {
+		options.LocalVolumes = LocalVolumesSkip
+	}
+	if options.CanaryImage == "" {
+		options.CanaryImage = DefaultCanaryImage
+	}
+	if options.Clock == nil {
+		options.Clock = realClock{}
+	}
+	if options.Jitter == nil {
+		options.Jitter = NewPercentJitter(DefaultJitterPercent, time.Now().UnixNano())
+	}
+
+	return &Shifter{
+		options:    options,
+		cloud:      cloud,
+		from:       from,
+		to:         to,
+		kubernetes: kubernetes,
+		bounceTracker: &BounceTracker{
+			Window: time.Duration(options.BounceWindow) * time.Second,
+		},
+		unreliableZones: map[string]time.Time{},
+		zoneOffsets:     map[string]int{},
+		operations:      &OperationIndex{},
+		clock:           options.Clock,
+		jitter:          options.Jitter,
+	}
+}
+
+// Operations returns the most recent operations started by shifts, the most recent first
+func (s *Shifter) Operations() []Operation {
+	return s.operations.List()
+}
+
+// RunCycle checks whether a node can be shifted and shifts it, it returns the status of the cycle, the time to sleep
+// before the next one and the state the decision was based on
+func (s *Shifter) RunCycle() (status string, sleepTime time.Duration, state *CycleState) {
+	state = &CycleState{
+		Interval:                s.options.Interval,
+		NodePoolFromMinNode:     s.options.NodePoolFromMinNode,
+		RespectAutoscalerStatus: s.options.RespectAutoscalerStatus,
+		PreemptionRateThreshold: s.options.PreemptionRateThreshold,
+	}
+
+	status, sleepTime = s.runCycle(state)
+	state.UnreliableZones = s.UnreliableZones()
+
+	// a migration keeps the whole node pool cordoned
+	if !s.options.Migrate {
+		s.releaseSelfCordon()
+	}
+
+	return
+}
+
+func (s *Shifter) runCycle(state *CycleState) (status string, sleepTime time.Duration) {
+	nodePoolFrom, nodePoolTo := s.options.NodePoolFrom, s.options.NodePoolTo
+	gFrom, gTo, k := s.from, s.to, s.kubernetes
+
+	// interval between each process
+	sleepTime = time.Duration(s.jitter.Apply(s.options.Interval)) * time.Second
+
+	if s.migrated {
+		state.SkipReason = "migrated"
+		state.Decision = "migration complete"
+		return "skipped", sleepTime
+	}
+
+	if !s.recovered && s.options.StateConfigMap != "" {
+		transitions, err := s.recoverShift()
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("configmap", s.options.StateConfigMap).
+				Msg("Error while recovering an interrupted shift")
+
+			state.Decision = "error recovering interrupted shift"
+			return "failed", sleepTime
+		}
+
+		if err := s.loadZoneOffsets(); err != nil {
+			log.Warn().
+				Err(err).
+				Str("configmap", s.options.StateConfigMap).
+				Msg("Error loading the capacity moved by failovers, the next shift spreads the node pool evenly")
+		}
+
+		if err := s.loadDesiredToSize(); err != nil {
+			log.Warn().
+				Err(err).
+				Str("configmap", s.options.StateConfigMap).
+				Msg("Error loading the size to reconcile the node pool to, it's left as is until the next shift")
+		}
+
+		s.recovered = true
+		state.Transitions = transitions
+	}
+
+	// the node pool locations are authoritative, a zone temporarily without nodes still counts
+	locationsFrom, err := gFrom.GetNodePoolLocations(nodePoolFrom)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("node-pool", nodePoolFrom).
+			Msg("Error while getting node pool locations")
+
+		state.Decision = "error getting locations of node pool to shift from"
+		return "failed", sleepTime
+	}
+
+	locationsTo, err := gTo.GetNodePoolLocations(nodePoolTo)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("node-pool", nodePoolTo).
+			Msg("Error while getting node pool locations")
+
+		state.Decision = "error getting locations of node pool to shift to"
+		return "failed", sleepTime
+	}
+
+	state.LocationsFrom = locationsFrom
+	state.LocationsTo = locationsTo
+
+	zonesFrom, err := k.GetZones(nodePoolFrom, locationsFrom, s.options.NodeFilter)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("node-pool", nodePoolFrom).
+			Msg("Error while determining zones")
+
+		state.Decision = "error determining zones of node pool to shift from"
+		return "failed", sleepTime
+	}
+
+	state.ZonesFrom = zonesFrom
+
+	// the node pool shifted to is resized as a whole, so all its nodes count
+	zonesTo, err := k.GetZones(nodePoolTo, locationsTo, NodeFilter{})
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("node-pool", nodePoolTo).
+			Msg("Error while determining zones")
+
+		state.Decision = "error determining zones of node pool to shift to"
+		return "failed", sleepTime
+	}
+
+	state.ZonesTo = zonesTo
+
+	// observed for monitoring only, failing to do so doesn't fail the cycle
+	for _, pool := range []struct {
+		client    ContainerClient
+		name      string
+		locations []string
+		zones     ZoneStats
+	}{{gFrom, nodePoolFrom, locationsFrom, zonesFrom}, {gTo, nodePoolTo, locationsTo, zonesTo}} {
+		sizes, err := s.observePoolSizes(pool.client, pool.name, pool.locations)
+
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("node-pool", pool.name).
+				Msg("Error while observing node pool sizes")
+			continue
+		}
+
+		state.PoolSizes = append(state.PoolSizes, sizes...)
+
+		for _, size := range sizes {
+			pool.zones.SetTargetSize(size.Zone, size.Target)
+		}
+	}
+
+	// node auto-provisioning creates pools the shifter doesn't manage, which can absorb evicted workloads unexpectedly
+	if s.options.NodeAutoprovisioning {
+		nodes, err := s.capacityNodes()
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error while listing nodes")
+
+			state.Decision = "error listing nodes of the cluster"
+			return "failed", sleepTime
+		}
+
+		state.CapacityNodes = len(nodes)
+
+		if pools := FindAutoProvisionedPools(nodes); len(pools) > 0 {
+			log.Warn().
+				Strs("node-pools", pools).
+				Msg("Node auto-provisioning created node pools, evicted pods may land on them instead of the node pool shifted to")
+
+			state.AutoProvisionedPools = pools
+		}
+	}
+
+	if len(zonesFrom) == 0 || len(zonesTo) == 0 {
+		log.Warn().
+			Str("node-pool-from", nodePoolFrom).
+			Str("node-pool-to", nodePoolTo).
+			Msg("No zone left to shift in after applying zone filters")
+
+		state.SkipReason = "no_zone"
+		state.Decision = "no zone left after applying zone filters"
+		return "skipped", sleepTime
+	}
+
+	// capacity lost to preemptions is restored whatever the state of the node pool shifted from; the sizes known to
+	// this cycle are outdated then, shifting waits for the next one
+	if s.options.ReconcileTargetSize && s.reconcile(locationsTo, zonesTo, state) {
+		state.Decision = fmt.Sprintf("topped up node pool to shift to with %d node(s) per region", state.ReconciledNodes)
+		return "reconciled", time.Duration(s.jitter.Apply(s.options.CycleTime)) * time.Second
+	}
+
+	if s.options.Migrate {
+		if status, done := s.migrate(zonesFrom, state); done {
+			return status, sleepTime
+		}
+	}
+
+	// there's nothing to shift until the node pool grows again, which the following cycles keep checking for
+	if zonesFrom.Sum() == 0 {
+		if !s.sourceEmpty {
+			log.Info().
+				Str("node-pool", nodePoolFrom).
+				Msg("Node pool has no nodes, nothing to shift until it grows again")
+		}
+		s.sourceEmpty = true
+
+		state.SkipReason = "empty_source"
+		state.Decision = "node pool to shift from has no nodes"
+		return "empty", sleepTime
+	}
+
+	if s.sourceEmpty {
+		log.Info().
+			Str("node-pool", nodePoolFrom).
+			Msgf("Node pool grew again to %d node(s)", zonesFrom.Sum())
+	}
+	s.sourceEmpty = false
+
+	if s.options.RespectAutoscalerStatus {
+		autoscalerStatus, err := k.GetAutoscalerStatus()
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error while getting the cluster-autoscaler status")
+
+			state.Decision = "error getting cluster-autoscaler status"
+			return "failed", sleepTime
+		}
+
+		state.AutoscalerNodeGroups = ParseAutoscalerStatus(autoscalerStatus)
+
+		groupsFrom, err := gFrom.GetNodePoolInstanceGroupURLs(nodePoolFrom)
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("node-pool", nodePoolFrom).
+				Msg("Error while getting node pool instance groups")
+
+			state.Decision = "error getting instance groups of node pool to shift from"
+			return "failed", sleepTime
+		}
+
+		groupsTo, err := gTo.GetNodePoolInstanceGroupURLs(nodePoolTo)
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("node-pool", nodePoolTo).
+				Msg("Error while getting node pool instance groups")
+
+			state.Decision = "error getting instance groups of node pool to shift to"
+			return "failed", sleepTime
+		}
+
+		nodePools := map[string][]string{nodePoolFrom: groupsFrom, nodePoolTo: groupsTo}
+
+		if name, scaling := FindScalingNodePool(autoscalerStatus, nodePools); scaling {
+			log.Info().
+				Str("node-pool", name).
+				Msg("Cluster-autoscaler is scaling the node pool, skipping shift")
+
+			state.SkipReason = "autoscaler"
+			state.Decision = "cluster-autoscaler is scaling " + name
+			return "skipped", sleepTime
+		}
+	}
+
+	// nodes the cluster-autoscaler marked for scale down are about to go anyway, removing more would remove capacity
+	// twice; let the autoscaler finish and re-evaluate next cycle
+	nodesFrom, err := k.GetNodeList(nodePoolFrom)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("node-pool", nodePoolFrom).
+			Msg("Error while listing nodes")
+
+		state.Decision = "error listing nodes of node pool to shift from"
+		return "failed", sleepTime
+	}
+
+	if candidates := FindScaleDownCandidates(nodesFrom.Items); len(candidates) > 0 {
+		log.Info().
+			Str("node-pool", nodePoolFrom).
+			Strs("nodes", candidates).
+			Msg("Cluster-autoscaler marked nodes for scale down, skipping shift")
+
+		state.ScaleDownCandidates = candidates
+		state.SkipReason = "autoscaler"
+		state.Decision = "cluster-autoscaler is scaling down " + nodePoolFrom
+		return "skipped", sleepTime
+	}
+
+	// removing capacity during a traffic ramp amplifies latency spikes, let the HorizontalPodAutoscalers catch up first
+	for _, namespace := range s.options.HPANamespaces {
+		hpas, err := k.GetHorizontalPodAutoscalers(namespace)
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("namespace", namespace).
+				Msg("Error while listing HorizontalPodAutoscalers")
+
+			state.Decision = "error listing HorizontalPodAutoscalers"
+			return "failed", sleepTime
+		}
+
+		if scaling := FindScalingUpHPAs(hpas.Items); len(scaling) > 0 {
+			log.Info().
+				Str("namespace", namespace).
+				Strs("hpas", scaling).
+				Msg("HorizontalPodAutoscalers are scaling up, skipping shift")
+
+			state.ScalingUpHPAs = scaling
+			state.SkipReason = "hpa_scaling"
+			state.Decision = "HorizontalPodAutoscalers are scaling up in " + namespace
+			return "skipped", sleepTime
+		}
+	}
+
+	// a maintenance exclusion, e.g. a retail freeze period, also freezes shifting
+	if s.options.RespectMaintenanceExclusions {
+		for _, pool := range []struct {
+			client ContainerClient
+			name   string
+		}{{gFrom, nodePoolFrom}, {gTo, nodePoolTo}} {
+			exclusions, err := pool.client.GetMaintenanceExclusions()
+
+			if err != nil {
+				log.Error().
+					Err(err).
+					Str("node-pool", pool.name).
+					Msg("Error while getting the maintenance exclusions of the cluster")
+
+				state.Decision = "error getting maintenance exclusions"
+				return "failed", sleepTime
+			}
+
+			if exclusion, active := FindActiveMaintenanceExclusion(exclusions, s.clock.Now()); active {
+				log.Info().
+					Str("node-pool", pool.name).
+					Str("exclusion", exclusion.Name).
+					Msgf("Maintenance exclusion is active until %v, skipping shift", exclusion.End)
+
+				state.MaintenanceExclusion = &exclusion
+				state.SkipReason = "maintenance_exclusion"
+				state.Decision = "maintenance exclusion " + exclusion.Name + " is active"
+				return "skipped", sleepTime
+			}
+		}
+	}
+
+	// avoid moving workloads onto capacity that is being reclaimed constantly
+	if s.options.PreemptionRateThreshold > 0 {
+		since := s.clock.Now().Add(-time.Duration(s.options.PreemptionRateWindow) * time.Second)
+		preemptions, err := s.cloud.CountPreemptions(nodePoolTo, locationsTo, since)
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("node-pool", nodePoolTo).
+				Msg("Error while counting preemptions")
+
+			state.Decision = "error counting preemptions"
+			return "failed", sleepTime
+		}
+
+		state.Preemptions = preemptions
+
+		if preemptions >= s.options.PreemptionRateThreshold {
+			log.Info().
+				Str("node-pool", nodePoolTo).
+				Msgf("Node pool had %d preemption(s) in the last %d seconds, pausing shifting until it stabilizes", preemptions, s.options.PreemptionRateWindow)
+
+			state.SkipReason = "preemption_rate"
+			state.Decision = "preemption rate above threshold"
+			return "skipped", sleepTime
+		}
+	}
+
+	if s.bounceTracker.Check(s.clock.Now(), zonesFrom.Sum()) {
+		log.Warn().
+			Str("node-pool", nodePoolFrom).
+			Msgf("Node pool grew again within %d seconds after the last shift, the shift bounced", s.options.BounceWindow)
+
+		state.Bounced = true
+
+		if s.options.BounceCooldown > 0 {
+			s.cooldownUntil = s.clock.Now().Add(time.Duration(s.options.BounceCooldown) * time.Second)
+		}
+	}
+
+	if s.clock.Now().Before(s.cooldownUntil) {
+		log.Info().
+			Str("node-pool", nodePoolFrom).
+			Msgf("Pausing shifting until %v after a bounce", s.cooldownUntil.Format(time.RFC3339))
+
+		state.SkipReason = "cooldown"
+		state.Decision = "cooldown after bounce"
+		return "skipped", sleepTime
+	}
+
+	// the circuit breaker stays open until a canary pod runs on the node pool shifted to again
+	if s.canaryFailing {
+		if !s.runCanaryProbe(state) {
+			state.SkipReason = "canary_failed"
+			state.Decision = "canary pod doesn't run on node pool to shift to"
+			return "skipped", sleepTime
+		}
+
+		log.Info().
+			Str("node-pool", nodePoolTo).
+			Msg("Canary probe passes again, resuming shifting")
+	}
+
+	nodePoolFromSize := zonesFrom.Sum() / len(zonesFrom)
+	state.NodePoolFromSize = nodePoolFromSize
+
+	// the floor given as a fraction follows the size of the cluster, the larger of both floors applies
+	minNode := s.options.NodePoolFromMinNode
+
+	if s.options.MinOnDemandFraction > 0 {
+		nodes, err := s.capacityNodes()
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error while listing nodes")
+
+			state.Decision = "error listing nodes of the cluster"
+			return "failed", sleepTime
+		}
+
+		state.CapacityNodes = len(nodes)
+
+		if fractionMin := minNodesForFraction(s.options.MinOnDemandFraction, len(nodes), len(zonesFrom)); fractionMin > minNode {
+			minNode = fractionMin
+		}
+	}
+
+	state.NodePoolFromMinNode = minNode
+
+	// the further the node pool is from its minimum, the more often it's worth checking
+	if s.options.AdaptiveInterval {
+		state.Interval = AdaptiveInterval(s.options.AdaptiveMinInterval, s.options.Interval, nodePoolFromSize-minNode, s.options.AdaptiveDistance)
+		sleepTime = time.Duration(s.jitter.Apply(state.Interval)) * time.Second
+	}
+
+	log.Info().
+		Str("node-pool", nodePoolFrom).
+		Msgf("Node pool has %d node(s) per region, minimun wanted: %d node(s)", nodePoolFromSize, minNode)
+
+	// TODO remove nodePoolFromMinNode, use value from node pool autoscaling setting (min node) instead
+	// a migration carries on while any zone has nodes left, the zones are checked one by one below
+	if !s.options.Migrate && nodePoolFromSize <= minNode {
+		state.SkipReason = "at_minimum"
+		state.Decision = "node pool to shift from is at its minimum size"
+		return "skipped", sleepTime
+	}
+
+	// This computes the maximum number of the preemptible node pool to scale
+	maxTo := s.withoutOffsets(zonesTo).Max()
+
+	// the pool shifted to only grows in its own zones, so nodes are only removed in the zones both pools share: pods
+	// bound to another zone, e.g. by a zonal volume, couldn't move and the capacity removed would exceed the one added
+	zoneNamesFrom := FilterZones(locationsFrom, s.options.ZonesInclude, s.options.ZonesExclude)
+	sharedZones := IntersectZones(zoneNamesFrom, FilterZones(locationsTo, s.options.ZonesInclude, s.options.ZonesExclude))
+	state.SharedZones = sharedZones
+
+	if len(sharedZones) == 0 {
+		log.Warn().
+			Str("node-pool-from", nodePoolFrom).
+			Str("node-pool-to", nodePoolTo).
+			Msg("The node pools don't share any zone, shifting is impossible")
+
+		state.SkipReason = "no_shared_zone"
+		state.Decision = "no zone shared by both node pools"
+		return "skipped", sleepTime
+	}
+
+	if len(sharedZones) < len(zoneNamesFrom) {
+		log.Info().
+			Str("node-pool", nodePoolFrom).
+			Strs("shared-zones", sharedZones).
+			Msg("The node pools only share some zones, nodes in the other zones are kept")
+	}
+
+	// select up to a batch of nodes to remove in each shared zone of the vm node pool, without going below its minimum;
+	// the pool shifted to grows by the largest batch so a single resize covers all zones
+	victimZones := []string{}
+	victimCounts := map[string]int{}
+	zoneSizes := map[string]int{}
+	batchSize := 0
+
+	for _, zone := range zoneNamesFrom {
+		if !foundation.StringArrayContains(sharedZones, zone) {
+			continue
+		}
+
+		zoneSizes[zone] = zonesFrom[zone].Total
+
+		count := zonesFrom[zone].Total - minNode
+		if count > s.options.BatchSize {
+			count = s.options.BatchSize
+		}
+
+		if count > 0 {
+			victimZones = append(victimZones, zone)
+			victimCounts[zone] = count
+		}
+
+		if count > batchSize {
+			batchSize = count
+		}
+	}
+
+	if len(victimZones) == 0 {
+		state.SkipReason = "at_minimum"
+		state.Decision = "node pool to shift from is at its minimum size in all shared zones"
+		return "skipped", sleepTime
+	}
+
+	// evicted pods have to be able to run on the node pool shifted to, otherwise drains just push them back
+	nodesTo, err := k.GetNodeList(nodePoolTo)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("node-pool", nodePoolTo).
+			Msg("Error while listing nodes")
+
+		state.Decision = "error listing nodes of node pool to shift to"
+		return "failed", sleepTime
+	}
+
+	for _, node := range nodesTo.Items {
+		if mismatches := FindProfileMismatches(node, s.options.TargetProfile); len(mismatches) > 0 {
+			log.Warn().
+				Str("node-pool", nodePoolTo).
+				Str("node", node.Name).
+				Strs("missing", mismatches).
+				Msg("Node pool doesn't carry the expected labels and taints, refusing to shift")
+
+			state.SkipReason = "target_mismatch"
+			state.Decision = "node pool to shift to doesn't carry the expected labels and taints"
+			return "skipped", sleepTime
+		}
+	}
+
+	// nodes the preemptible killer is about to delete don't make up for the removed ones
+	if s.options.PreemptibleKillerCoordination {
+		expiring := FindNodesExpiringSoon(nodesTo.Items, s.clock.Now(), time.Duration(s.options.PreemptibleKillerWindow)*time.Second)
+
+		if len(expiring) > 0 {
+			log.Info().
+				Str("node-pool", nodePoolTo).
+				Strs("nodes", expiring).
+				Msg("Nodes are about to be deleted by the preemptible killer, waiting for them to be replaced")
+
+			state.SkipReason = "preemptible_killer"
+			state.Decision = "nodes of node pool to shift to are about to be deleted by the preemptible killer"
+			return "skipped", sleepTime
+		}
+	}
+
+	// without any node yet, the expected labels and taints are all we know of the node pool shifted to
+	targetProfile := s.options.TargetProfile
+	if len(nodesTo.Items) > 0 {
+		targetProfile = NodeProfile{
+			Labels: nodesTo.Items[0].Labels,
+			Taints: nodesTo.Items[0].Spec.Taints,
+		}
+	}
+
+	// workloads that can't run on the node pool shifted to would only be pushed back, shift what can actually move
+	if s.options.WorkloadAffinityAnalysis {
+		fit, err := s.analyzeWorkloadFit(targetProfile)
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("node-pool", nodePoolFrom).
+				Msg("Error while analyzing the workloads of the node pool")
+
+			state.Decision = "error analyzing workloads of node pool to shift from"
+			return "failed", sleepTime
+		}
+
+		state.WorkloadFit = &fit
+
+		if fit.Ratio() < 1 {
+			log.Warn().
+				Str("node-pool", nodePoolTo).
+				Strs("workloads", fit.TopMismatches(5)).
+				Msgf("Only %d of %d pod(s) can run on the node pool shifted to, limiting the shift accordingly", fit.Fitting, fit.Pods)
+
+			victimZones, batchSize = limitVictimCounts(victimZones, victimCounts, zoneSizes, fit.Ratio())
+		}
+
+		if len(victimZones) == 0 {
+			state.SkipReason = "workload_affinity"
+			state.Decision = "workloads of node pool to shift from can't run on node pool to shift to"
+			return "skipped", sleepTime
+		}
+	}
+
+	victims, blocked, err := selectVictims(k, nodePoolFrom, victimZones, victimCounts, victimCriteria{
+		ForceBarePods: s.options.ForceBarePods,
+		SelfNode:      s.options.NodeName,
+		NodeFilter:    s.options.NodeFilter,
+		LocalVolumes:  s.options.LocalVolumes,
+		Target:        &targetProfile,
+
+		MaxPodsDisrupted: s.options.MaxPodsDisrupted,
+	})
+
+	state.BlockedNodes = blocked
+
+	if errors.Is(err, errSelfIsCandidate) {
+		log.Info().
+			Str("node-pool", nodePoolFrom).
+			Str("node", s.options.NodeName).
+			Msg("The node the shifter runs on has to be removed, moving the shifter first")
+
+		state.Decision = "moving the shifter off the node to remove"
+		if err := s.moveSelf(); err != nil {
+			log.Error().
+				Err(err).
+				Str("node", s.options.NodeName).
+				Msg("Error moving the shifter off its node")
+
+			state.Decision = "error moving the shifter off the node to remove"
+			return "failed", sleepTime
+		}
+
+		state.SkipReason = "moving_self"
+		return "skipped", sleepTime
+	}
+
+	if errors.Is(err, errTooDisruptive) {
+		log.Info().
+			Str("node-pool", nodePoolFrom).
+			Msgf("No node(s) can be removed while evicting at most %d pod(s), deferring shift", s.options.MaxPodsDisrupted)
+
+		state.SkipReason = "max_pods_disrupted"
+		state.Decision = fmt.Sprintf("removal would disrupt more than %d pod(s)", s.options.MaxPodsDisrupted)
+		return "skipped", sleepTime
+	}
+
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("node-pool", nodePoolFrom).
+			Msg("No node can be selected for removal, skipping shift")
+
+		state.SkipReason = "no_victim"
+		state.Decision = "no node can be removed safely"
+		return "skipped", sleepTime
+	}
+
+	state.Victims = victims
+
+	disruption := EstimateDisruption(victims)
+	state.Disruption = &disruption
+
+	log.Info().
+		Str("node-pool", nodePoolFrom).
+		Msgf("Removing %d node(s) would evict %d pod(s) of %d workload(s)", len(victims), disruption.Pods, disruption.Workloads)
+
+	for _, v := range victims {
+		namespaces := []string{}
+		for namespace := range v.Namespaces {
+			namespaces = append(namespaces, namespace)
+		}
+		sort.Strings(namespaces)
+
+		log.Info().
+			Str("node-pool", nodePoolFrom).
+			Str("node", v.Node).
+			Strs("namespaces", namespaces).
+			Msgf("Removing the node would evict %d pod(s) from %d namespace(s)", v.Pods, len(namespaces))
+	}
+
+	// a last resort against several controllers shrinking the cluster at once, checked again right before draining
+	if err := s.checkCapacityFloor(nil); err != nil {
+		log.Warn().
+			Err(err).
+			Msg("Cluster is below its capacity floor, skipping shift")
+
+		state.SkipReason = "capacity_floor"
+		state.Decision = "cluster below its capacity floor"
+		return "skipped", sleepTime
+	}
+
+	// yield to a resize started by another shifter instance, e.g. an accidental double deployment
+	for _, pool := range []struct {
+		client ContainerClient
+		name   string
+	}{{gFrom, nodePoolFrom}, {gTo, nodePoolTo}} {
+		operationName, err := pool.client.GetPendingResizeOperation(pool.name)
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("node-pool", pool.name).
+				Msg("Error while listing pending operations")
+
+			state.Decision = "error listing pending operations"
+			return "failed", sleepTime
+		}
+
+		if operationName != "" {
+			log.Info().
+				Str("node-pool", pool.name).
+				Str("operation", operationName).
+				Msg("Another resize operation is pending on the node pool, yielding this cycle")
+
+			state.SkipReason = "pending_operation"
+			state.Decision = "resize operation pending on " + pool.name
+			return "skipped", sleepTime
+		}
+	}
+
+	if s.options.PlanOutput != nil {
+		printPlan(s.options.PlanOutput, nodePoolFrom, nodePoolTo, victims, maxTo, batchSize)
+	}
+
+	plan := ShiftPlan{
+		Cluster:      s.options.Cluster,
+		NodePoolFrom: nodePoolFrom,
+		NodePoolTo:   nodePoolTo,
+		ToSize:       maxTo,
+		ToNewSize:    maxTo + batchSize,
+	}
+
+	for _, v := range victims {
+		plan.RemoveNodes = append(plan.RemoveNodes, v.Node)
+	}
+
+	// platform teams can centralize policy in an external hook, which has the final say before the operator
+	if s.options.Policy != nil {
+		allowed, reason, err := s.options.Policy.Allow(PolicyRequest{Plan: plan, State: state})
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error while consulting the policy hook")
+
+			state.Decision = "error consulting the policy hook"
+			return "failed", sleepTime
+		}
+
+		if !allowed {
+			log.Info().
+				Str("reason", reason).
+				Msg("Policy hook denied the shift, skipping shift")
+
+			state.SkipReason = "policy_denied"
+			state.Decision = "policy hook denied the shift: " + reason
+			return "skipped", sleepTime
+		}
+	}
+
+	if s.options.RequireApproval {
+		approved, err := checkPlanApproval(k, s.options.ApprovalConfigMap, plan)
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("configmap", s.options.ApprovalConfigMap).
+				Msg("Error while publishing plan for approval")
+
+			state.Decision = "error publishing plan for approval"
+			return "failed", sleepTime
+		}
+
+		if !approved {
+			log.Info().
+				Str("configmap", s.options.ApprovalConfigMap).
+				Str("plan-hash", plan.Hash()).
+				Msg("Plan is awaiting approval, skipping shift")
+
+			state.SkipReason = "awaiting_approval"
+			state.Decision = "plan awaiting approval"
+			return "skipped", sleepTime
+		}
+
+		defer func() {
+			if err := consumePlanApproval(k, s.options.ApprovalConfigMap); err != nil {
+				log.Error().
+					Err(err).
+					Str("configmap", s.options.ApprovalConfigMap).
+					Msg("Error while removing plan approval")
+			}
+		}()
+	}
+
+	log.Info().
+		Str("node-pool", nodePoolTo).
+		Msgf("Attempting to shift %d node(s) per region...", batchSize)
+
+	status = "shifted"
+	state.Decision = fmt.Sprintf("shift %d node(s) per region", batchSize)
+
+	transitions, err := s.shiftNode(locationsTo, victims, maxTo, batchSize)
+	state.Transitions = transitions
+
+	if err != nil {
+		status = "failed"
+		state.Decision = "shift failed: " + err.Error()
+
+		var blockedErr *DrainBlockedError
+		if errors.As(err, &blockedErr) {
+			state.BlockedNodes = append(state.BlockedNodes, BlockedNode{
+				Node:   blockedErr.Node,
+				Reason: "pdb",
+				Pods:   blockedErr.Pods,
+			})
+		}
+	} else {
+		s.bounceTracker.RecordShift(s.clock.Now(), zonesFrom.Sum()-len(victims))
+
+		s.setDesiredToSize(maxTo+batchSize, s.clock.Now())
+
+		// nodes reporting Ready can still fail to run workloads, e.g. with a broken node image or unexpected taints
+		if s.options.CanaryProbe && !s.runCanaryProbe(state) && s.options.CanaryBreaker {
+			log.Warn().
+				Str("node-pool", nodePoolTo).
+				Msg("Canary probe failed after the shift, pausing shifting until it passes again")
+		}
+	}
+
+	// interval between actions, leverage provider requests when
+	// another operation is already operating on the cluster
+	sleepTime = time.Duration(s.jitter.Apply(s.options.CycleTime)) * time.Second
+
+	return
+}
+
+// runCanaryProbe probes the node pool shifted to with a canary pod and records the outcome, it returns true if the pod
+// ran; a failure opens the circuit breaker when enabled
+func (s *Shifter) runCanaryProbe(state *CycleState) bool {
+	err := s.probeCanary()
+	healthy := err == nil
+	state.CanaryHealthy = &healthy
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("node-pool", s.options.NodePoolTo).
+			Msg("Canary probe failed")
+	}
+
+	s.canaryFailing = !healthy && s.options.CanaryBreaker
+
+	return healthy
+}
+
+// selfCordonAnnotation is set on the node the shifter cordoned to move off it, to the unix time it did so, so a later
+// cycle not removing the node after all uncordons it
+const selfCordonAnnotation = "estafette.io/gke-node-pool-shifter-self-cordon"
+
+// moveSelf hands the shift off to a replacement shifter pod: the node the shifter runs on is cordoned and its own pod
+// evicted, so the replacement is scheduled elsewhere and can remove the node on its next cycle
+func (s *Shifter) moveSelf() (err error) {
+	if s.options.PodName == "" {
+		return fmt.Errorf("The name of the shifter pod is unknown, it can't be moved")
+	}
+
+	cordoned := map[string]string{
+		selfCordonAnnotation: strconv.FormatInt(s.clock.Now().Unix(), 10),
+	}
+
+	if err = s.kubernetes.SetNodeAnnotations(s.options.NodeName, cordoned); err != nil {
+		return fmt.Errorf("Error annotating node %v: %v", s.options.NodeName, err)
+	}
+
+	if err = s.kubernetes.SetNodeUnschedulable(s.options.NodeName, true); err != nil {
+		return fmt.Errorf("Error cordoning node %v: %v", s.options.NodeName, err)
+	}
+
+	pod := v1.Pod{}
+	pod.Name = s.options.PodName
+	pod.Namespace = s.options.PodNamespace
+
+	if err = s.kubernetes.EvictPod(pod); err != nil {
+		return fmt.Errorf("Error evicting pod %v/%v: %v", pod.Namespace, pod.Name, err)
+	}
+
+	return
+}
+
+// printPlan prints the resizes and removals a shift is going to perform
+func printPlan(out io.Writer, fromName, toName string, victims []Victim, toCurrentSize, count int) {
+	fmt.Fprintf(out, "Plan:\n")
+	fmt.Fprintf(out, "  1. resize node pool %v from %d to %d node(s) per zone\n", toName, toCurrentSize, toCurrentSize+count)
+	for i, v := range victims {
+		fmt.Fprintf(out, "  %d. drain and remove node %v of node pool %v in zone %v, evicting %d pod(s) from %d namespace(s)\n", i+2, v.Node, fromName, v.Zone, v.Pods, len(v.Namespaces))
+	}
+}
+
+// releaseSelfCordon uncordons the nodes of the node pool shifted from a shifter cordoned to move off them, once the
+// shifter pod is confirmed running on another node, unless they were retired since; failing to do so is retried on the
+// next cycle
+func (s *Shifter) releaseSelfCordon() {
+	nodes, err := s.kubernetes.GetNodeList(s.options.NodePoolFrom)
+
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("node-pool", s.options.NodePoolFrom).
+			Msg("Error listing nodes, nodes cordoned to move the shifter won't be uncordoned")
+		return
+	}
+
+	cordoned := []v1.Node{}
+	for _, node := range nodes.Items {
+		if _, ok := node.Annotations[selfCordonAnnotation]; ok {
+			cordoned = append(cordoned, node)
+		}
+	}
+
+	if len(cordoned) == 0 || s.options.PodName == "" {
+		return
+	}
+
+	pod, err := s.kubernetes.GetPod(s.options.PodName)
+
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("pod", s.options.PodName).
+			Msg("Error retrieving the shifter pod, nodes cordoned to move the shifter won't be uncordoned")
+		return
+	}
+
+	if pod.Status.Phase != v1.PodRunning {
+		return
+	}
+
+	for _, node := range cordoned {
+		// the shifter didn't move yet
+		if pod.Spec.NodeName == "" || pod.Spec.NodeName == node.Name {
+			continue
+		}
+
+		// in cordon only mode a drained node stays cordoned for the cluster-autoscaler to remove
+		if _, ok := node.Labels[RetiredLabel]; ok {
+			continue
+		}
+
+		log.Info().
+			Str("node-pool", s.options.NodePoolFrom).
+			Str("node", node.Name).
+			Msg("Node cordoned to move the shifter isn't removed, uncordoning it")
+
+		if err := s.kubernetes.SetNodeUnschedulable(node.Name, false); err != nil {
+			log.Warn().
+				Err(err).
+				Str("node", node.Name).
+				Msg("Error uncordoning node")
+			continue
+		}
+
+		if err := s.kubernetes.SetNodeAnnotations(node.Name, map[string]string{selfCordonAnnotation: ""}); err != nil {
+			log.Warn().
+				Err(err).
+				Str("node", node.Name).
+				Msg("Error removing the annotation of a node cordoned to move the shifter")
+		}
+	}
+}
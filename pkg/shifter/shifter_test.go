@@ -0,0 +1,267 @@
+package shifter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestCycleStateConverged(t *testing.T) {
+	healthy, failing := true, false
+	ready := ZoneStats{"europe-west1-b": {Ready: 2, Total: 2}, "europe-west1-c": {Ready: 2, Total: 2}}
+	notReady := ZoneStats{"europe-west1-b": {Ready: 2, Total: 2}, "europe-west1-c": {Ready: 1, Total: 2}}
+
+	tests := []struct {
+		name     string
+		state    CycleState
+		expected bool
+	}{
+		{"at minimum", CycleState{SkipReason: "at_minimum", ZonesTo: ready}, true},
+		{"empty source", CycleState{SkipReason: "empty_source", ZonesTo: ready}, true},
+		{"migrated", CycleState{SkipReason: "migrated"}, true},
+		{"shifted", CycleState{ZonesTo: ready}, false},
+		{"skipped otherwise", CycleState{SkipReason: "cooldown", ZonesTo: ready}, false},
+		{"target not ready", CycleState{SkipReason: "at_minimum", ZonesTo: notReady}, false},
+		{"canary passing", CycleState{SkipReason: "at_minimum", ZonesTo: ready, CanaryHealthy: &healthy}, true},
+		{"canary failing", CycleState{SkipReason: "at_minimum", ZonesTo: ready, CanaryHealthy: &failing}, false},
+	}
+
+	for _, test := range tests {
+		if output := test.state.Converged(); output != test.expected {
+			t.Errorf("%v: Converged, expected %v got %v", test.name, test.expected, output)
+		}
+	}
+}
+
+func TestRunCycle(t *testing.T) {
+	floor, _ := ParseCapacityFloor("1", "")
+
+	tests := []struct {
+		name       string
+		options    Options
+		setup      func(*fakeKubernetes, *fakeContainer)
+		status     string
+		skipReason string
+	}{
+		{
+			name:   "shifted",
+			status: "shifted",
+		},
+		{
+			name:       "at minimum",
+			options:    Options{NodePoolFromMinNode: 2},
+			status:     "skipped",
+			skipReason: "at_minimum",
+		},
+		{
+			name: "empty source",
+			setup: func(k *fakeKubernetes, g *fakeContainer) {
+				g.SetNodePoolSize(context.Background(), "pool-a", 0)
+			},
+			status:     "empty",
+			skipReason: "empty_source",
+		},
+		{
+			name: "error getting locations",
+			setup: func(k *fakeKubernetes, g *fakeContainer) {
+				g.errs["GetNodePoolLocations pool-a"] = errors.New("unavailable")
+			},
+			status: "failed",
+		},
+		{
+			name: "error determining zones",
+			setup: func(k *fakeKubernetes, g *fakeContainer) {
+				k.errs["GetZones pool-b"] = errors.New("unavailable")
+			},
+			status: "failed",
+		},
+		{
+			name: "no shared zone",
+			setup: func(k *fakeKubernetes, g *fakeContainer) {
+				g.locations["pool-b"] = []string{"europe-west1-d"}
+			},
+			status:     "skipped",
+			skipReason: "no_shared_zone",
+		},
+		{
+			name: "autoscaler scaling down",
+			setup: func(k *fakeKubernetes, g *fakeContainer) {
+				k.node("a-b-1").Spec.Taints = []v1.Taint{{Key: taintDeletionCandidate, Effect: v1.TaintEffectPreferNoSchedule}}
+			},
+			status:     "skipped",
+			skipReason: "autoscaler",
+		},
+		{
+			name: "no node to remove",
+			setup: func(k *fakeKubernetes, g *fakeContainer) {
+				for _, node := range []string{"a-b-1", "a-b-2"} {
+					k.pods[node] = []v1.Pod{fakePod("ops", "debug-"+node, node, false)}
+				}
+			},
+			status:     "skipped",
+			skipReason: "no_victim",
+		},
+		{
+			name:       "too disruptive",
+			options:    Options{MaxPodsDisrupted: 1},
+			status:     "skipped",
+			skipReason: "max_pods_disrupted",
+		},
+		{
+			name:       "below capacity floor",
+			options:    Options{CapacityFloor: floor},
+			status:     "skipped",
+			skipReason: "capacity_floor",
+		},
+		{
+			name: "pending operation",
+			setup: func(k *fakeKubernetes, g *fakeContainer) {
+				g.pending["pool-b"] = "operation-1234"
+			},
+			status:     "skipped",
+			skipReason: "pending_operation",
+		},
+		{
+			name: "shift failed",
+			setup: func(k *fakeKubernetes, g *fakeContainer) {
+				g.errs["SetNodePoolSize pool-b 2"] = errors.New("quota exceeded")
+			},
+			status: "failed",
+		},
+	}
+
+	for _, test := range tests {
+		// pool-a has two nodes running a pod each and pool-b a single node in both zones
+		k := newFakeKubernetes(
+			fakeNode("a-b-1", "pool-a", "europe-west1-b"),
+			fakeNode("a-b-2", "pool-a", "europe-west1-b"),
+			fakeNode("a-c-1", "pool-a", "europe-west1-c"),
+			fakeNode("a-c-2", "pool-a", "europe-west1-c"),
+			fakeNode("b-b-1", "pool-b", "europe-west1-b"),
+			fakeNode("b-c-1", "pool-b", "europe-west1-c"),
+		)
+		for _, node := range []string{"a-b-1", "a-b-2", "a-c-1", "a-c-2"} {
+			k.pods[node] = []v1.Pod{fakePod("shop", "web-"+node, node, true)}
+		}
+
+		g := newFakeContainer(k, map[string][]string{
+			"pool-a": {"europe-west1-b", "europe-west1-c"},
+			"pool-b": {"europe-west1-b", "europe-west1-c"},
+		})
+
+		if test.setup != nil {
+			test.setup(k, g)
+		}
+
+		options := test.options
+		if options.NodePoolFromMinNode == 0 {
+			options.NodePoolFromMinNode = 1
+		}
+
+		status, _, state := newFakeShifter(options, k, g).RunCycle()
+
+		if status != test.status || state.SkipReason != test.skipReason {
+			t.Errorf("%v: expected %v %q got %v %q: %v", test.name, test.status, test.skipReason, status, state.SkipReason, state.Decision)
+		}
+
+		if test.status != "shifted" {
+			continue
+		}
+
+		zones, _ := k.GetZones("pool-a", g.locations["pool-a"], NodeFilter{})
+		if zones.Sum() != 2 || len(state.Victims) != 2 {
+			t.Errorf("%v: expected a node removed per zone got %d node(s) left and victims %v", test.name, zones.Sum(), state.Victims)
+		}
+
+		zones, _ = k.GetZones("pool-b", g.locations["pool-b"], NodeFilter{})
+		if zones.Sum() != 4 {
+			t.Errorf("%v: expected a node added per zone got %d node(s)", test.name, zones.Sum())
+		}
+	}
+}
+
+func TestReleaseSelfCordon(t *testing.T) {
+	k := newFakeKubernetes(
+		fakeNode("a-b-1", "pool-a", "europe-west1-b"),
+		fakeNode("a-b-2", "pool-a", "europe-west1-b"),
+		fakeNode("a-c-1", "pool-a", "europe-west1-c"),
+		fakeNode("a-c-2", "pool-a", "europe-west1-c"),
+	)
+	for _, name := range []string{"a-b-1", "a-b-2", "a-c-1", "a-c-2"} {
+		k.node(name).Spec.Unschedulable = true
+		k.node(name).Annotations = map[string]string{selfCordonAnnotation: "1500000000"}
+	}
+	k.node("a-b-2").Labels[RetiredLabel] = "1500000000"
+	k.errs["SetNodeUnschedulable a-c-2 false"] = errors.New("conflict")
+
+	// the shifter moved to a-c-1
+	k.pods["a-c-1"] = []v1.Pod{fakePod("ops", "shifter-2", "a-c-1", true)}
+
+	newFakeShifter(Options{PodName: "shifter-2"}, k, newFakeContainer(k, nil)).releaseSelfCordon()
+
+	tests := []struct {
+		node      string
+		cordoned  bool
+		annotated bool
+	}{
+		{"a-b-1", false, false},
+		{"a-b-2", true, true},
+		{"a-c-1", true, true},
+		{"a-c-2", true, true},
+	}
+
+	for _, test := range tests {
+		node := k.node(test.node)
+		_, annotated := node.Annotations[selfCordonAnnotation]
+
+		if node.Spec.Unschedulable != test.cordoned || annotated != test.annotated {
+			t.Errorf("%v: expected cordoned %v and annotated %v got %v and %v", test.node, test.cordoned, test.annotated, node.Spec.Unschedulable, annotated)
+		}
+	}
+}
+
+func TestReleaseSelfCordonSkippedCycle(t *testing.T) {
+	pending := fakePod("ops", "shifter-2", "", true)
+	pending.Status.Phase = v1.PodPending
+
+	tests := []struct {
+		name     string
+		pod      v1.Pod
+		cordoned bool
+	}{
+		{"replacement pending", pending, true},
+		{"shifter still on the node", fakePod("ops", "shifter-2", "a-b-1", true), true},
+		{"shifter moved", fakePod("ops", "shifter-2", "a-c-1", true), false},
+	}
+
+	for _, test := range tests {
+		k := newFakeKubernetes(
+			fakeNode("a-b-1", "pool-a", "europe-west1-b"),
+			fakeNode("a-c-1", "pool-a", "europe-west1-c"),
+			fakeNode("b-b-1", "pool-b", "europe-west1-b"),
+			fakeNode("b-c-1", "pool-b", "europe-west1-c"),
+		)
+		k.node("a-b-1").Spec.Unschedulable = true
+		k.node("a-b-1").Annotations = map[string]string{selfCordonAnnotation: "1500000000"}
+		k.pods[test.pod.Spec.NodeName] = []v1.Pod{test.pod}
+
+		g := newFakeContainer(k, map[string][]string{
+			"pool-a": {"europe-west1-b", "europe-west1-c"},
+			"pool-b": {"europe-west1-b", "europe-west1-c"},
+		})
+
+		s := newFakeShifter(Options{PodName: "shifter-2"}, k, g)
+		s.cooldownUntil = s.clock.Now().Add(time.Hour)
+
+		if _, _, state := s.RunCycle(); state.SkipReason != "cooldown" {
+			t.Fatalf("%v: expected the cycle to skip on cooldown got %q", test.name, state.SkipReason)
+		}
+
+		if cordoned := k.node("a-b-1").Spec.Unschedulable; cordoned != test.cordoned {
+			t.Errorf("%v: expected the node left cordoned %v got %v", test.name, test.cordoned, cordoned)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package shifter
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// PoolZoneSize compares the number of nodes GKE targets for a node pool in a zone with the Ready nodes Kubernetes
+// observes there, a persistent gap points at a stockout or provisioning problem
+type PoolZoneSize struct {
+	Pool   string `json:"pool"`
+	Zone   string `json:"zone"`
+	Target int    `json:"target"`
+	Ready  int    `json:"ready"`
+}
+
+// CountReadyNodesByZone returns the number of Ready nodes per zone
+func CountReadyNodesByZone(nodes []v1.Node) map[string]int {
+	ready := map[string]int{}
+	for _, node := range nodes {
+		if isNodeReady(node) {
+			ready[node.Labels["failure-domain.beta.kubernetes.io/zone"]]++
+		}
+	}
+
+	return ready
+}
+
+// observePoolSizes returns the target and Ready size of a node pool in each of the given zones
+func (s *Shifter) observePoolSizes(g ContainerClient, name string, zones []string) (sizes []PoolZoneSize, err error) {
+	targets, err := g.GetNodePoolTargetSizes(name)
+	if err != nil {
+		return
+	}
+
+	nodes, err := s.kubernetes.GetNodeList(name)
+	if err != nil {
+		return
+	}
+
+	ready := CountReadyNodesByZone(nodes.Items)
+
+	for _, zone := range zones {
+		sizes = append(sizes, PoolZoneSize{
+			Pool:   name,
+			Zone:   zone,
+			Target: targets[zone],
+			Ready:  ready[zone],
+		})
+	}
+
+	return
+}
@@ -0,0 +1,318 @@
+package shifter
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Victim is a node of the node pool shifted from selected for removal
+type Victim struct {
+	Node     string `json:"node"`
+	Zone     string `json:"zone"`
+	Instance string `json:"instance"`
+	Pods     int    `json:"pods"`
+	Cost     int    `json:"cost"`
+
+	// Namespaces holds the number of pods to evict per namespace, so tenants can correlate disruptions with shifts
+	Namespaces map[string]int `json:"namespaces"`
+
+	// Workloads holds the number of pods to evict per namespace/kind/name of their workload
+	Workloads map[string]int `json:"workloads"`
+
+	// LocalVolumes holds the local volumes of the pods to evict, their data is lost with the node
+	LocalVolumes []LocalVolume `json:"localVolumes,omitempty"`
+}
+
+// AffectedNamespaces returns the number of pods to evict per namespace over all given victims
+func AffectedNamespaces(victims []Victim) map[string]int {
+	namespaces := map[string]int{}
+	for _, v := range victims {
+		for namespace, count := range v.Namespaces {
+			namespaces[namespace] += count
+		}
+	}
+
+	return namespaces
+}
+
+const (
+	// podDeletionCostAnnotation ranks the pods of a ReplicaSet for scale down, pods with a lower cost are evicted first
+	podDeletionCostAnnotation = "controller.kubernetes.io/pod-deletion-cost"
+
+	// autoscalerPodDeletionCostAnnotation is accepted as an alternative to podDeletionCostAnnotation
+	autoscalerPodDeletionCostAnnotation = "cluster-autoscaler.kubernetes.io/pod-deletion-cost"
+
+	// NodeDeletionCostAnnotation ranks the nodes of the node pool shifted from, nodes with a lower cost are removed
+	// first; without it the cost of a node is the sum of the deletion costs of its pods
+	NodeDeletionCostAnnotation = "estafette.io/node-deletion-cost"
+)
+
+// parseDeletionCost returns the value of the first of the given annotations holding an integer, 0 if none does
+func parseDeletionCost(annotations map[string]string, keys ...string) (cost int, ok bool) {
+	for _, key := range keys {
+		if cost, err := strconv.Atoi(annotations[key]); err == nil {
+			return cost, true
+		}
+	}
+
+	return 0, false
+}
+
+// podDeletionCost returns the deletion cost of a pod, 0 when it isn't annotated
+func podDeletionCost(pod v1.Pod) int {
+	cost, _ := parseDeletionCost(pod.Annotations, podDeletionCostAnnotation, autoscalerPodDeletionCostAnnotation)
+	return cost
+}
+
+// nodeDeletionCost returns the deletion cost of a node, from its annotation or else as the sum of the deletion costs of
+// the given pods to evict from it
+func nodeDeletionCost(node v1.Node, pods []v1.Pod) (cost int) {
+	if cost, ok := parseDeletionCost(node.Annotations, NodeDeletionCostAnnotation); ok {
+		return cost
+	}
+
+	for _, pod := range pods {
+		if needsEviction(pod) {
+			cost += podDeletionCost(pod)
+		}
+	}
+
+	return
+}
+
+// safeToEvictAnnotation set to "false" on a pod keeps the cluster-autoscaler, and the shifter, from removing its node
+const safeToEvictAnnotation = "cluster-autoscaler.kubernetes.io/safe-to-evict"
+
+// BlockedNode is a node of the node pool shifted from that can't be drained, with the namespace/name of the pods
+// blocking it; the reason is one of bare_pods, safe_to_evict, local_volumes or pdb
+type BlockedNode struct {
+	Node   string   `json:"node"`
+	Reason string   `json:"reason"`
+	Pods   []string `json:"pods"`
+}
+
+// errSelfIsCandidate is returned when a zone only has enough nodes to remove by including the node the shifter runs on
+var errSelfIsCandidate = errors.New("the node the shifter runs on is needed as a candidate")
+
+// victimCriteria restricts which nodes can be selected for removal
+type victimCriteria struct {
+	ForceBarePods bool
+	SelfNode      string
+	NodeFilter    NodeFilter
+
+	// LocalVolumes decides whether nodes whose pods use local volumes can be selected, they can unless skipped
+	LocalVolumes LocalVolumeHandling
+
+	// MaxPodsDisrupted caps the pods evicted by all nodes selected, 0 for no limit
+	MaxPodsDisrupted int
+
+	// Target is the profile of the node pool shifted to, nodes running pods that don't fit it are never selected since
+	// draining them would only push those pods back onto the node pool shifted from
+	Target *NodeProfile
+}
+
+// selectVictims selects the given number of nodes to remove in each zone of a node pool; nodes running pods without a
+// controller are never selected unless forced since those pods are lost when evicted, neither are nodes running pods
+// annotated not to be evicted or, unless handled otherwise, using local volumes, those nodes are returned as blocked;
+// among the other nodes the ones with the lowest deletion cost, then the fewest pods to evict are preferred; the node
+// the shifter runs on is never selected, when it is needed errSelfIsCandidate is returned so the shifter can move
+// itself first; nodes with too many pods to stay within the maximum number of pods to disrupt are passed over,
+// errTooDisruptive is returned when not enough nodes are left
+func selectVictims(k KubernetesClient, name string, zones []string, counts map[string]int, criteria victimCriteria) (victims []Victim, blocked []BlockedNode, err error) {
+	nodes, err := k.GetNodeList(name)
+
+	if err != nil {
+		return
+	}
+
+	blocked = []BlockedNode{}
+	candidates := map[string][]Victim{}
+	selfZone := ""
+
+	var budget *int
+	if criteria.MaxPodsDisrupted > 0 {
+		budget = &criteria.MaxPodsDisrupted
+	}
+
+	volumesByClaim := map[string]v1.PersistentVolume{}
+	if criteria.LocalVolumes != LocalVolumesForce {
+		pvs, err := k.GetPersistentVolumes()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		volumesByClaim = localVolumesByClaim(pvs.Items)
+	}
+
+	for _, node := range nodes.Items {
+		// the cluster-autoscaler is already removing this capacity
+		if IsScaleDownCandidate(node) || IsRetired(node) || !criteria.NodeFilter.Matches(node) {
+			continue
+		}
+
+		zone := node.Labels["failure-domain.beta.kubernetes.io/zone"]
+
+		// the provider id of a GKE node is gce://<project>/<zone>/<instance>
+		instance := path.Base(node.Spec.ProviderID)
+
+		pods, err := k.GetPodsOnNode(node.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if reason, blocking := findBlockingPods(pods.Items, criteria.ForceBarePods); len(blocking) > 0 {
+			log.Info().
+				Str("node-pool", name).
+				Str("node", node.Name).
+				Str("reason", reason).
+				Strs("pods", blocking).
+				Msg("Node can't be drained, contact the owners of the blocking pods")
+
+			blocked = append(blocked, BlockedNode{
+				Node:   node.Name,
+				Reason: reason,
+				Pods:   blocking,
+			})
+			continue
+		}
+
+		localVolumes := findLocalVolumes(pods.Items, volumesByClaim)
+
+		if len(localVolumes) > 0 && criteria.LocalVolumes == LocalVolumesSkip {
+			blocking := []string{}
+			for _, volume := range localVolumes {
+				blocking = append(blocking, volume.Pod)
+			}
+
+			log.Info().
+				Str("node-pool", name).
+				Str("node", node.Name).
+				Str("reason", "local_volumes").
+				Strs("pods", blocking).
+				Msg("Node can't be drained, pods use local volumes whose data would be lost")
+
+			blocked = append(blocked, BlockedNode{
+				Node:   node.Name,
+				Reason: "local_volumes",
+				Pods:   blocking,
+			})
+			continue
+		}
+
+		evictable, _ := countPodsToEvict(pods.Items)
+
+		if criteria.Target != nil && !allPodsFitProfile(pods.Items, *criteria.Target) {
+			continue
+		}
+
+		if node.Name == criteria.SelfNode {
+			selfZone = zone
+			continue
+		}
+
+		candidates[zone] = append(candidates[zone], Victim{
+			Node:     node.Name,
+			Zone:     zone,
+			Instance: instance,
+			Pods:     evictable,
+			Cost:     nodeDeletionCost(node, pods.Items),
+
+			Namespaces:   countPodsToEvictByNamespace(pods.Items),
+			Workloads:    countPodsToEvictByWorkload(pods.Items),
+			LocalVolumes: localVolumes,
+		})
+	}
+
+	for _, zone := range zones {
+		zoneCandidates := candidates[zone]
+
+		if len(zoneCandidates) < counts[zone] && zone == selfZone && len(zoneCandidates)+1 == counts[zone] {
+			return nil, blocked, errSelfIsCandidate
+		}
+
+		if len(zoneCandidates) < counts[zone] {
+			return nil, blocked, fmt.Errorf("Only %d of the %d node(s) of node pool %v to remove in zone %v can be removed safely", len(zoneCandidates), counts[zone], name, zone)
+		}
+
+		sort.SliceStable(zoneCandidates, func(i, j int) bool {
+			if zoneCandidates[i].Cost != zoneCandidates[j].Cost {
+				return zoneCandidates[i].Cost < zoneCandidates[j].Cost
+			}
+			return zoneCandidates[i].Pods < zoneCandidates[j].Pods
+		})
+
+		picked := pickVictims(zoneCandidates, counts[zone], budget)
+		if len(picked) < counts[zone] {
+			return nil, blocked, errTooDisruptive
+		}
+
+		victims = append(victims, picked...)
+	}
+
+	return
+}
+
+// findBlockingPods returns the namespace/name of the pods keeping a node from being drained and why: safe_to_evict for
+// pods annotated not to be evicted, bare_pods for pods without a controller unless forced
+func findBlockingPods(pods []v1.Pod, forceBarePods bool) (reason string, blocking []string) {
+	unsafe, bare := []string{}, []string{}
+
+	for _, pod := range pods {
+		if !needsEviction(pod) {
+			continue
+		}
+
+		if pod.Annotations[safeToEvictAnnotation] == "false" {
+			unsafe = append(unsafe, pod.Namespace+"/"+pod.Name)
+		}
+
+		if classifyPod(pod) == podKindBare && !forceBarePods {
+			bare = append(bare, pod.Namespace+"/"+pod.Name)
+		}
+	}
+
+	if len(unsafe) > 0 {
+		return "safe_to_evict", unsafe
+	}
+
+	if len(bare) > 0 {
+		return "bare_pods", bare
+	}
+
+	return "", nil
+}
+
+// countPodsToEvictByNamespace returns the number of pods to evict per namespace
+func countPodsToEvictByNamespace(pods []v1.Pod) map[string]int {
+	namespaces := map[string]int{}
+	for _, pod := range pods {
+		if needsEviction(pod) {
+			namespaces[pod.Namespace]++
+		}
+	}
+
+	return namespaces
+}
+
+// countPodsToEvict returns the number of pods to evict and how many of them have no controller
+func countPodsToEvict(pods []v1.Pod) (evictable, bare int) {
+	for _, pod := range pods {
+		if !needsEviction(pod) {
+			continue
+		}
+
+		evictable++
+
+		if classifyPod(pod) == podKindBare {
+			bare++
+		}
+	}
+
+	return
+}
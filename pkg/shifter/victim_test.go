@@ -0,0 +1,134 @@
+package shifter
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNodeDeletionCost(t *testing.T) {
+	isController := true
+	replicaSet := []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-1234", Controller: &isController}}
+
+	pods := []v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", OwnerReferences: replicaSet, Annotations: map[string]string{podDeletionCostAnnotation: "10"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", OwnerReferences: replicaSet, Annotations: map[string]string{autoscalerPodDeletionCostAnnotation: "-3"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "c", OwnerReferences: replicaSet, Annotations: map[string]string{podDeletionCostAnnotation: "high"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "d", Annotations: map[string]string{v1.MirrorPodAnnotationKey: "mirror", podDeletionCostAnnotation: "100"}}},
+	}
+
+	if cost := nodeDeletionCost(v1.Node{}, pods); cost != 7 {
+		t.Errorf("nodeDeletionCost, expected the sum of the pod costs 7 got %d", cost)
+	}
+
+	annotated := v1.Node{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{NodeDeletionCostAnnotation: "1"}}}
+	if cost := nodeDeletionCost(annotated, pods); cost != 1 {
+		t.Errorf("nodeDeletionCost, expected the annotated cost 1 got %d", cost)
+	}
+}
+
+func TestFindBlockingPods(t *testing.T) {
+	isController := true
+	replicaSet := []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-1234", Controller: &isController}}
+
+	controlled := v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-1234-a", OwnerReferences: replicaSet}}
+	bare := v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ops", Name: "debug"}}
+	unsafe := v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-1234-b", OwnerReferences: replicaSet, Annotations: map[string]string{safeToEvictAnnotation: "false"}}}
+
+	tests := []struct {
+		pods          []v1.Pod
+		forceBarePods bool
+		reason        string
+		blocking      []string
+	}{
+		{[]v1.Pod{controlled}, false, "", nil},
+		{[]v1.Pod{controlled, bare}, false, "bare_pods", []string{"ops/debug"}},
+		{[]v1.Pod{controlled, bare}, true, "", nil},
+		{[]v1.Pod{bare, unsafe}, false, "safe_to_evict", []string{"shop/web-1234-b"}},
+	}
+
+	for i, test := range tests {
+		reason, blocking := findBlockingPods(test.pods, test.forceBarePods)
+
+		if reason != test.reason || !reflect.DeepEqual(blocking, test.blocking) {
+			t.Errorf("findBlockingPods case %d, expected %v %v got %v %v", i, test.reason, test.blocking, reason, blocking)
+		}
+	}
+}
+
+func TestSelectVictims(t *testing.T) {
+	newCluster := func() *fakeKubernetes {
+		k := newFakeKubernetes(
+			fakeNode("a-b-1", "pool-a", "europe-west1-b"),
+			fakeNode("a-b-2", "pool-a", "europe-west1-b"),
+			fakeNode("a-b-3", "pool-a", "europe-west1-b"),
+			fakeNode("a-c-1", "pool-a", "europe-west1-c"),
+			fakeNode("a-c-2", "pool-a", "europe-west1-c"),
+		)
+
+		k.pods["a-b-1"] = []v1.Pod{fakePod("shop", "web-1", "a-b-1", true), fakePod("shop", "web-2", "a-b-1", true)}
+		k.pods["a-b-2"] = []v1.Pod{fakePod("shop", "web-3", "a-b-2", true)}
+		k.pods["a-b-3"] = []v1.Pod{fakePod("ops", "debug", "a-b-3", false)}
+		k.pods["a-c-1"] = []v1.Pod{fakePod("shop", "web-4", "a-c-1", true)}
+
+		return k
+	}
+
+	tests := []struct {
+		name     string
+		counts   map[string]int
+		criteria victimCriteria
+		retired  string
+		victims  []string
+		err      error
+	}{
+		{"cheapest per zone", map[string]int{"europe-west1-b": 1, "europe-west1-c": 1}, victimCriteria{SelfNode: "a-c-2"}, "", []string{"a-b-2", "a-c-1"}, nil},
+		{"several per zone", map[string]int{"europe-west1-b": 2}, victimCriteria{}, "", []string{"a-b-2", "a-b-1"}, nil},
+		{"retired nodes left out", map[string]int{"europe-west1-b": 1}, victimCriteria{}, "a-b-2", []string{"a-b-1"}, nil},
+		{"self in the way", map[string]int{"europe-west1-c": 2}, victimCriteria{SelfNode: "a-c-2"}, "", nil, errSelfIsCandidate},
+		{"within the pods to disrupt", map[string]int{"europe-west1-b": 1, "europe-west1-c": 1}, victimCriteria{SelfNode: "a-c-2", MaxPodsDisrupted: 2}, "", []string{"a-b-2", "a-c-1"}, nil},
+		{"too disruptive", map[string]int{"europe-west1-b": 1, "europe-west1-c": 1}, victimCriteria{SelfNode: "a-c-2", MaxPodsDisrupted: 1}, "", nil, errTooDisruptive},
+	}
+
+	for _, test := range tests {
+		k := newCluster()
+		if test.retired != "" {
+			k.node(test.retired).Labels[RetiredLabel] = "1600000000"
+		}
+
+		zones := []string{}
+		for _, zone := range []string{"europe-west1-b", "europe-west1-c"} {
+			if test.counts[zone] > 0 {
+				zones = append(zones, zone)
+			}
+		}
+
+		victims, blocked, err := selectVictims(k, "pool-a", zones, test.counts, test.criteria)
+
+		if err != test.err {
+			t.Errorf("%v: expected error %v got %v", test.name, test.err, err)
+		}
+
+		names := []string{}
+		for _, v := range victims {
+			names = append(names, v.Node)
+			if v.Instance != v.Node {
+				t.Errorf("%v: expected the instance of %v to be %v got %v", test.name, v.Node, v.Node, v.Instance)
+			}
+		}
+		if len(names) != len(test.victims) || len(names) > 0 && !reflect.DeepEqual(names, test.victims) {
+			t.Errorf("%v: expected victims %v got %v", test.name, test.victims, names)
+		}
+
+		if len(blocked) != 1 || blocked[0].Node != "a-b-3" || blocked[0].Reason != "bare_pods" {
+			t.Errorf("%v: expected node a-b-3 blocked by bare pods got %v", test.name, blocked)
+		}
+	}
+
+	k := newCluster()
+	if _, _, err := selectVictims(k, "pool-a", []string{"europe-west1-b"}, map[string]int{"europe-west1-b": 3}, victimCriteria{}); err == nil {
+		t.Errorf("selectVictims of more nodes than can be removed, expected an error")
+	}
+}
@@ -0,0 +1,109 @@
+package shifter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+)
+
+// isNodeReady returns true if the kubelet of a given node reports it Ready
+func isNodeReady(node v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// isPodReady returns true if a given pod is running and all its containers are ready
+func isPodReady(pod v1.Pod) bool {
+	if pod.Status.Phase != v1.PodRunning {
+		return false
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// findDaemonSetPodsNotReady returns the names of the DaemonSet pods that are not ready yet, e.g. kube-proxy, the CNI or
+// logging agents on a new node
+func findDaemonSetPodsNotReady(pods []v1.Pod) (names []string) {
+	for _, pod := range pods {
+		if classifyPod(pod) == podKindDaemonSet && !isPodReady(pod) {
+			names = append(names, pod.Namespace+"/"+pod.Name)
+		}
+	}
+
+	return
+}
+
+// waitForWarmUp waits until the nodes added to a node pool since the given set of nodes are Ready and run all their
+// DaemonSet pods, then lets them settle for the warm up period, so no workload is moved onto a node whose networking
+// isn't ready
+func waitForWarmUp(ctx context.Context, c Clock, j Jitter, k KubernetesClient, name string, existingNodes map[string]bool, period time.Duration) error {
+	for existingNodes != nil {
+		nodes, err := k.GetNodeList(name)
+
+		if err == nil {
+			waitingFor := []string{}
+
+			for _, node := range nodes.Items {
+				if existingNodes[node.Name] {
+					continue
+				}
+
+				if !isNodeReady(node) {
+					waitingFor = append(waitingFor, node.Name)
+					continue
+				}
+
+				pods, err := k.GetPodsOnNode(node.Name)
+				if err != nil {
+					waitingFor = append(waitingFor, node.Name)
+					continue
+				}
+
+				waitingFor = append(waitingFor, findDaemonSetPodsNotReady(pods.Items)...)
+			}
+
+			if len(waitingFor) == 0 {
+				break
+			}
+
+			log.Info().
+				Str("node-pool", name).
+				Strs("waiting-for", waitingFor).
+				Msg("Waiting for the added nodes and their DaemonSet pods to be ready...")
+
+			err = fmt.Errorf("node pool %v is still waiting for %v to be ready", name, waitingFor)
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-waitSeconds(c, j, operationPollIntervalSecond):
+		}
+	}
+
+	log.Info().
+		Str("node-pool", name).
+		Msgf("Letting the added nodes settle for %v", period)
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("node pool %v didn't settle before the shift deadline: %v", name, ctx.Err())
+	case <-c.After(period):
+	}
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package shifter
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFindDaemonSetPodsNotReady(t *testing.T) {
+	isController := true
+	daemonSet := []metav1.OwnerReference{{Kind: "DaemonSet", Name: "kube-proxy", Controller: &isController}}
+	ready := v1.PodStatus{Phase: v1.PodRunning, Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}}
+	notReady := v1.PodStatus{Phase: v1.PodRunning, Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionFalse}}}
+
+	pods := []v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "kube-proxy-a", OwnerReferences: daemonSet}, Status: ready},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "fluentd-b", OwnerReferences: daemonSet}, Status: notReady},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "calico-c", OwnerReferences: daemonSet}, Status: v1.PodStatus{Phase: v1.PodPending}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "bare"}, Status: notReady},
+	}
+
+	output := findDaemonSetPodsNotReady(pods)
+	if !reflect.DeepEqual(output, []string{"kube-system/fluentd-b", "kube-system/calico-c"}) {
+		t.Errorf("findDaemonSetPodsNotReady, expected [kube-system/fluentd-b kube-system/calico-c] got %v", output)
+	}
+}
@@ -0,0 +1,117 @@
+package shifter
+
+import (
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ZoneStat is the size of a node pool in a single zone: its nodes, those of them that are Ready, and the number of
+// nodes GKE targets there when known
+type ZoneStat struct {
+	Ready      int `json:"ready"`
+	Total      int `json:"total"`
+	TargetSize int `json:"targetSize,omitempty"`
+}
+
+// ZoneStats holds the size of a node pool by zone, so no count loses track of the zone it belongs to; the aggregates
+// are taken over the total number of nodes per zone
+type ZoneStats map[string]ZoneStat
+
+// AddNodes counts the given nodes in a zone, a zone without nodes is added empty
+func (z ZoneStats) AddNodes(zone string, nodes []v1.Node) {
+	stat := z[zone]
+
+	for _, node := range nodes {
+		stat.Total++
+		if isNodeReady(node) {
+			stat.Ready++
+		}
+	}
+
+	z[zone] = stat
+}
+
+// SetTargetSize records the number of nodes GKE targets in a zone, zones without stats are left out
+func (z ZoneStats) SetTargetSize(zone string, size int) {
+	if stat, ok := z[zone]; ok {
+		stat.TargetSize = size
+		z[zone] = stat
+	}
+}
+
+// Zones returns the zones in alphabetical order
+func (z ZoneStats) Zones() (zones []string) {
+	for zone := range z {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+
+	return
+}
+
+// Sum returns the total number of nodes over all zones
+func (z ZoneStats) Sum() (sum int) {
+	for _, stat := range z {
+		sum += stat.Total
+	}
+
+	return
+}
+
+// ReadySum returns the number of Ready nodes over all zones
+func (z ZoneStats) ReadySum() (sum int) {
+	for _, stat := range z {
+		sum += stat.Ready
+	}
+
+	return
+}
+
+// Min returns the smallest number of nodes of a zone, 0 without zones
+func (z ZoneStats) Min() int {
+	min, _ := z.minAndMax()
+	return min
+}
+
+// MinReady returns the smallest number of Ready nodes of a zone, 0 without zones
+func (z ZoneStats) MinReady() (min int) {
+	first := true
+
+	for _, stat := range z {
+		if first || stat.Ready < min {
+			min = stat.Ready
+		}
+		first = false
+	}
+
+	return
+}
+
+// Max returns the largest number of nodes of a zone, 0 without zones
+func (z ZoneStats) Max() int {
+	_, max := z.minAndMax()
+	return max
+}
+
+// Imbalance returns the difference in number of nodes between the largest and the smallest zone
+func (z ZoneStats) Imbalance() int {
+	min, max := z.minAndMax()
+	return max - min
+}
+
+func (z ZoneStats) minAndMax() (min, max int) {
+	first := true
+
+	for _, stat := range z {
+		if first || stat.Total < min {
+			min = stat.Total
+		}
+		if first || stat.Total > max {
+			max = stat.Total
+		}
+		first = false
+	}
+
+	return
+}
@@ -0,0 +1,99 @@
+package shifter
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestZoneStatsAddNodes(t *testing.T) {
+	node := func(ready bool) v1.Node {
+		status := v1.ConditionFalse
+		if ready {
+			status = v1.ConditionTrue
+		}
+
+		return v1.Node{Status: v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: status}}}}
+	}
+
+	zones := ZoneStats{}
+	zones.AddNodes("europe-west1-b", []v1.Node{node(true), node(false), node(true)})
+	zones.AddNodes("europe-west1-c", nil)
+	zones.AddNodes("europe-west1-b", []v1.Node{node(true)})
+
+	expected := ZoneStats{
+		"europe-west1-b": {Ready: 3, Total: 4},
+		"europe-west1-c": {},
+	}
+
+	if !reflect.DeepEqual(zones, expected) {
+		t.Errorf("AddNodes, expected %v got %v", expected, zones)
+	}
+}
+
+func TestZoneStatsSetTargetSize(t *testing.T) {
+	zones := ZoneStats{"europe-west1-b": {Ready: 2, Total: 2}}
+
+	zones.SetTargetSize("europe-west1-b", 3)
+	zones.SetTargetSize("europe-west1-d", 1)
+
+	expected := ZoneStats{"europe-west1-b": {Ready: 2, Total: 2, TargetSize: 3}}
+
+	if !reflect.DeepEqual(zones, expected) {
+		t.Errorf("SetTargetSize, expected %v got %v", expected, zones)
+	}
+}
+
+func TestZoneStatsZones(t *testing.T) {
+	zones := ZoneStats{"europe-west1-d": {}, "europe-west1-b": {}, "europe-west1-c": {}}
+
+	if output := zones.Zones(); !reflect.DeepEqual(output, []string{"europe-west1-b", "europe-west1-c", "europe-west1-d"}) {
+		t.Errorf("Zones, expected [europe-west1-b europe-west1-c europe-west1-d] got %v", output)
+	}
+
+	if output := (ZoneStats{}).Zones(); len(output) != 0 {
+		t.Errorf("Zones without zones, expected none got %v", output)
+	}
+}
+
+func TestZoneStatsAggregates(t *testing.T) {
+	tests := []struct {
+		name      string
+		zones     ZoneStats
+		sum       int
+		readySum  int
+		min       int
+		minReady  int
+		max       int
+		imbalance int
+	}{
+		{"no zone", ZoneStats{}, 0, 0, 0, 0, 0, 0},
+		{"single zone", ZoneStats{"europe-west1-b": {Ready: 2, Total: 3}}, 3, 2, 3, 2, 3, 0},
+		{"balanced", ZoneStats{"europe-west1-b": {Ready: 2, Total: 2}, "europe-west1-c": {Ready: 2, Total: 2}}, 4, 4, 2, 2, 2, 0},
+		{"imbalanced", ZoneStats{"europe-west1-b": {Ready: 1, Total: 4}, "europe-west1-c": {Ready: 1, Total: 1}, "europe-west1-d": {Ready: 2, Total: 2}}, 7, 4, 1, 1, 4, 3},
+		{"empty zone", ZoneStats{"europe-west1-b": {Ready: 3, Total: 3}, "europe-west1-c": {}}, 3, 3, 0, 0, 3, 3},
+		{"target sizes ignored", ZoneStats{"europe-west1-b": {Total: 1, TargetSize: 5}, "europe-west1-c": {Total: 2, TargetSize: 0}}, 3, 0, 1, 0, 2, 1},
+	}
+
+	for _, test := range tests {
+		if output := test.zones.Sum(); output != test.sum {
+			t.Errorf("%v: Sum, expected %d got %d", test.name, test.sum, output)
+		}
+		if output := test.zones.ReadySum(); output != test.readySum {
+			t.Errorf("%v: ReadySum, expected %d got %d", test.name, test.readySum, output)
+		}
+		if output := test.zones.Min(); output != test.min {
+			t.Errorf("%v: Min, expected %d got %d", test.name, test.min, output)
+		}
+		if output := test.zones.MinReady(); output != test.minReady {
+			t.Errorf("%v: MinReady, expected %d got %d", test.name, test.minReady, output)
+		}
+		if output := test.zones.Max(); output != test.max {
+			t.Errorf("%v: Max, expected %d got %d", test.name, test.max, output)
+		}
+		if output := test.zones.Imbalance(); output != test.imbalance {
+			t.Errorf("%v: Imbalance, expected %d got %d", test.name, test.imbalance, output)
+		}
+	}
+}
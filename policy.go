@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
+)
+
+// policyDecision is the optional json body of a policy hook response
+type policyDecision struct {
+	Allow  *bool  `json:"allow"`
+	Reason string `json:"reason"`
+}
+
+// PolicyWebhook asks an external endpoint whether a planned shift may proceed
+type PolicyWebhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewPolicyWebhook returns a policy hook posting to the given url
+func NewPolicyWebhook(url string) *PolicyWebhook {
+	return &PolicyWebhook{
+		URL:    url,
+		Client: &http.Client{Timeout: webhookTimeoutSecond * time.Second},
+	}
+}
+
+// Allow posts the planned shift and cycle state; a 200 response allows the shift unless its body says
+// {"allow": false}, any other 2xx or 4xx response denies it, other failures are returned as errors
+func (p *PolicyWebhook) Allow(request shifter.PolicyRequest) (allowed bool, reason string, err error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return
+	}
+
+	httpRequest, err := http.NewRequestWithContext(context.Background(), http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	response, err := p.Client.Do(httpRequest)
+	if err != nil {
+		return false, "", fmt.Errorf("Error posting to policy hook:\n%v", err)
+	}
+	defer response.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return
+	}
+
+	return parsePolicyResponse(response.StatusCode, response.Status, responseBody)
+}
+
+// parsePolicyResponse turns a policy hook response into a decision
+func parsePolicyResponse(statusCode int, status string, body []byte) (allowed bool, reason string, err error) {
+	var decision policyDecision
+	if json.Unmarshal(body, &decision) != nil {
+		decision.Reason = strings.TrimSpace(string(body))
+	}
+
+	switch {
+	case statusCode == http.StatusOK:
+		if decision.Allow != nil && !*decision.Allow {
+			return false, decision.Reason, nil
+		}
+		return true, "", nil
+	case statusCode >= 200 && statusCode < 500:
+		if decision.Reason == "" {
+			decision.Reason = status
+		}
+		return false, decision.Reason, nil
+	default:
+		return false, "", fmt.Errorf("Policy hook responded with %v", status)
+	}
+}
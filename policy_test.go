@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParsePolicyResponse(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		body       string
+		allowed    bool
+		reason     string
+		err        bool
+	}{
+		{200, "", true, "", false},
+		{200, `{"allow": true}`, true, "", false},
+		{200, `{"allow": false, "reason": "change freeze"}`, false, "change freeze", false},
+		{403, "outside business hours", false, "outside business hours", false},
+		{204, "", false, "204 No Content", false},
+		{503, "", false, "", true},
+	}
+
+	for _, test := range tests {
+		status := map[int]string{200: "200 OK", 204: "204 No Content", 403: "403 Forbidden", 503: "503 Service Unavailable"}[test.statusCode]
+
+		allowed, reason, err := parsePolicyResponse(test.statusCode, status, []byte(test.body))
+
+		if allowed != test.allowed || reason != test.reason || (err != nil) != test.err {
+			t.Errorf("parsePolicyResponse(%d, %q), expected %v %q %v got %v %q %v", test.statusCode, test.body, test.allowed, test.reason, test.err, allowed, reason, err)
+		}
+	}
+}
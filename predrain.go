@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
+)
+
+// PreDrainWebhook asks an external endpoint to prepare a node with local volumes for its drain, e.g. by running a
+// snapshot job, and waits for it to respond
+type PreDrainWebhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewPreDrainWebhook returns a pre-drain hook posting to the given url, the endpoint has to respond within the timeout
+func NewPreDrainWebhook(url string, timeout time.Duration) *PreDrainWebhook {
+	return &PreDrainWebhook{
+		URL:    url,
+		Client: &http.Client{Timeout: timeout},
+	}
+}
+
+// BeforeDrain posts the node and its local volumes, any 2xx response lets the drain proceed
+func (p *PreDrainWebhook) BeforeDrain(request shifter.PreDrainRequest) (err error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return
+	}
+
+	httpRequest, err := http.NewRequestWithContext(context.Background(), http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	response, err := p.Client.Do(httpRequest)
+	if err != nil {
+		return fmt.Errorf("Error posting to pre-drain hook:\n%v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		responseBody, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("Pre-drain hook responded with %v: %v", response.Status, strings.TrimSpace(string(responseBody)))
+	}
+
+	return
+}
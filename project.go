@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// projectDetailsAttempts define the number of attempts to derive the project details from the nodes
+	projectDetailsAttempts = 5
+
+	// projectDetailsRetryIntervalSecond define the time in second between each attempt, doubled after each one
+	projectDetailsRetryIntervalSecond = 5
+)
+
+// resolveProjectDetails determines the project, location and name of the cluster: values set explicitly win, the
+// others are derived from the provider id of a node, retried on transient errors, or else from the metadata server
+func resolveProjectDetails(k KubernetesClient, g GCloudClient, project, location, cluster string) error {
+	if project == "" || location == "" || cluster == "" {
+		if err := getProjectDetailsFromNodes(k, g); err != nil {
+			log.Warn().
+				Err(err).
+				Msg("Error deriving project details from the nodes, falling back to the metadata server")
+
+			if err := g.GetProjectDetailsFromMetadata(); err != nil {
+				log.Warn().
+					Err(err).
+					Msg("Error getting project details from the metadata server")
+			}
+		}
+	}
+
+	g.SetProjectDetails(project, location, cluster)
+
+	project, location, cluster = g.GetProjectDetails()
+
+	missing := []string{}
+	for _, detail := range []struct{ flag, value string }{{"--cluster-project", project}, {"--cluster-location", location}, {"--cluster-name", cluster}} {
+		if detail.value == "" {
+			missing = append(missing, detail.flag)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("Project details can't be determined, are you running this in GKE? Otherwise set %v", missing)
+	}
+
+	log.Info().
+		Str("project", project).
+		Str("location", location).
+		Str("cluster", cluster).
+		Msg("Project details determined")
+
+	return nil
+}
+
+// getProjectDetailsFromNodes derives the project details from the provider id of the first node, retrying transient
+// errors; a provider id that can't be parsed isn't retried
+func getProjectDetailsFromNodes(k KubernetesClient, g GCloudClient) (err error) {
+	retryInterval := projectDetailsRetryIntervalSecond * time.Second
+
+	for attempt := 1; attempt <= projectDetailsAttempts; attempt++ {
+		providerID := ""
+
+		nodes, err := k.GetNodeList("")
+
+		if err == nil && len(nodes.Items) == 0 {
+			err = fmt.Errorf("Error there is no node in the cluster")
+		}
+
+		if err == nil {
+			providerID = nodes.Items[0].Spec.ProviderID
+			err = g.GetProjectDetailsFromNode(providerID)
+		}
+
+		if err == nil {
+			return nil
+		}
+
+		log.Warn().
+			Err(err).
+			Int("attempt", attempt).
+			Str("provider-id", providerID).
+			Msgf("Error getting project details from node, attempt %d of %d", attempt, projectDetailsAttempts)
+
+		var providerIDErr *ProviderIDError
+		if errors.As(err, &providerIDErr) || attempt == projectDetailsAttempts {
+			return err
+		}
+
+		time.Sleep(retryInterval)
+		retryInterval *= 2
+	}
+
+	return
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
+	"google.golang.org/api/container/v1beta1"
+)
+
+// RotatingGCloudContainer passes calls on to the current GCloud container client, which is replaced when the
+// credentials it was created with are rotated
+type RotatingGCloudContainer struct {
+	mutex  sync.RWMutex
+	client GCloudContainerClient
+}
+
+// NewRotatingGCloudContainer wraps a GCloud container client so it can be replaced while in use
+func NewRotatingGCloudContainer(client GCloudContainerClient) *RotatingGCloudContainer {
+	return &RotatingGCloudContainer{client: client}
+}
+
+// Set replaces the client, calls in progress finish with the previous one
+func (c *RotatingGCloudContainer) Set(client GCloudContainerClient) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.client = client
+}
+
+// current returns the client to pass a call on to
+func (c *RotatingGCloudContainer) current() GCloudContainerClient {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.client
+}
+
+func (c *RotatingGCloudContainer) GetNodePoolLocations(name string) ([]string, error) {
+	return c.current().GetNodePoolLocations(name)
+}
+
+func (c *RotatingGCloudContainer) GetNodePoolInstanceGroupURLs(name string) ([]string, error) {
+	return c.current().GetNodePoolInstanceGroupURLs(name)
+}
+
+func (c *RotatingGCloudContainer) GetPendingResizeOperation(name string) (string, error) {
+	return c.current().GetPendingResizeOperation(name)
+}
+
+func (c *RotatingGCloudContainer) GetMaintenanceExclusions() ([]shifter.MaintenanceExclusion, error) {
+	return c.current().GetMaintenanceExclusions()
+}
+
+func (c *RotatingGCloudContainer) GetNodePoolTargetSizes(name string) (map[string]int, error) {
+	return c.current().GetNodePoolTargetSizes(name)
+}
+
+func (c *RotatingGCloudContainer) SetNodePoolSize(ctx context.Context, name string, size int64) error {
+	return c.current().SetNodePoolSize(ctx, name, size)
+}
+
+func (c *RotatingGCloudContainer) SetNodePoolZoneSize(ctx context.Context, name, zone string, size int64) error {
+	return c.current().SetNodePoolZoneSize(ctx, name, zone, size)
+}
+
+func (c *RotatingGCloudContainer) DeleteNodePoolInstances(ctx context.Context, name, zone string, instances []string) error {
+	return c.current().DeleteNodePoolInstances(ctx, name, zone, instances)
+}
+
+func (c *RotatingGCloudContainer) DeleteNodePool(ctx context.Context, name string) error {
+	return c.current().DeleteNodePool(ctx, name)
+}
+
+func (c *RotatingGCloudContainer) CountPreemptions(name string, zones []string, since time.Time) (int, error) {
+	return c.current().CountPreemptions(name, zones, since)
+}
+
+func (c *RotatingGCloudContainer) GetNodePoolInstanceGroups(name string) ([]InstanceGroup, error) {
+	return c.current().GetNodePoolInstanceGroups(name)
+}
+
+func (c *RotatingGCloudContainer) GetClusterID() string {
+	return c.current().GetClusterID()
+}
+
+func (c *RotatingGCloudContainer) IsAutopilot() (bool, error) {
+	return c.current().IsAutopilot()
+}
+
+func (c *RotatingGCloudContainer) IsNodeAutoprovisioningEnabled() (bool, error) {
+	return c.current().IsNodeAutoprovisioningEnabled()
+}
+
+func (c *RotatingGCloudContainer) waitForOperation(ctx context.Context, operation *container.Operation) error {
+	return c.current().waitForOperation(ctx, operation)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+)
+
+// clusterClient is a GCloud container client that only knows its cluster
+type clusterClient struct {
+	GCloudContainerClient
+	cluster string
+}
+
+func (c clusterClient) GetClusterID() string {
+	return c.cluster
+}
+
+func TestRotatingGCloudContainer(t *testing.T) {
+	client := NewRotatingGCloudContainer(clusterClient{cluster: "old-key"})
+
+	if cluster := client.GetClusterID(); cluster != "old-key" {
+		t.Errorf("GetClusterID, expected the initial client got %v", cluster)
+	}
+
+	client.Set(clusterClient{cluster: "new-key"})
+
+	if cluster := client.GetClusterID(); cluster != "new-key" {
+		t.Errorf("GetClusterID after a rotation, expected the new client got %v", cluster)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	secretmanager "google.golang.org/api/secretmanager/v1"
+)
+
+// secretReferencePrefix marks a flag value as a reference to a Secret Manager secret, e.g.
+// sm://my-project/webhook-secret or sm://my-project/webhook-secret/3 to pin a version
+const secretReferencePrefix = "sm://"
+
+// secretAccessTimeoutSecond define the time in second accessing a secret version may take
+const secretAccessTimeoutSecond = 30
+
+// parseSecretReference returns the resource name of the secret version a reference points to, latest unless a version
+// is given
+func parseSecretReference(reference string) (name string, err error) {
+	parts := strings.Split(strings.TrimPrefix(reference, secretReferencePrefix), "/")
+
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", fmt.Errorf("Secret reference %v doesn't match %v<project>/<secret>[/<version>]", reference, secretReferencePrefix)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return "", fmt.Errorf("Secret reference %v doesn't match %v<project>/<secret>[/<version>]", reference, secretReferencePrefix)
+		}
+	}
+
+	version := "latest"
+	if len(parts) == 3 {
+		version = parts[2]
+	}
+
+	return fmt.Sprintf("projects/%v/secrets/%v/versions/%v", parts[0], parts[1], version), nil
+}
+
+// Secret holds the value of a sensitive flag, either given as is or referencing a Secret Manager secret; it's safe for
+// concurrent use so the value can be refreshed when the secret is rotated
+type Secret struct {
+	Reference string
+
+	mutex    sync.RWMutex
+	value    string
+	onRotate func(string)
+}
+
+// NewSecret returns a secret for a flag value, a reference is only resolved by a SecretManager
+func NewSecret(value string) *Secret {
+	if strings.HasPrefix(value, secretReferencePrefix) {
+		return &Secret{Reference: value}
+	}
+
+	return &Secret{value: value}
+}
+
+// IsReference returns true if the secret references a Secret Manager secret
+func (s *Secret) IsReference() bool {
+	return s != nil && s.Reference != ""
+}
+
+// IsPinned returns true if the secret references a numbered version of a Secret Manager secret, which never rotates;
+// latest and other aliases can be moved to a new version
+func (s *Secret) IsPinned() bool {
+	if !s.IsReference() {
+		return false
+	}
+
+	parts := strings.Split(strings.TrimPrefix(s.Reference, secretReferencePrefix), "/")
+	if len(parts) != 3 {
+		return false
+	}
+
+	_, err := strconv.ParseUint(parts[2], 10, 64)
+	return err == nil
+}
+
+// OnRotate sets a function called with the new value each time a refresh finds the secret rotated
+func (s *Secret) OnRotate(fn func(string)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.onRotate = fn
+}
+
+// Value returns the current value of the secret, empty for a nil secret
+func (s *Secret) Value() string {
+	if s == nil {
+		return ""
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.value
+}
+
+// set updates the value and returns true if it changed
+func (s *Secret) set(value string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	changed := s.value != value
+	s.value = value
+
+	return changed
+}
+
+// SecretManager resolves secret references through the Secret Manager API
+type SecretManager struct {
+	Service *secretmanager.Service
+}
+
+// NewSecretManager returns a Secret Manager client using the application default credentials
+func NewSecretManager() (*SecretManager, error) {
+	service, err := secretmanager.NewService(context.Background())
+
+	if err != nil {
+		return nil, fmt.Errorf("Error creating Secret Manager client:\n%v", err)
+	}
+
+	return &SecretManager{Service: service}, nil
+}
+
+// Access returns the data of the secret version a reference points to
+func (m *SecretManager) Access(reference string) (value string, err error) {
+	name, err := parseSecretReference(reference)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretAccessTimeoutSecond*time.Second)
+	defer cancel()
+
+	response, err := m.Service.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+
+	if err != nil {
+		return "", fmt.Errorf("Error accessing secret version %v:\n%v", name, err)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(response.Payload.Data)
+
+	if err != nil {
+		return "", fmt.Errorf("Error decoding secret version %v:\n%v", name, err)
+	}
+
+	return string(data), nil
+}
+
+// Resolve sets the value of all referencing secrets, returning the first error
+func (m *SecretManager) Resolve(secrets ...*Secret) error {
+	for _, secret := range secrets {
+		if !secret.IsReference() {
+			continue
+		}
+
+		value, err := m.Access(secret.Reference)
+		if err != nil {
+			return err
+		}
+
+		secret.set(value)
+	}
+
+	return nil
+}
+
+// Refresh resolves the referencing secrets again each interval, keeping the last value when accessing a secret fails;
+// secrets pinned to a version never rotate and aren't refreshed
+func (m *SecretManager) Refresh(interval time.Duration, secrets ...*Secret) {
+	for range time.Tick(interval) {
+		for _, secret := range secrets {
+			if !secret.IsReference() || secret.IsPinned() {
+				continue
+			}
+
+			value, err := m.Access(secret.Reference)
+
+			if err != nil {
+				log.Warn().
+					Err(err).
+					Str("secret", secret.Reference).
+					Msg("Error refreshing secret, keeping the current value")
+				continue
+			}
+
+			if !secret.set(value) {
+				continue
+			}
+
+			log.Info().
+				Str("secret", secret.Reference).
+				Msg("Secret was rotated")
+
+			secret.mutex.RLock()
+			onRotate := secret.onRotate
+			secret.mutex.RUnlock()
+
+			if onRotate != nil {
+				onRotate(value)
+			}
+		}
+	}
+}
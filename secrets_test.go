@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+	secretmanager "google.golang.org/api/secretmanager/v1"
+)
+
+func TestParseSecretReference(t *testing.T) {
+	tests := []struct {
+		reference string
+		expected  string
+		err       bool
+	}{
+		{"sm://my-project/webhook-secret", "projects/my-project/secrets/webhook-secret/versions/latest", false},
+		{"sm://my-project/webhook-secret/3", "projects/my-project/secrets/webhook-secret/versions/3", false},
+		{"sm://my-project", "", true},
+		{"sm://my-project//3", "", true},
+		{"sm://my-project/webhook-secret/3/4", "", true},
+	}
+
+	for _, test := range tests {
+		name, err := parseSecretReference(test.reference)
+
+		if test.err != (err != nil) {
+			t.Errorf("parseSecretReference(%v), expected error %v got %v", test.reference, test.err, err)
+		}
+		if name != test.expected {
+			t.Errorf("parseSecretReference(%v), expected %v got %v", test.reference, test.expected, name)
+		}
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	plain := NewSecret("s3cr3t")
+	if plain.IsReference() || plain.Value() != "s3cr3t" {
+		t.Errorf("NewSecret(s3cr3t), expected a plain secret got %v %v", plain.Reference, plain.Value())
+	}
+
+	reference := NewSecret("sm://my-project/webhook-secret")
+	if !reference.IsReference() || reference.Value() != "" {
+		t.Errorf("NewSecret(sm://my-project/webhook-secret), expected an unresolved reference got %v", reference.Value())
+	}
+
+	var none *Secret
+	if none.IsReference() || none.Value() != "" {
+		t.Errorf("nil secret, expected an empty value")
+	}
+}
+
+func TestSecretIsPinned(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected bool
+	}{
+		{"s3cr3t", false},
+		{"sm://my-project/credentials", false},
+		{"sm://my-project/credentials/latest", false},
+		{"sm://my-project/credentials/production", false},
+		{"sm://my-project/credentials/3", true},
+	}
+
+	for _, test := range tests {
+		if output := NewSecret(test.value).IsPinned(); output != test.expected {
+			t.Errorf("NewSecret(%v).IsPinned(), expected %v got %v", test.value, test.expected, output)
+		}
+	}
+}
+
+func TestSecretManagerRefresh(t *testing.T) {
+	var mutex sync.Mutex
+	accessed := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		accessed = append(accessed, r.URL.Path)
+		mutex.Unlock()
+
+		w.Write([]byte(`{"payload": {"data": "` + base64.StdEncoding.EncodeToString([]byte("rotated")) + `"}}`))
+	}))
+	defer server.Close()
+
+	service, err := secretmanager.NewService(context.Background(), option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("NewService, expected no error got %v", err)
+	}
+
+	floating := NewSecret("sm://my-project/credentials")
+	floating.set("initial")
+	pinned := NewSecret("sm://my-project/webhook-secret/3")
+	pinned.set("initial")
+
+	rotated := make(chan string, 1)
+	floating.OnRotate(func(value string) {
+		rotated <- value
+	})
+
+	go (&SecretManager{Service: service}).Refresh(10*time.Millisecond, floating, pinned)
+
+	select {
+	case value := <-rotated:
+		if value != "rotated" || floating.Value() != "rotated" {
+			t.Errorf("Refresh, expected the rotated value got %v", value)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Refresh, expected the rotation to be notified")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for _, path := range accessed {
+		if strings.Contains(path, "webhook-secret") {
+			t.Errorf("Refresh, expected the pinned secret not to be accessed got %v", path)
+		}
+	}
+	if pinned.Value() != "initial" {
+		t.Errorf("Refresh, expected the pinned secret to keep its value got %v", pinned.Value())
+	}
+}
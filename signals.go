@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SignalControl gives operators exec'ing into the pod a manual control path: SIGUSR1 triggers an immediate cycle and
+// SIGUSR2 toggles pausing shifting
+type SignalControl struct {
+	evaluate chan struct{}
+	paused   int32
+}
+
+// NewSignalControl starts listening for SIGUSR1 and SIGUSR2
+func NewSignalControl() *SignalControl {
+	c := &SignalControl{
+		evaluate: make(chan struct{}, 1),
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		for s := range signals {
+			switch s {
+			case syscall.SIGUSR1:
+				log.Info().Msg("Received SIGUSR1, evaluating immediately")
+
+				// a pending request is enough, more signals before the cycle starts are merged into it
+				select {
+				case c.evaluate <- struct{}{}:
+				default:
+				}
+			case syscall.SIGUSR2:
+				if c.TogglePause() {
+					log.Info().Msg("Received SIGUSR2, pausing shifting")
+				} else {
+					log.Info().Msg("Received SIGUSR2, resuming shifting")
+				}
+			}
+		}
+	}()
+
+	return c
+}
+
+// Wait sleeps for the given duration, or less if an immediate cycle is requested
+func (c *SignalControl) Wait(d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-c.evaluate:
+	}
+}
+
+// TogglePause pauses or resumes shifting and returns whether it is paused now
+func (c *SignalControl) TogglePause() bool {
+	for {
+		paused := atomic.LoadInt32(&c.paused)
+		if atomic.CompareAndSwapInt32(&c.paused, paused, 1-paused) {
+			return paused == 0
+		}
+	}
+}
+
+// Paused returns true while shifting is paused
+func (c *SignalControl) Paused() bool {
+	return atomic.LoadInt32(&c.paused) == 1
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
+)
+
+// ShutdownSummary reports what the shifter did since it started, it's logged on graceful shutdown and doubles as the
+// report of short-lived runs, e.g. as CronJob
+type ShutdownSummary struct {
+	Event        string              `json:"event"`
+	Cluster      string              `json:"cluster"`
+	NodePoolFrom string              `json:"nodePoolFrom"`
+	NodePoolTo   string              `json:"nodePoolTo"`
+	StartedAt    time.Time           `json:"startedAt"`
+	StoppedAt    time.Time           `json:"stoppedAt"`
+	Cycles       int                 `json:"cycles"`
+	Shifts       int                 `json:"shifts"`
+	Failures     int                 `json:"failures"`
+	Statuses     map[string]int      `json:"statuses"`
+	LastStatus   string              `json:"lastStatus,omitempty"`
+	LastState    *shifter.CycleState `json:"lastState,omitempty"`
+}
+
+// SummaryRecorder records the cycles of a run into a shutdown summary
+type SummaryRecorder struct {
+	mutex   sync.Mutex
+	summary ShutdownSummary
+}
+
+// NewSummaryRecorder returns a recorder with an empty summary of a run started now
+func NewSummaryRecorder(cluster, nodePoolFrom, nodePoolTo string) *SummaryRecorder {
+	return &SummaryRecorder{
+		summary: ShutdownSummary{
+			Event:        "shutdown",
+			Cluster:      cluster,
+			NodePoolFrom: nodePoolFrom,
+			NodePoolTo:   nodePoolTo,
+			StartedAt:    time.Now(),
+			Statuses:     map[string]int{},
+		},
+	}
+}
+
+// Record counts a cycle with the given status and keeps its state as the last one
+func (r *SummaryRecorder) Record(status string, state *shifter.CycleState) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.summary.Cycles++
+	r.summary.Statuses[status]++
+
+	switch status {
+	case "shifted":
+		r.summary.Shifts++
+	case "failed":
+		r.summary.Failures++
+	}
+
+	r.summary.LastStatus = status
+	r.summary.LastState = state
+}
+
+// Stop returns a copy of the summary, stopped now
+func (r *SummaryRecorder) Stop() ShutdownSummary {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	summary := r.summary
+	summary.StoppedAt = time.Now()
+	summary.Statuses = map[string]int{}
+	for status, count := range r.summary.Statuses {
+		summary.Statuses[status] = count
+	}
+
+	return summary
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
+)
+
+func TestSummaryRecorderRecord(t *testing.T) {
+	summary := NewSummaryRecorder("production", "default-pool", "preemptible-pool")
+
+	summary.Record("skipped", &shifter.CycleState{SkipReason: "at_minimum"})
+	summary.Record("shifted", &shifter.CycleState{})
+	summary.Record("failed", &shifter.CycleState{})
+	last := &shifter.CycleState{SkipReason: "no_victim"}
+	summary.Record("skipped", last)
+
+	stopped := summary.Stop()
+
+	if stopped.Cycles != 4 || stopped.Shifts != 1 || stopped.Failures != 1 {
+		t.Errorf("Record, expected 4 cycles, 1 shift and 1 failure got %d, %d and %d", stopped.Cycles, stopped.Shifts, stopped.Failures)
+	}
+
+	if stopped.Statuses["skipped"] != 2 {
+		t.Errorf("Record, expected 2 skipped cycles got %d", stopped.Statuses["skipped"])
+	}
+
+	if stopped.LastStatus != "skipped" || stopped.LastState != last {
+		t.Errorf("Record, expected the last cycle to be kept got %v", stopped.LastStatus)
+	}
+
+	if stopped.StoppedAt.Before(stopped.StartedAt) {
+		t.Errorf("Stop, expected the summary to stop after it started")
+	}
+}
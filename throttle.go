@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// operationLeasesName is the name of the ConfigMap holding the operation slots taken by all shifters running in
+	// the namespace, whatever node pools they shift
+	operationLeasesName = "estafette-gke-node-pool-shifter-operations"
+
+	// operationLeaseDuration bounds how long a slot is held when the operation has no deadline, so a shifter exiting
+	// mid-operation doesn't hold its slot forever
+	operationLeaseDuration = 30 * time.Minute
+)
+
+// operationLease is an operation slot taken on a cluster until it's released or expires
+type operationLease struct {
+	Cluster string    `json:"cluster"`
+	Expires time.Time `json:"expires"`
+}
+
+// OperationLimiter limits the number of in-flight GKE operations per cluster over all shifters sharing its ConfigMap,
+// i.e. those running in the same namespace; each slot is a lease in that ConfigMap, callers beyond the limit poll for a
+// free slot until their context is done
+type OperationLimiter struct {
+	Max          int
+	PollInterval time.Duration
+	kubernetes   KubernetesClient
+	holder       string
+	sequence     uint64
+}
+
+// NewOperationLimiter returns a limiter allowing max concurrent operations per cluster, whose leases are taken in the
+// name of the given holder
+func NewOperationLimiter(kubernetes KubernetesClient, holder string, max int) *OperationLimiter {
+	return &OperationLimiter{
+		Max:          max,
+		PollInterval: 5 * time.Second,
+		kubernetes:   kubernetes,
+		holder:       holder,
+	}
+}
+
+// Acquire waits for a free operation slot on the given cluster and returns the key of the lease taken, to release it
+func (l *OperationLimiter) Acquire(ctx context.Context, cluster string) (key string, err error) {
+	key = fmt.Sprintf("%v.%d", l.holder, atomic.AddUint64(&l.sequence, 1))
+
+	expires := time.Now().Add(operationLeaseDuration)
+	if deadline, ok := ctx.Deadline(); ok {
+		expires = deadline
+	}
+
+	waiting := false
+
+	for {
+		acquired, err := l.tryAcquire(key, operationLease{Cluster: cluster, Expires: expires.UTC()})
+
+		if err != nil && !errors.IsConflict(err) && !errors.IsAlreadyExists(err) {
+			return "", fmt.Errorf("Error acquiring an operation slot on cluster %v:\n%v", cluster, err)
+		}
+
+		if acquired {
+			return key, nil
+		}
+
+		// another shifter changed the leases meanwhile, those are read again right away
+		if err != nil {
+			continue
+		}
+
+		if !waiting {
+			log.Info().
+				Str("cluster", cluster).
+				Msgf("Maximum of %d concurrent operations reached on the cluster, waiting for a free slot...", l.Max)
+			waiting = true
+		}
+
+		select {
+		case <-time.After(l.PollInterval):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// tryAcquire takes a lease when the cluster has a free slot, dropping the expired leases of all clusters on the way
+func (l *OperationLimiter) tryAcquire(key string, lease operationLease) (acquired bool, err error) {
+	configMap, leases, err := l.leases()
+	if err != nil {
+		return
+	}
+
+	held := 0
+	for k, other := range leases {
+		if other.Expires.Before(time.Now()) {
+			delete(leases, k)
+			continue
+		}
+		if other.Cluster == lease.Cluster {
+			held++
+		}
+	}
+
+	if held >= l.Max {
+		return
+	}
+
+	leases[key] = lease
+
+	if err = l.replace(configMap, leases); err != nil {
+		return
+	}
+
+	return true, nil
+}
+
+// Release frees the operation slot of the given lease; a slot failing to be released is freed once its lease expires
+func (l *OperationLimiter) Release(key string) {
+	for {
+		configMap, leases, err := l.leases()
+
+		if err == nil {
+			if _, ok := leases[key]; !ok {
+				return
+			}
+
+			delete(leases, key)
+			err = l.replace(configMap, leases)
+		}
+
+		if err == nil {
+			return
+		}
+
+		if !errors.IsConflict(err) {
+			log.Warn().
+				Err(err).
+				Str("lease", key).
+				Msg("Error releasing operation slot, it's freed once its lease expires")
+			return
+		}
+	}
+}
+
+// leases returns the ConfigMap of the leases, a new one when it doesn't exist yet, and the leases it holds
+func (l *OperationLimiter) leases() (configMap *v1.ConfigMap, leases map[string]operationLease, err error) {
+	configMap, err = l.kubernetes.GetConfigMap(operationLeasesName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error getting ConfigMap %v:\n%v", operationLeasesName, err)
+	}
+
+	if configMap == nil {
+		configMap = &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: operationLeasesName}}
+	}
+
+	leases = map[string]operationLease{}
+	for k, value := range configMap.Data {
+		var lease operationLease
+		// an unreadable lease is dropped, as if it had expired
+		if json.Unmarshal([]byte(value), &lease) == nil {
+			leases[k] = lease
+		}
+	}
+
+	return
+}
+
+// replace writes the leases to their ConfigMap, conditionally on it not having changed since it was read
+func (l *OperationLimiter) replace(configMap *v1.ConfigMap, leases map[string]operationLease) error {
+	configMap = configMap.DeepCopy()
+	configMap.Data = map[string]string{}
+
+	for k, lease := range leases {
+		value, err := json.Marshal(lease)
+		if err != nil {
+			return err
+		}
+		configMap.Data[k] = string(value)
+	}
+
+	return l.kubernetes.ReplaceConfigMap(configMap)
+}
+
+// ThrottledGCloudContainer holds an operation slot of its cluster during each resize or deletion
+type ThrottledGCloudContainer struct {
+	GCloudContainerClient
+	Limiter *OperationLimiter
+	Cluster string
+}
+
+// NewThrottledGCloudContainer wraps a GCloud container client to respect the limiter of its cluster
+func NewThrottledGCloudContainer(client GCloudContainerClient, limiter *OperationLimiter) GCloudContainerClient {
+	return &ThrottledGCloudContainer{
+		GCloudContainerClient: client,
+		Limiter:               limiter,
+		Cluster:               client.GetClusterID(),
+	}
+}
+
+// SetNodePoolSize set the size of a given node pool once an operation slot is free
+func (c *ThrottledGCloudContainer) SetNodePoolSize(ctx context.Context, name string, size int64) (err error) {
+	key, err := c.Limiter.Acquire(ctx, c.Cluster)
+	if err != nil {
+		return
+	}
+	defer c.Limiter.Release(key)
+
+	return c.GCloudContainerClient.SetNodePoolSize(ctx, name, size)
+}
+
+// SetNodePoolZoneSize set the size of a given node pool in a single zone once an operation slot is free
+func (c *ThrottledGCloudContainer) SetNodePoolZoneSize(ctx context.Context, name, zone string, size int64) (err error) {
+	key, err := c.Limiter.Acquire(ctx, c.Cluster)
+	if err != nil {
+		return
+	}
+	defer c.Limiter.Release(key)
+
+	return c.GCloudContainerClient.SetNodePoolZoneSize(ctx, name, zone, size)
+}
+
+// DeleteNodePoolInstances deletes instances of a given node pool once an operation slot is free
+func (c *ThrottledGCloudContainer) DeleteNodePoolInstances(ctx context.Context, name, zone string, instances []string) (err error) {
+	key, err := c.Limiter.Acquire(ctx, c.Cluster)
+	if err != nil {
+		return
+	}
+	defer c.Limiter.Release(key)
+
+	return c.GCloudContainerClient.DeleteNodePoolInstances(ctx, name, zone, instances)
+}
+
+// DeleteNodePool deletes a given node pool once an operation slot is free
+func (c *ThrottledGCloudContainer) DeleteNodePool(ctx context.Context, name string) (err error) {
+	key, err := c.Limiter.Acquire(ctx, c.Cluster)
+	if err != nil {
+		return
+	}
+	defer c.Limiter.Release(key)
+
+	return c.GCloudContainerClient.DeleteNodePool(ctx, name)
+}
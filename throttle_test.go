@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// configMapsClient is a Kubernetes client holding ConfigMaps in memory, rejecting writes of outdated ones like the
+// API server does
+type configMapsClient struct {
+	KubernetesClient
+	mutex      sync.Mutex
+	configMaps map[string]*v1.ConfigMap
+	version    int
+}
+
+func (c *configMapsClient) GetConfigMap(name string) (*v1.ConfigMap, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if configMap, ok := c.configMaps[name]; ok {
+		return configMap.DeepCopy(), nil
+	}
+	return nil, nil
+}
+
+func (c *configMapsClient) ReplaceConfigMap(configMap *v1.ConfigMap) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	resource := schema.GroupResource{Resource: "configmaps"}
+	existing, ok := c.configMaps[configMap.Name]
+
+	if !ok && configMap.ResourceVersion != "" {
+		return errors.NewNotFound(resource, configMap.Name)
+	}
+	if ok && configMap.ResourceVersion == "" {
+		return errors.NewAlreadyExists(resource, configMap.Name)
+	}
+	if ok && configMap.ResourceVersion != existing.ResourceVersion {
+		return errors.NewConflict(resource, configMap.Name, nil)
+	}
+
+	c.version++
+	configMap = configMap.DeepCopy()
+	configMap.ResourceVersion = strconv.Itoa(c.version)
+	c.configMaps[configMap.Name] = configMap
+	return nil
+}
+
+func TestOperationLimiter(t *testing.T) {
+	// two shifters of the same namespace, shifting different node pools of a cluster
+	client := &configMapsClient{configMaps: map[string]*v1.ConfigMap{}}
+	first := NewOperationLimiter(client, "shifter-a", 1)
+	second := NewOperationLimiter(client, "shifter-b", 1)
+	first.PollInterval = time.Millisecond
+	second.PollInterval = time.Millisecond
+	ctx := context.Background()
+
+	key, err := first.Acquire(ctx, "cluster-a")
+	if err != nil {
+		t.Fatalf("Acquire, expected no error got %v", err)
+	}
+
+	// other clusters have their own slots
+	otherKey, err := second.Acquire(ctx, "cluster-b")
+	if err != nil {
+		t.Errorf("Acquire on another cluster, expected no error got %v", err)
+	}
+	second.Release(otherKey)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := second.Acquire(timeoutCtx, "cluster-a"); err == nil {
+		t.Errorf("Acquire while the other shifter holds the slot, expected an error once the context is done")
+	}
+
+	acquired := make(chan error)
+	go func() {
+		_, err := second.Acquire(ctx, "cluster-a")
+		acquired <- err
+	}()
+
+	select {
+	case err := <-acquired:
+		t.Fatalf("Acquire while the other shifter holds the slot, expected to wait got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	first.Release(key)
+
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Errorf("Acquire once the other shifter released the slot, expected no error got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Acquire once the other shifter released the slot, expected the slot to be taken")
+	}
+}
+
+func TestOperationLimiterExpiredLease(t *testing.T) {
+	client := &configMapsClient{configMaps: map[string]*v1.ConfigMap{}}
+	first := NewOperationLimiter(client, "shifter-a", 1)
+	second := NewOperationLimiter(client, "shifter-b", 1)
+
+	// the first shifter exits mid-operation without releasing its slot
+	expiredCtx, cancel := context.WithDeadline(context.Background(), time.Now().Add(10*time.Millisecond))
+	defer cancel()
+
+	if _, err := first.Acquire(expiredCtx, "cluster-a"); err != nil {
+		t.Fatalf("Acquire, expected no error got %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := second.Acquire(timeoutCtx, "cluster-a"); err != nil {
+		t.Errorf("Acquire once the lease of the other shifter expired, expected no error got %v", err)
+	}
+
+	configMap, _ := client.GetConfigMap(operationLeasesName)
+	if len(configMap.Data) != 1 {
+		t.Errorf("Expected the expired lease to be dropped got %v", configMap.Data)
+	}
+}
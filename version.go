@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// versionInfo holds the build metadata embedded at build time
+type versionInfo struct {
+	AppGroup  string `json:"appgroup"`
+	App       string `json:"app"`
+	Version   string `json:"version"`
+	Branch    string `json:"branch"`
+	Revision  string `json:"revision"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// handleVersion serves the embedded build metadata as json
+func handleVersion(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(versionInfo{
+		AppGroup:  appgroup,
+		App:       app,
+		Version:   version,
+		Branch:    branch,
+		Revision:  revision,
+		BuildDate: buildDate,
+		GoVersion: goVersion,
+	})
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error writing version response")
+	}
+}
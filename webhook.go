@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
+)
+
+// webhookTimeoutSecond define the time in second a webhook request may take
+const webhookTimeoutSecond = 10
+
+// webhookSignatureHeader holds the HMAC-SHA256 signature of the body, signed with the webhook secret
+const webhookSignatureHeader = "X-Shifter-Signature"
+
+// Webhook posts shift events as json to an external endpoint
+type Webhook struct {
+	URL    string
+	Secret *Secret
+	Client *http.Client
+}
+
+// NewWebhook returns a webhook posting to the given url, signing the body when a secret is given; the current value of
+// the secret is used for each request so rotations apply right away
+func NewWebhook(url string, secret *Secret) *Webhook {
+	return &Webhook{
+		URL:    url,
+		Secret: secret,
+		Client: &http.Client{Timeout: webhookTimeoutSecond * time.Second},
+	}
+}
+
+// Send posts a shift event to the webhook
+func (w *Webhook) Send(event shifter.ShiftEvent) error {
+	return w.post(event)
+}
+
+// SendSummary posts the shutdown summary to the webhook
+func (w *Webhook) SendSummary(summary ShutdownSummary) error {
+	return w.post(summary)
+}
+
+// post posts a payload as json to the webhook
+func (w *Webhook) post(payload interface{}) (err error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	request, err := http.NewRequestWithContext(context.Background(), http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	if secret := w.Secret.Value(); secret != "" {
+		request.Header.Set(webhookSignatureHeader, "sha256="+signPayload(secret, body))
+	}
+
+	response, err := w.Client.Do(request)
+	if err != nil {
+		return fmt.Errorf("Error posting to webhook:\n%v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("Webhook responded with %v", response.Status)
+	}
+
+	return
+}
+
+// signPayload returns the hex encoded HMAC-SHA256 of a payload
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
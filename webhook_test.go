@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/estafette/estafette-gke-node-pool-shifter/pkg/shifter"
+)
+
+func TestWebhookSend(t *testing.T) {
+	var received shifter.ShiftEvent
+	var signature, expectedSignature string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+
+		signature = r.Header.Get(webhookSignatureHeader)
+		expectedSignature = "sha256=" + signPayload("s3cr3t", body)
+	}))
+	defer server.Close()
+
+	err := NewWebhook(server.URL, NewSecret("s3cr3t")).Send(shifter.ShiftEvent{
+		Event:   "planned",
+		Cluster: "production",
+		Shift:   shifter.ShiftRecord{Phase: shifter.PhasePlanned, NodePoolFrom: "default-pool", NodePoolTo: "preemptible-pool"},
+	})
+
+	if err != nil {
+		t.Fatalf("Send, expected no error got %v", err)
+	}
+
+	if received.Event != "planned" || received.Shift.NodePoolTo != "preemptible-pool" {
+		t.Errorf("Send, expected the planned event to be posted got %v", received)
+	}
+
+	if signature != expectedSignature {
+		t.Errorf("Send, expected signature %v got %v", expectedSignature, signature)
+	}
+}
+
+func TestWebhookSendFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	if err := NewWebhook(server.URL, nil).Send(shifter.ShiftEvent{Event: "failed"}); err == nil {
+		t.Errorf("Send, expected an error on a failed response")
+	}
+}